@@ -19,24 +19,30 @@ func NewAdminHandler(db *gorm.DB) *AdminHandler {
 }
 
 type MonthlyReportData struct {
-	User              models.User `json:"user"`
-	TotalWorkingDays  int         `json:"total_working_days"`
-	ActualWorkingDays int         `json:"actual_working_days"`
-	TotalWorkingHours string      `json:"total_working_hours"`
-	PlannedHours      string      `json:"planned_hours"`
-	Overtime          string      `json:"overtime"`
-	LeaveDays         int         `json:"leave_days"`
-	PendingLeaves     int         `json:"pending_leaves"`
-	AttendanceRate    string      `json:"attendance_rate"`
+	User              models.User        `json:"user"`
+	TotalWorkingDays  int                `json:"total_working_days"`
+	ActualWorkingDays int                `json:"actual_working_days"`
+	TotalWorkingHours string             `json:"total_working_hours"`
+	PlannedHours      string             `json:"planned_hours"`
+	Overtime          string             `json:"overtime"`
+	LeaveDays         float64            `json:"leave_days"`
+	PaidLeaveDays     float64            `json:"paid_leave_days"`
+	UnpaidLeaveDays   float64            `json:"unpaid_leave_days"`
+	LeaveHours        string             `json:"leave_hours"`
+	PendingLeaves     int                `json:"pending_leaves"`
+	AttendanceRate    string             `json:"attendance_rate"`
+	HolidayWork       HolidayWorkSummary `json:"holiday_work"`
+	Closing           MonthlyCloseStatus `json:"closing"`
 }
 
 type MonthlyReportSummary struct {
 	Month            string              `json:"month"`
 	TotalEmployees   int                 `json:"total_employees"`
 	AverageWorking   string              `json:"average_working_hours"`
-	TotalLeaves      int                 `json:"total_leaves"`
+	TotalLeaves      float64             `json:"total_leaves"`
 	PendingLeaves    int                 `json:"pending_leaves"`
 	AverageAttendance string             `json:"average_attendance_rate"`
+	ClosingStatus    models.ClosingStatus `json:"closing_status"`
 	Reports          []MonthlyReportData `json:"reports"`
 }
 
@@ -51,27 +57,53 @@ func (h *AdminHandler) GetMonthlyReports(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Month parameter is required (format: YYYY-MM)")
 	}
 
-	parsedTime, err := time.Parse("2006-01", month)
+	startOfMonth, endOfMonth, err := monthRange(month)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "Invalid month format. Expected YYYY-MM")
+		return err
+	}
+	export, err := parseMonthlyReportExport(c)
+	if err != nil {
+		return err
 	}
 
-	startOfMonth := time.Date(parsedTime.Year(), parsedTime.Month(), 1, 0, 0, 0, 0, parsedTime.Location())
-	endOfMonth := startOfMonth.AddDate(0, 1, -1)
+	scope, err := scopeFor(c, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
 
 	var users []models.User
-	if err := h.db.Where("role != ?", "admin").Find(&users).Error; err != nil {
+	if err := scope.apply(h.db, "id").Where("role != ?", "admin").Order("id ASC").Find(&users).Error; err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve users")
 	}
 
+	userIDs := make([]uint, 0, len(users))
+	for _, user := range users {
+		userIDs = append(userIDs, user.ID)
+	}
+	closing, err := monthlyCloseStatuses(h.db, userIDs, month)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve closing status")
+	}
+	period, err := closingPeriod(h.db, month)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve closing period")
+	}
+	if export != nil {
+		return h.exportMonthlyReports(c, export, month, users, closing, startOfMonth, endOfMonth)
+	}
+
 	var reports []MonthlyReportData
 	totalWorkingHoursSum := 0.0
-	totalLeavesSum := 0
+	totalLeavesSum := 0.0
 	totalPendingLeavesSum := 0
 	totalAttendanceRateSum := 0.0
 
 	for _, user := range users {
-		reportData := h.generateUserMonthlyReport(user, startOfMonth, endOfMonth)
+		reportData, err := h.generateUserMonthlyReport(user, startOfMonth, endOfMonth)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to generate monthly report")
+		}
+		reportData.Closing = closing[user.ID]
 		reports = append(reports, reportData)
 
 		if hours, err := parseFloat(reportData.TotalWorkingHours); err == nil {
@@ -90,6 +122,7 @@ func (h *AdminHandler) GetMonthlyReports(c echo.Context) error {
 		Reports:        reports,
 		TotalLeaves:    totalLeavesSum,
 		PendingLeaves:  totalPendingLeavesSum,
+		ClosingStatus:  period.Status,
 	}
 
 	if len(users) > 0 {
@@ -103,43 +136,116 @@ func (h *AdminHandler) GetMonthlyReports(c echo.Context) error {
 	return c.JSON(http.StatusOK, summary)
 }
 
-func (h *AdminHandler) generateUserMonthlyReport(user models.User, startOfMonth, endOfMonth time.Time) MonthlyReportData {
+func (h *AdminHandler) generateUserMonthlyReport(user models.User, startOfMonth, endOfMonth time.Time) (MonthlyReportData, error) {
+	rules := newWorkRules(h.db)
+
 	var attendances []models.Attendance
-	h.db.Where("user_id = ? AND date BETWEEN ? AND ?", user.ID, startOfMonth, endOfMonth).Find(&attendances)
+	if err := h.db.Where("user_id = ? AND date BETWEEN ? AND ?", user.ID, startOfMonth, endOfMonth).Find(&attendances).Error; err != nil {
+		return MonthlyReportData{}, err
+	}
+
+	// The days of the first week before the month count towards its weekly
+	// overtime threshold.
+	var earlier []models.Attendance
+	if err := h.db.Where("user_id = ? AND date >= ? AND date < ?", user.ID, weekStart(startOfMonth), startOfMonth).Find(&earlier).Error; err != nil {
+		return MonthlyReportData{}, err
+	}
 
 	var schedules []models.Schedule
-	h.db.Where("user_id = ? AND date BETWEEN ? AND ?", user.ID, startOfMonth, endOfMonth).Find(&schedules)
+	if err := h.db.Where("user_id = ? AND date BETWEEN ? AND ?", user.ID, startOfMonth, endOfMonth).Find(&schedules).Error; err != nil {
+		return MonthlyReportData{}, err
+	}
 
 	var leaves []models.Leave
-	h.db.Where("user_id = ? AND start_date <= ? AND end_date >= ? AND status = ?", 
-		user.ID, endOfMonth, startOfMonth, models.LeaveApproved).Find(&leaves)
+	if err := h.db.Where("user_id = ? AND start_date <= ? AND end_date >= ? AND status IN ?",
+		user.ID, endOfMonth, startOfMonth, models.EffectiveLeaveStatuses).Find(&leaves).Error; err != nil {
+		return MonthlyReportData{}, err
+	}
 
 	var pendingLeaves []models.Leave
-	h.db.Where("user_id = ? AND start_date <= ? AND end_date >= ? AND status = ?", 
-		user.ID, endOfMonth, startOfMonth, models.LeavePending).Find(&pendingLeaves)
+	if err := h.db.Where("user_id = ? AND start_date <= ? AND end_date >= ? AND status = ?",
+		user.ID, endOfMonth, startOfMonth, models.LeavePending).Find(&pendingLeaves).Error; err != nil {
+		return MonthlyReportData{}, err
+	}
 
-	totalWorkingDays := len(schedules)
+	var holidayWorks []models.HolidayWork
+	if err := h.db.Where("user_id = ? AND work_date BETWEEN ? AND ?", user.ID, startOfMonth, endOfMonth).Find(&holidayWorks).Error; err != nil {
+		return MonthlyReportData{}, err
+	}
+
+	// Scheduled days when the month is scheduled, otherwise the business
+	// days of the user's company calendar.
+	workingDays, err := userWorkingDays(h.db, user.ID, startOfMonth, endOfMonth)
+	if err != nil {
+		return MonthlyReportData{}, err
+	}
+	totalWorkingDays := len(workingDays)
 	actualWorkingDays := 0
 	totalWorkingHours := 0.0
 	plannedHours := 0.0
 
+	hoursOn := map[string]float64{}
+	for _, attendance := range earlier {
+		rule, err := rules.at(user.ID, attendance.Date)
+		if err != nil {
+			return MonthlyReportData{}, err
+		}
+		hoursOn[dateKey(attendance.Date)] += attendance.WorkingHours(rule)
+	}
 	for _, attendance := range attendances {
 		if attendance.ClockIn != nil && attendance.ClockOut != nil {
+			rule, err := rules.at(user.ID, attendance.Date)
+			if err != nil {
+				return MonthlyReportData{}, err
+			}
+			hours := attendance.WorkingHours(rule)
 			actualWorkingDays++
-			totalWorkingHours += attendance.WorkingHours()
+			totalWorkingHours += hours
+			hoursOn[dateKey(attendance.Date)] += hours
 		}
 	}
 
-	for _, schedule := range schedules {
-		plannedHours += schedule.PlannedHours()
+	// The plan is the schedules, or without any the rule's standard day on
+	// each business day. Approved leave counts as covered time against it,
+	// so half-day and hourly leave do not show up as a shortfall.
+	leaveHours := 0.0
+	plan := func(day time.Time, planned float64) {
+		plannedHours += planned
+		for i := range leaves {
+			leaveHours += leaves[i].CoveredHours(day, planned)
+		}
+	}
+	if len(schedules) > 0 {
+		for _, schedule := range schedules {
+			rule, err := rules.at(user.ID, schedule.Date)
+			if err != nil {
+				return MonthlyReportData{}, err
+			}
+			plan(schedule.Date, schedule.PlannedHours(rule))
+		}
+	} else {
+		for _, day := range workingDays {
+			rule, err := rules.at(user.ID, day)
+			if err != nil {
+				return MonthlyReportData{}, err
+			}
+			plan(day, rule.StandardDailyHours())
+		}
 	}
 
-	overtime := totalWorkingHours - plannedHours
-	if overtime < 0 {
-		overtime = 0
+	overtime, err := overtimeHours(rules, user.ID, hoursOn, holidayWorks, startOfMonth, endOfMonth)
+	if err != nil {
+		return MonthlyReportData{}, err
+	}
+	holidayWork, err := summarizeHolidayWork(holidayWorks, attendances, leaves, rules, startOfMonth, endOfMonth)
+	if err != nil {
+		return MonthlyReportData{}, err
 	}
 
-	leaveDays := h.calculateLeaveDaysInMonth(leaves, startOfMonth, endOfMonth)
+	paidLeaveDays, unpaidLeaveDays, err := h.calculateLeaveDaysInMonth(user.ID, leaves, startOfMonth, endOfMonth)
+	if err != nil {
+		return MonthlyReportData{}, err
+	}
 
 	attendanceRate := 0.0
 	if totalWorkingDays > 0 {
@@ -153,31 +259,96 @@ func (h *AdminHandler) generateUserMonthlyReport(user models.User, startOfMonth,
 		TotalWorkingHours: fmt.Sprintf("%.2f", totalWorkingHours),
 		PlannedHours:      fmt.Sprintf("%.2f", plannedHours),
 		Overtime:          fmt.Sprintf("%.2f", overtime),
-		LeaveDays:         leaveDays,
+		LeaveDays:         paidLeaveDays + unpaidLeaveDays,
+		PaidLeaveDays:     paidLeaveDays,
+		UnpaidLeaveDays:   unpaidLeaveDays,
+		LeaveHours:        fmt.Sprintf("%.2f", leaveHours),
 		PendingLeaves:     len(pendingLeaves),
 		AttendanceRate:    fmt.Sprintf("%.2f", attendanceRate),
-	}
+		HolidayWork:       holidayWork,
+	}, nil
 }
 
-func (h *AdminHandler) calculateLeaveDaysInMonth(leaves []models.Leave, startOfMonth, endOfMonth time.Time) int {
-	totalDays := 0
-	for _, leave := range leaves {
-		start := leave.StartDate
-		end := leave.EndDate
+// overtimeHours totals the overtime worked from start to end under each
+// day's work rule: hours past the daily threshold, then hours past the
+// weekly threshold among the rest. hoursOn may hold days before start to
+// fill the first week. Work on a statutory holiday is counted separately as
+// holiday work and left out here.
+func overtimeHours(rules *workRules, userID uint, hoursOn map[string]float64, works []models.HolidayWork, start, end time.Time) (float64, error) {
+	statutory := map[string]bool{}
+	for _, w := range works {
+		if w.Kind == models.HolidayWorkStatutory && w.Arrangement != models.HolidayWorkSubstitute {
+			statutory[dateKey(w.WorkDate)] = true
+		}
+	}
 
-		if start.Before(startOfMonth) {
-			start = startOfMonth
+	overtime, week := 0.0, 0.0
+	for d := weekStart(start); !d.After(end); d = d.AddDate(0, 0, 1) {
+		if d.Weekday() == time.Monday {
+			week = 0
 		}
-		if end.After(endOfMonth) {
-			end = endOfMonth
+		key := dateKey(d)
+		hours := hoursOn[key]
+		if hours == 0 || statutory[key] {
+			continue
+		}
+		rule, err := rules.at(userID, d)
+		if err != nil {
+			return 0, err
+		}
+
+		extra := 0.0
+		if daily := float64(rule.DailyOvertimeMinutes) / 60; hours > daily {
+			extra = hours - daily
+			hours = daily
+		}
+		week += hours
+		if weekly := float64(rule.WeeklyOvertimeMinutes) / 60; week > weekly {
+			extra += week - weekly
+			week = weekly
+		}
+		if !d.Before(start) {
+			overtime += extra
+		}
+	}
+	return overtime, nil
+}
+
+// calculateLeaveDaysInMonth charges each leave for the working days it
+// covers inside the month, using the same calendar as leave requests, and
+// splits the days by whether the leave type is paid.
+func (h *AdminHandler) calculateLeaveDaysInMonth(userID uint, leaves []models.Leave, startOfMonth, endOfMonth time.Time) (float64, float64, error) {
+	paidTypes, err := paidLeaveTypes(h.db)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	paid, unpaid := 0.0, 0.0
+	for _, leave := range leaves {
+		days := leave.Days
+		if !leave.IsPartialDay() {
+			start := leave.StartDate
+			end := leave.EndDate
+
+			if start.Before(startOfMonth) {
+				start = startOfMonth
+			}
+			if end.After(endOfMonth) {
+				end = endOfMonth
+			}
+
+			if days, err = chargeableLeaveDays(h.db, userID, start, end); err != nil {
+				return 0, 0, err
+			}
 		}
 
-		if start.Before(end) || start.Equal(end) {
-			days := int(end.Sub(start).Hours()/24) + 1
-			totalDays += days
+		if paidTypes[leave.Type] {
+			paid += days
+		} else {
+			unpaid += days
 		}
 	}
-	return totalDays
+	return paid, unpaid, nil
 }
 
 func parseFloat(s string) (float64, error) {
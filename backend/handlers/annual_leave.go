@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+	"gorm.io/gorm"
+)
+
+// Labor Standards Act art. 39(7): employees granted 10 or more days must take
+// at least 5 of them within one year of the grant.
+const (
+	qualifyingGrantDays       = 10.0
+	annualLeaveObligationDays = 5.0
+)
+
+var errLeaveOverlap = errors.New("leave overlaps with existing leave")
+
+type AnnualLeaveObligation struct {
+	User           models.User `json:"user"`
+	GrantID        uint        `json:"grant_id"`
+	GrantedDays    float64     `json:"granted_days"`
+	PeriodStart    string      `json:"period_start"`
+	PeriodEnd      string      `json:"period_end"`
+	RequiredDays   float64     `json:"required_days"`
+	TakenDays      float64     `json:"taken_days"`
+	ScheduledDays  float64     `json:"scheduled_days"`
+	ExpectedToDate float64     `json:"expected_to_date"`
+	ProjectedDays  float64     `json:"projected_days"`
+	ShortfallDays  float64     `json:"shortfall_days"`
+	DaysRemaining  int         `json:"days_remaining"`
+	BehindPace     bool        `json:"behind_pace"`
+}
+
+type DesignateLeaveRequest struct {
+	UserID uint     `json:"user_id" validate:"required"`
+	Dates  []string `json:"dates" validate:"required"` // YYYY-MM-DD
+	Reason string   `json:"reason"`
+}
+
+// hasOverlappingLeave reports whether leave conflicts with any of the user's
+// other active leaves. Partial-day leaves only conflict when their times overlap.
+func hasOverlappingLeave(db *gorm.DB, leave *models.Leave) (bool, error) {
+	var existing []models.Leave
+	if err := db.Where("user_id = ? AND status NOT IN ? AND start_date <= ? AND end_date >= ? AND id != ?",
+		leave.UserID, models.InactiveLeaveStatuses, leave.EndDate, leave.StartDate, leave.ID).
+		Find(&existing).Error; err != nil {
+		return false, err
+	}
+	for i := range existing {
+		if leave.Conflicts(&existing[i]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// qualifyingGrants returns vacation grants of 10+ days whose one-year
+// obligation period contains asOf.
+func qualifyingGrants(db *gorm.DB, asOf time.Time) ([]models.LeaveBalanceTransaction, error) {
+	var grants []models.LeaveBalanceTransaction
+	err := db.Preload("User").
+		Where("kind = ? AND leave_type = ? AND days >= ? AND effective_date <= ? AND effective_date > ?",
+			models.LeaveTxGrant, models.LeaveTypeVacation, qualifyingGrantDays, asOf, asOf.AddDate(-1, 0, 0)).
+		Order("user_id ASC, effective_date ASC").
+		Find(&grants).Error
+	return grants, err
+}
+
+func evaluateObligation(db *gorm.DB, grant models.LeaveBalanceTransaction, asOf time.Time) (AnnualLeaveObligation, error) {
+	periodStart := grant.EffectiveDate
+	periodEnd := periodStart.AddDate(1, 0, 0)
+
+	var leaves []models.Leave
+	if err := db.Where("user_id = ? AND type = ? AND status IN ? AND start_date >= ? AND start_date < ?",
+		grant.UserID, models.LeaveTypeVacation, models.EffectiveLeaveStatuses, periodStart, periodEnd).
+		Find(&leaves).Error; err != nil {
+		return AnnualLeaveObligation{}, err
+	}
+
+	taken, scheduled := 0.0, 0.0
+	for _, leave := range leaves {
+		if leave.StartDate.After(asOf) {
+			scheduled += leave.Days
+		} else {
+			taken += leave.Days
+		}
+	}
+
+	periodDays := periodEnd.Sub(periodStart).Hours() / 24
+	elapsed := asOf.Sub(periodStart).Hours() / 24
+	if elapsed < 1 {
+		elapsed = 1
+	}
+	remaining := periodDays - elapsed
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	// Extrapolate the pace so far over the rest of the period on top of
+	// what is already booked.
+	projected := taken + scheduled + taken/elapsed*remaining
+	expected := annualLeaveObligationDays * elapsed / periodDays
+
+	shortfall := annualLeaveObligationDays - projected
+	if shortfall < 0 {
+		shortfall = 0
+	}
+
+	booked := taken + scheduled
+	behind := booked < annualLeaveObligationDays && (booked < expected || shortfall > 0)
+
+	return AnnualLeaveObligation{
+		User:           grant.User,
+		GrantID:        grant.ID,
+		GrantedDays:    grant.Days,
+		PeriodStart:    periodStart.Format("2006-01-02"),
+		PeriodEnd:      periodEnd.AddDate(0, 0, -1).Format("2006-01-02"),
+		RequiredDays:   annualLeaveObligationDays,
+		TakenDays:      taken,
+		ScheduledDays:  scheduled,
+		ExpectedToDate: roundTo(expected, 2),
+		ProjectedDays:  roundTo(projected, 2),
+		ShortfallDays:  roundTo(shortfall, 2),
+		DaysRemaining:  int(remaining),
+		BehindPace:     behind,
+	}, nil
+}
+
+func roundTo(v float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(v*scale) / scale
+}
+
+// GetAnnualLeaveObligations reports progress on the five-day obligation for
+// every active qualifying grant. Only employees behind pace are listed unless
+// all=true.
+func (h *AdminHandler) GetAnnualLeaveObligations(c echo.Context) error {
+	asOf := time.Now()
+	if v := c.QueryParam("as_of"); v != "" {
+		parsed, err := parseLocalDate(v)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid as_of format. Expected YYYY-MM-DD")
+		}
+		asOf = parsed
+	}
+	includeAll := c.QueryParam("all") == "true"
+
+	scope, err := scopeFor(c, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+
+	grants, err := qualifyingGrants(scope.apply(h.db, "user_id"), asOf)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve leave grants")
+	}
+
+	reports := []AnnualLeaveObligation{}
+	for _, grant := range grants {
+		report, err := evaluateObligation(h.db, grant, asOf)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to evaluate leave obligation")
+		}
+		if includeAll || report.BehindPace {
+			reports = append(reports, report)
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"as_of": asOf.Format("2006-01-02"),
+		"data":  reports,
+	})
+}
+
+// DesignateLeave creates approved vacation days on behalf of an employee
+// (時季指定) and records who designated them.
+func (h *LeaveHandler) DesignateLeave(c echo.Context) error {
+	actorID := c.Get("user_id").(uint)
+
+	var req DesignateLeaveRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.UserID == 0 || len(req.Dates) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "user_id and dates are required")
+	}
+
+	scope, err := scopeFor(c, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+	if !scope.contains(req.UserID) || req.UserID == actorID && c.Get("user_role") != "admin" {
+		return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+	}
+
+	today := truncateDate(time.Now())
+	dates := make([]time.Time, 0, len(req.Dates))
+	for _, d := range req.Dates {
+		date, err := parseLocalDate(d)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid date format. Expected YYYY-MM-DD")
+		}
+		if date.Before(today) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Cannot designate leave in the past")
+		}
+		working, err := isWorkingDay(h.db, req.UserID, date)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve working days")
+		}
+		if !working {
+			return echo.NewHTTPError(http.StatusBadRequest, d+" is not a working day")
+		}
+		if err := requireOpenPeriod(h.db, date, date); err != nil {
+			return err
+		}
+		dates = append(dates, date)
+	}
+
+	now := time.Now()
+	var designations []models.LeaveDesignation
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		for _, date := range dates {
+			leave := models.Leave{
+				UserID:     req.UserID,
+				Type:       models.LeaveTypeVacation,
+				StartDate:  date,
+				EndDate:    date,
+				Unit:       models.LeaveUnitFull,
+				Days:       1,
+				Reason:     req.Reason,
+				Status:     models.LeaveApproved,
+				ApprovedBy: &actorID,
+				ApprovedAt: &now,
+			}
+			overlap, err := hasOverlappingLeave(tx, &leave)
+			if err != nil {
+				return err
+			}
+			if overlap {
+				return fmt.Errorf("%s: %w", date.Format("2006-01-02"), errLeaveOverlap)
+			}
+
+			if err := tx.Create(&leave).Error; err != nil {
+				return err
+			}
+			usesBalance, err := drawsFromBalance(tx, leave.Type)
+			if err != nil {
+				return err
+			}
+			if usesBalance {
+				if err := debitLeaveBalance(tx, &leave, actorID); err != nil {
+					return err
+				}
+			}
+
+			designation := models.LeaveDesignation{
+				LeaveID:      leave.ID,
+				UserID:       req.UserID,
+				DesignatedBy: actorID,
+				Reason:       req.Reason,
+			}
+			grants, err := qualifyingGrants(tx.Where("user_id = ?", req.UserID), date)
+			if err != nil {
+				return err
+			}
+			if len(grants) > 0 {
+				designation.GrantID = &grants[0].ID
+			}
+			if err := tx.Create(&designation).Error; err != nil {
+				return err
+			}
+			designation.Leave = leave
+			designations = append(designations, designation)
+		}
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, "User not found")
+		case errors.Is(err, errLeaveOverlap):
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		case errors.Is(err, errInsufficientLeaveBalance):
+			return echo.NewHTTPError(http.StatusConflict, "Insufficient leave balance")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to designate leave")
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"data": designations,
+	})
+}
+
+// GetLeaveDesignations lists the designation audit trail, optionally for one user.
+func (h *LeaveHandler) GetLeaveDesignations(c echo.Context) error {
+	scope, err := scopeFor(c, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+
+	query := scope.apply(h.db, "user_id").Preload("Leave").Preload("User").Preload("Designer").Order("created_at DESC")
+	if userID := c.QueryParam("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var designations []models.LeaveDesignation
+	if err := query.Find(&designations).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve leave designations")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": designations,
+	})
+}
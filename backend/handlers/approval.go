@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+	"gorm.io/gorm"
+)
+
+var errNotApprover = errors.New("user cannot act on this approval step")
+
+type ApprovalHandler struct {
+	db *gorm.DB
+}
+
+func NewApprovalHandler(db *gorm.DB) *ApprovalHandler {
+	return &ApprovalHandler{db: db}
+}
+
+type ApprovalRouteRequest struct {
+	Name        string                     `json:"name" validate:"required"`
+	RequestType string                     `json:"request_type"`
+	Priority    int                        `json:"priority"`
+	MinDays     *float64                   `json:"min_days"`
+	MaxDays     *float64                   `json:"max_days"`
+	LeaveTypes  string                     `json:"leave_types"`
+	Active      *bool                      `json:"active"`
+	Steps       []models.ApprovalRouteStep `json:"steps" validate:"required"`
+}
+
+// defaultApprovalSteps is used when no route matches: a single approval by
+// any manager, which was the behaviour before routes existed.
+func defaultApprovalSteps() []models.ApprovalRouteStep {
+	return []models.ApprovalRouteStep{{
+		StepOrder:    1,
+		Name:         "Manager approval",
+		ApproverKind: models.ApproverRole,
+		ApproverRole: "manager",
+	}}
+}
+
+func matchApprovalRoute(db *gorm.DB, leave *models.Leave) (*models.ApprovalRoute, error) {
+	var routes []models.ApprovalRoute
+	if err := db.Preload("Steps", func(db *gorm.DB) *gorm.DB {
+		return db.Order("step_order ASC")
+	}).Where("request_type = ? AND active = ?", models.ApprovalRequestLeave, true).
+		Order("priority ASC, id ASC").Find(&routes).Error; err != nil {
+		return nil, err
+	}
+	for i := range routes {
+		if len(routes[i].Steps) > 0 && routes[i].Matches(leave) {
+			return &routes[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// createApprovalSteps instantiates the matching route's steps for leave.
+func createApprovalSteps(tx *gorm.DB, leave *models.Leave) ([]models.ApprovalStep, error) {
+	route, err := matchApprovalRoute(tx, leave)
+	if err != nil {
+		return nil, err
+	}
+	definitions := defaultApprovalSteps()
+	if route != nil {
+		definitions = route.Steps
+	}
+
+	var requester models.User
+	if err := tx.First(&requester, leave.UserID).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	steps := make([]models.ApprovalStep, 0, len(definitions))
+	for i, def := range definitions {
+		approverID := def.ApproverUserID
+		switch def.ApproverKind {
+		case models.ApproverLineManager:
+			if approverID, err = lineManagerOf(tx, &requester); err != nil {
+				return nil, err
+			}
+		case models.ApproverDepartmentHead:
+			if approverID, err = departmentHeadOf(tx, &requester); err != nil {
+				return nil, err
+			}
+		}
+		steps = append(steps, models.ApprovalStep{
+			RequestType:    models.ApprovalRequestLeave,
+			RequestID:      leave.ID,
+			StepOrder:      i + 1,
+			Name:           def.Name,
+			ApproverKind:   def.ApproverKind,
+			ApproverRole:   def.ApproverRole,
+			ApproverUserID: approverID,
+			Decision:       models.ApprovalPending,
+		})
+	}
+	steps[0].ActivatedAt = &now
+	if err := tx.Create(&steps).Error; err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+// currentApprovalStep returns the first undecided step of leave, creating
+// the chain for requests filed before approval routes existed.
+func currentApprovalStep(tx *gorm.DB, leave *models.Leave) (*models.ApprovalStep, bool, error) {
+	var steps []models.ApprovalStep
+	if err := tx.Where("request_type = ? AND request_id = ?", models.ApprovalRequestLeave, leave.ID).
+		Order("step_order ASC").Find(&steps).Error; err != nil {
+		return nil, false, err
+	}
+	if len(steps) == 0 {
+		created, err := createApprovalSteps(tx, leave)
+		if err != nil {
+			return nil, false, err
+		}
+		steps = created
+	}
+	for i := range steps {
+		if steps[i].Decision == models.ApprovalPending {
+			return &steps[i], i == len(steps)-1, nil
+		}
+	}
+	return nil, false, errLeaveAlreadyProcessed
+}
+
+// canActOnStep reports whether the actor may decide the step. Admins may
+// decide any step. Managers acting through a role, or on a hierarchy step
+// that could not be resolved to a person, need the requester in their
+// subtree (inScope).
+func canActOnStep(step *models.ApprovalStep, actorID uint, actorRole string, inScope bool) bool {
+	if actorRole == "admin" {
+		return true
+	}
+	switch step.ApproverKind {
+	case models.ApproverUser:
+		return step.ApproverUserID != nil && *step.ApproverUserID == actorID
+	case models.ApproverRole:
+		return step.ApproverRole == actorRole && (actorRole != "manager" || inScope)
+	case models.ApproverLineManager, models.ApproverDepartmentHead:
+		if step.ApproverUserID != nil {
+			return *step.ApproverUserID == actorID
+		}
+		return actorRole == "manager" && inScope
+	}
+	return false
+}
+
+// GetLeaveApprovals returns the approval chain of a leave request.
+func (h *LeaveHandler) GetLeaveApprovals(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+	userRole := c.Get("user_role").(string)
+
+	leaveID, err := strconv.ParseUint(c.Param("leaveId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid leave ID")
+	}
+
+	var leave models.Leave
+	if err := h.db.First(&leave, leaveID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Leave request not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve leave request")
+	}
+	scope, err := resolveUserScope(h.db, userID, userRole)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+	if !scope.contains(leave.UserID) {
+		return echo.NewHTTPError(http.StatusNotFound, "Leave request not found")
+	}
+
+	var steps []models.ApprovalStep
+	if err := h.db.Preload("Decider").Preload("Principal").
+		Where("request_type = ? AND request_id = ?", models.ApprovalRequestLeave, leave.ID).
+		Order("step_order ASC").Find(&steps).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve approval steps")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": steps,
+	})
+}
+
+type ApprovalQueueItem struct {
+	models.Leave
+	OnBehalfOf *uint `json:"on_behalf_of,omitempty"`
+}
+
+// GetApprovalQueue lists pending leaves whose current step the caller may
+// decide, including those of managers who delegated to the caller.
+func (h *LeaveHandler) GetApprovalQueue(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+	userRole := c.Get("user_role").(string)
+
+	var leaves []models.Leave
+	if err := h.db.Preload("User").Preload("ApprovalSteps", func(db *gorm.DB) *gorm.DB {
+		return db.Order("step_order ASC")
+	}).Where("status = ?", models.LeavePending).Order("created_at ASC").Find(&leaves).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve leave requests")
+	}
+
+	principals, err := approvalPrincipals(h.db, userID, userRole)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+
+	queue := []ApprovalQueueItem{}
+	for _, leave := range leaves {
+		if leave.UserID == userID && userRole != "admin" {
+			continue
+		}
+		step := firstPendingStep(leave.ApprovalSteps)
+		if step == nil {
+			// Requests filed before routes existed get the default chain.
+			step = &models.ApprovalStep{ApproverKind: models.ApproverRole, ApproverRole: "manager"}
+		}
+		if p := principalForStep(principals, step, leave.UserID); p != nil {
+			item := ApprovalQueueItem{Leave: leave}
+			if p.userID != userID {
+				item.OnBehalfOf = &p.userID
+			}
+			queue = append(queue, item)
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": queue,
+	})
+}
+
+func firstPendingStep(steps []models.ApprovalStep) *models.ApprovalStep {
+	for i := range steps {
+		if steps[i].Decision == models.ApprovalPending {
+			return &steps[i]
+		}
+	}
+	return nil
+}
+
+func (h *ApprovalHandler) GetRoutes(c echo.Context) error {
+	query := h.db.Preload("Steps", func(db *gorm.DB) *gorm.DB {
+		return db.Order("step_order ASC")
+	}).Order("request_type ASC, priority ASC, id ASC")
+	if requestType := c.QueryParam("request_type"); requestType != "" {
+		query = query.Where("request_type = ?", requestType)
+	}
+
+	var routes []models.ApprovalRoute
+	if err := query.Find(&routes).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve approval routes")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": routes,
+	})
+}
+
+func (h *ApprovalHandler) CreateRoute(c echo.Context) error {
+	var req ApprovalRouteRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	route := models.ApprovalRoute{Active: true}
+	if err := applyApprovalRoute(&route, &req); err != nil {
+		return err
+	}
+
+	if err := h.db.Create(&route).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create approval route")
+	}
+
+	return c.JSON(http.StatusCreated, route)
+}
+
+// UpdateRoute replaces a route's conditions and steps. Requests already in
+// flight keep the steps they were created with.
+func (h *ApprovalHandler) UpdateRoute(c echo.Context) error {
+	routeID, err := strconv.ParseUint(c.Param("routeId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid route ID")
+	}
+
+	var req ApprovalRouteRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	var route models.ApprovalRoute
+	if err := h.db.First(&route, routeID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Approval route not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve approval route")
+	}
+
+	if err := applyApprovalRoute(&route, &req); err != nil {
+		return err
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("route_id = ?", route.ID).Delete(&models.ApprovalRouteStep{}).Error; err != nil {
+			return err
+		}
+		return tx.Session(&gorm.Session{FullSaveAssociations: true}).Save(&route).Error
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update approval route")
+	}
+
+	return c.JSON(http.StatusOK, route)
+}
+
+func (h *ApprovalHandler) DeleteRoute(c echo.Context) error {
+	routeID, err := strconv.ParseUint(c.Param("routeId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid route ID")
+	}
+
+	result := h.db.Delete(&models.ApprovalRoute{}, routeID)
+	if result.Error != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete approval route")
+	}
+	if result.RowsAffected == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "Approval route not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func applyApprovalRoute(route *models.ApprovalRoute, req *ApprovalRouteRequest) error {
+	if req.Name == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Name is required")
+	}
+	if len(req.Steps) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "At least one step is required")
+	}
+	if req.MinDays != nil && req.MaxDays != nil && *req.MinDays > *req.MaxDays {
+		return echo.NewHTTPError(http.StatusBadRequest, "min_days must not exceed max_days")
+	}
+
+	steps := make([]models.ApprovalRouteStep, 0, len(req.Steps))
+	for i, step := range req.Steps {
+		switch step.ApproverKind {
+		case models.ApproverLineManager, models.ApproverDepartmentHead:
+		case models.ApproverRole:
+			if step.ApproverRole == "" {
+				return echo.NewHTTPError(http.StatusBadRequest, "approver_role is required for role steps")
+			}
+		case models.ApproverUser:
+			if step.ApproverUserID == nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "approver_user_id is required for user steps")
+			}
+		default:
+			return echo.NewHTTPError(http.StatusBadRequest, "approver_kind must be line_manager, department_head, role or user")
+		}
+		steps = append(steps, models.ApprovalRouteStep{
+			StepOrder:      i + 1,
+			Name:           step.Name,
+			ApproverKind:   step.ApproverKind,
+			ApproverRole:   step.ApproverRole,
+			ApproverUserID: step.ApproverUserID,
+		})
+	}
+
+	route.Name = req.Name
+	route.RequestType = req.RequestType
+	if route.RequestType == "" {
+		route.RequestType = models.ApprovalRequestLeave
+	}
+	route.Priority = req.Priority
+	if route.Priority == 0 {
+		route.Priority = 100
+	}
+	route.MinDays = req.MinDays
+	route.MaxDays = req.MaxDays
+	route.LeaveTypes = req.LeaveTypes
+	if req.Active != nil {
+		route.Active = *req.Active
+	}
+	route.Steps = steps
+	return nil
+}
@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+	"github.com/yudai-uk/backend/storage"
+	"gorm.io/gorm"
+)
+
+var errAttachmentRequired = errors.New("leave type requires a supporting document")
+
+// allowedAttachmentTypes are the sniffed content types accepted for upload.
+var allowedAttachmentTypes = map[string]bool{
+	"application/pdf": true,
+	"image/jpeg":      true,
+	"image/png":       true,
+}
+
+type AttachmentHandler struct {
+	db      *gorm.DB
+	store   storage.Storage
+	scanner storage.Scanner
+}
+
+func NewAttachmentHandler(db *gorm.DB, store storage.Storage, scanner storage.Scanner) *AttachmentHandler {
+	return &AttachmentHandler{db: db, store: store, scanner: scanner}
+}
+
+// attachmentMaxBytes is the largest file accepted for upload.
+func attachmentMaxBytes() int64 {
+	return int64(envInt("ATTACHMENT_MAX_BYTES", 10<<20))
+}
+
+// canViewLeave reports whether the caller may see a leave and its documents:
+// the requester, anyone whose scope covers them, and anyone who is or was an
+// approver on it.
+func canViewLeave(db *gorm.DB, actorID uint, actorRole string, leave *models.Leave) (bool, error) {
+	if leave.UserID == actorID {
+		return true, nil
+	}
+	scope, err := resolveUserScope(db, actorID, actorRole)
+	if err != nil {
+		return false, err
+	}
+	if scope.contains(leave.UserID) {
+		return true, nil
+	}
+
+	var steps []models.ApprovalStep
+	if err := db.Where("request_type = ? AND request_id = ?", models.ApprovalRequestLeave, leave.ID).
+		Order("step_order ASC").Find(&steps).Error; err != nil {
+		return false, err
+	}
+	for _, step := range steps {
+		if step.ApproverUserID != nil && *step.ApproverUserID == actorID ||
+			step.DecidedBy != nil && *step.DecidedBy == actorID {
+			return true, nil
+		}
+	}
+	if step := firstPendingStep(steps); step != nil && leave.Status == models.LeavePending {
+		principals, err := approvalPrincipals(db, actorID, actorRole)
+		if err != nil {
+			return false, err
+		}
+		return principalForStep(principals, step, leave.UserID) != nil, nil
+	}
+	return false, nil
+}
+
+// checkRequiredAttachment fails when the leave's type demands a supporting
+// document and none has been uploaded.
+func checkRequiredAttachment(tx *gorm.DB, leave *models.Leave) error {
+	def, err := loadLeaveType(tx, leave.Type)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !def.RequiresAttachment {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&models.Attachment{}).
+		Where("owner_type = ? AND owner_id = ?", models.AttachmentOwnerLeave, leave.ID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errAttachmentRequired
+	}
+	return nil
+}
+
+// loadOwner resolves the record an attachment belongs to and checks that the
+// caller may see it. Only leave requests accept attachments today.
+func (h *AttachmentHandler) loadOwner(c echo.Context, ownerType models.AttachmentOwnerType, ownerID uint) (*models.Leave, error) {
+	if ownerType != models.AttachmentOwnerLeave {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "Attachment not found")
+	}
+
+	var leave models.Leave
+	if err := h.db.First(&leave, ownerID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, echo.NewHTTPError(http.StatusNotFound, "Leave request not found")
+		}
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve leave request")
+	}
+	ok, err := canViewLeave(h.db, c.Get("user_id").(uint), c.Get("user_role").(string), &leave)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "Leave request not found")
+	}
+	return &leave, nil
+}
+
+func (h *AttachmentHandler) GetLeaveAttachments(c echo.Context) error {
+	leaveID, err := strconv.ParseUint(c.Param("leaveId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid leave ID")
+	}
+	if _, err := h.loadOwner(c, models.AttachmentOwnerLeave, uint(leaveID)); err != nil {
+		return err
+	}
+
+	var attachments []models.Attachment
+	if err := h.db.Preload("Uploader").
+		Where("owner_type = ? AND owner_id = ?", models.AttachmentOwnerLeave, leaveID).
+		Order("created_at ASC").Find(&attachments).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve attachments")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": attachments,
+	})
+}
+
+// UploadLeaveAttachment stores a supporting document for a leave request.
+// The file is sent as multipart form field "file".
+func (h *AttachmentHandler) UploadLeaveAttachment(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+
+	leaveID, err := strconv.ParseUint(c.Param("leaveId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid leave ID")
+	}
+	leave, err := h.loadOwner(c, models.AttachmentOwnerLeave, uint(leaveID))
+	if err != nil {
+		return err
+	}
+	if leave.Status == models.LeaveRejected || leave.Status == models.LeaveCancelled {
+		return echo.NewHTTPError(http.StatusBadRequest, "Cannot attach documents to a closed leave request")
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "file is required")
+	}
+	maxBytes := attachmentMaxBytes()
+	if fileHeader.Size > maxBytes {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("File exceeds %d bytes", maxBytes))
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Failed to read file")
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Failed to read file")
+	}
+	if int64(len(data)) > maxBytes {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("File exceeds %d bytes", maxBytes))
+	}
+	if len(data) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "File is empty")
+	}
+
+	// Trust the bytes, not the client's declared type.
+	contentType := http.DetectContentType(data)
+	if !allowedAttachmentTypes[contentType] {
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, "Only PDF, JPEG and PNG files are accepted")
+	}
+
+	fileName := sanitizeFileName(fileHeader.Filename)
+	ctx := c.Request().Context()
+
+	scanStatus := models.AttachmentScanClean
+	if _, ok := h.scanner.(storage.NoopScanner); ok {
+		scanStatus = models.AttachmentScanSkipped
+	}
+	if err := h.scanner.Scan(ctx, fileName, data); err != nil {
+		if errors.Is(err, storage.ErrInfected) {
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, "File was rejected by the malware scan")
+		}
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Failed to scan file")
+	}
+
+	key, err := newStorageKey(models.AttachmentOwnerLeave, leave.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to store file")
+	}
+	if err := h.store.Put(ctx, key, data, contentType); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to store file")
+	}
+
+	sum := sha256.Sum256(data)
+	attachment := models.Attachment{
+		OwnerType:   models.AttachmentOwnerLeave,
+		OwnerID:     leave.ID,
+		FileName:    fileName,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Checksum:    hex.EncodeToString(sum[:]),
+		StorageKey:  key,
+		ScanStatus:  scanStatus,
+		UploadedBy:  userID,
+	}
+	if err := h.db.Create(&attachment).Error; err != nil {
+		_ = h.store.Delete(ctx, key)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to save attachment")
+	}
+
+	return c.JSON(http.StatusCreated, attachment)
+}
+
+func (h *AttachmentHandler) loadAttachment(c echo.Context) (*models.Attachment, *models.Leave, error) {
+	attachmentID, err := strconv.ParseUint(c.Param("attachmentId"), 10, 32)
+	if err != nil {
+		return nil, nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid attachment ID")
+	}
+
+	var attachment models.Attachment
+	if err := h.db.First(&attachment, attachmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, echo.NewHTTPError(http.StatusNotFound, "Attachment not found")
+		}
+		return nil, nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve attachment")
+	}
+	leave, err := h.loadOwner(c, attachment.OwnerType, attachment.OwnerID)
+	if err != nil {
+		var httpErr *echo.HTTPError
+		switch {
+		case errors.As(err, &httpErr) && httpErr.Code == http.StatusNotFound:
+			return nil, nil, echo.NewHTTPError(http.StatusNotFound, "Attachment not found")
+		case errors.As(err, &httpErr):
+			return nil, nil, httpErr
+		default:
+			return nil, nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve attachment")
+		}
+	}
+	return &attachment, leave, nil
+}
+
+// DownloadAttachment streams the file to anyone allowed to see its owner.
+func (h *AttachmentHandler) DownloadAttachment(c echo.Context) error {
+	attachment, _, err := h.loadAttachment(c)
+	if err != nil {
+		return err
+	}
+
+	body, err := h.store.Get(c.Request().Context(), attachment.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Attachment file is missing")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve attachment")
+	}
+	defer body.Close()
+
+	header := c.Response().Header()
+	header.Set("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(attachment.FileName)))
+	header.Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Cache-Control", "private, no-store")
+	return c.Stream(http.StatusOK, attachment.ContentType, body)
+}
+
+// DeleteAttachment lets the uploader (or an admin) remove a document while
+// the leave is still pending.
+func (h *AttachmentHandler) DeleteAttachment(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+	userRole := c.Get("user_role").(string)
+
+	attachment, leave, err := h.loadAttachment(c)
+	if err != nil {
+		return err
+	}
+	if attachment.UploadedBy != userID && userRole != "admin" {
+		return echo.NewHTTPError(http.StatusForbidden, "Only the uploader can remove this attachment")
+	}
+	if leave.Status != models.LeavePending {
+		return echo.NewHTTPError(http.StatusBadRequest, "Attachments can only be removed while the leave is pending")
+	}
+
+	if err := h.db.Delete(attachment).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete attachment")
+	}
+	if err := h.store.Delete(c.Request().Context(), attachment.StorageKey); err != nil {
+		c.Logger().Warnf("failed to delete attachment file %s: %v", attachment.StorageKey, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// newStorageKey builds an unguessable key; the client's file name never
+// becomes part of the storage path.
+func newStorageKey(ownerType models.AttachmentOwnerType, ownerID uint) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("attachments/%s/%d/%s", ownerType, ownerID, hex.EncodeToString(buf)), nil
+}
+
+func sanitizeFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == "/" {
+		name = "attachment"
+	}
+	if runes := []rune(name); len(runes) > 200 {
+		name = string(runes[len(runes)-200:])
+	}
+	return name
+}
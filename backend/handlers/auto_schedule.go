@@ -0,0 +1,752 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errDraftNotOpen = errors.New("schedule draft is no longer open")
+
+type AutoScheduleHandler struct {
+	db *gorm.DB
+}
+
+func NewAutoScheduleHandler(db *gorm.DB) *AutoScheduleHandler {
+	return &AutoScheduleHandler{db: db}
+}
+
+type StaffingRequirementRequest struct {
+	DepartmentID    uint   `json:"department_id" validate:"required"`
+	ShiftTemplateID uint   `json:"shift_template_id" validate:"required"`
+	Weekday         *int   `json:"weekday"` // 0 = Sunday; omit with date for every day
+	Date            string `json:"date"`    // YYYY-MM-DD, replaces weekly rules on that day
+	Required        int    `json:"required"`
+}
+
+type CreateScheduleDraftRequest struct {
+	DepartmentID uint   `json:"department_id" validate:"required"`
+	StartDate    string `json:"start_date" validate:"required"` // YYYY-MM-DD
+	EndDate      string `json:"end_date" validate:"required"`   // YYYY-MM-DD
+}
+
+type AcceptScheduleDraftRequest struct {
+	SkipConflicts bool `json:"skip_conflicts"` // skip shifts that now conflict instead of failing
+}
+
+// requireDepartment checks the caller may plan for departmentID.
+func (h *AutoScheduleHandler) requireDepartment(c echo.Context, departmentID uint) error {
+	allowed, err := canManageDepartment(h.db, c.Get("user_id").(uint), c.Get("user_role").(string), departmentID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+	if !allowed {
+		return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+	}
+	return nil
+}
+
+// manageableDepartments restricts query to the departments the caller may
+// plan for.
+func (h *AutoScheduleHandler) manageableDepartments(c echo.Context, query *gorm.DB) (*gorm.DB, error) {
+	if c.Get("user_role").(string) == "admin" {
+		return query, nil
+	}
+	managed, err := managedDepartmentIDs(h.db, c.Get("user_id").(uint))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+	if len(managed) == 0 {
+		return query.Where("1 = 0"), nil
+	}
+	return query.Where("department_id IN ?", managed), nil
+}
+
+func (h *AutoScheduleHandler) GetStaffingRequirements(c echo.Context) error {
+	query, err := h.manageableDepartments(c, h.db.Preload("ShiftTemplate"))
+	if err != nil {
+		return err
+	}
+	if departmentID := c.QueryParam("department_id"); departmentID != "" {
+		query = query.Where("department_id = ?", departmentID)
+	}
+
+	var requirements []models.StaffingRequirement
+	if err := query.Order("department_id ASC, id ASC").Find(&requirements).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve staffing requirements")
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": requirements,
+	})
+}
+
+func (h *AutoScheduleHandler) CreateStaffingRequirement(c echo.Context) error {
+	var req StaffingRequirementRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	var requirement models.StaffingRequirement
+	if err := h.applyStaffingRequirement(c, &requirement, &req); err != nil {
+		return err
+	}
+	if err := h.db.Create(&requirement).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create staffing requirement")
+	}
+
+	h.db.Preload("ShiftTemplate").First(&requirement, requirement.ID)
+	return c.JSON(http.StatusCreated, requirement)
+}
+
+func (h *AutoScheduleHandler) UpdateStaffingRequirement(c echo.Context) error {
+	requirementID, err := strconv.ParseUint(c.Param("requirementId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid requirement ID")
+	}
+	var req StaffingRequirementRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	var requirement models.StaffingRequirement
+	if err := h.db.First(&requirement, requirementID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Staffing requirement not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve staffing requirement")
+	}
+	if err := h.requireDepartment(c, requirement.DepartmentID); err != nil {
+		return err
+	}
+	if err := h.applyStaffingRequirement(c, &requirement, &req); err != nil {
+		return err
+	}
+	if err := h.db.Save(&requirement).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update staffing requirement")
+	}
+
+	h.db.Preload("ShiftTemplate").First(&requirement, requirement.ID)
+	return c.JSON(http.StatusOK, requirement)
+}
+
+func (h *AutoScheduleHandler) DeleteStaffingRequirement(c echo.Context) error {
+	requirementID, err := strconv.ParseUint(c.Param("requirementId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid requirement ID")
+	}
+
+	var requirement models.StaffingRequirement
+	if err := h.db.First(&requirement, requirementID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Staffing requirement not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve staffing requirement")
+	}
+	if err := h.requireDepartment(c, requirement.DepartmentID); err != nil {
+		return err
+	}
+	if err := h.db.Delete(&requirement).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete staffing requirement")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *AutoScheduleHandler) applyStaffingRequirement(c echo.Context, requirement *models.StaffingRequirement, req *StaffingRequirementRequest) error {
+	if err := h.requireDepartment(c, req.DepartmentID); err != nil {
+		return err
+	}
+	if req.Required < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "required must not be negative")
+	}
+	if req.Weekday != nil && (*req.Weekday < 0 || *req.Weekday > 6) {
+		return echo.NewHTTPError(http.StatusBadRequest, "weekday must be between 0 (Sunday) and 6 (Saturday)")
+	}
+	if req.Weekday != nil && req.Date != "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Specify weekday or date, not both")
+	}
+
+	var count int64
+	h.db.Model(&models.ShiftTemplate{}).Where("id = ?", req.ShiftTemplateID).Count(&count)
+	if count == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Shift template not found")
+	}
+
+	requirement.Date = nil
+	if req.Date != "" {
+		day, err := parseLocalDate(req.Date)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid date format. Expected YYYY-MM-DD")
+		}
+		requirement.Date = &day
+	}
+	requirement.DepartmentID = req.DepartmentID
+	requirement.ShiftTemplateID = req.ShiftTemplateID
+	requirement.Weekday = req.Weekday
+	requirement.Required = req.Required
+	return nil
+}
+
+// staffingSlots resolves the requirements for each day of [start, end]. Per
+// template the most specific rule wins: a dated rule, then a weekday rule,
+// then an every-day rule. Weekly rules only apply on the working days of
+// the department's calendar.
+func staffingSlots(db *gorm.DB, departmentID uint, start, end time.Time) ([]*staffingSlot, error) {
+	var requirements []models.StaffingRequirement
+	if err := db.Preload("ShiftTemplate").
+		Where("department_id = ? AND (date IS NULL OR (date >= ? AND date < ?))", departmentID, start, end.AddDate(0, 0, 1)).
+		Find(&requirements).Error; err != nil {
+		return nil, err
+	}
+
+	calendar, err := departmentCalendar(db, departmentID)
+	if err != nil {
+		return nil, err
+	}
+	days, err := loadCalendarDays(db, calendar, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var slots []*staffingSlot
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		key := dateKey(day)
+		status, _ := days.status(day)
+		chosen := map[uint]*models.StaffingRequirement{}
+		rank := map[uint]int{}
+		for i := range requirements {
+			r := &requirements[i]
+			if r.ShiftTemplate.ID == 0 {
+				continue // template deleted
+			}
+			var rk int
+			switch {
+			case r.Date != nil:
+				if dateKey(r.Date.In(time.Local)) != key {
+					continue
+				}
+				rk = 3
+			case status != dayWorking || !r.Applies(day):
+				continue
+			case r.Weekday != nil:
+				rk = 2
+			default:
+				rk = 1
+			}
+			if rk > rank[r.ShiftTemplateID] {
+				chosen[r.ShiftTemplateID] = r
+				rank[r.ShiftTemplateID] = rk
+			}
+		}
+
+		var daySlots []*staffingSlot
+		for _, r := range chosen {
+			if r.Required <= 0 {
+				continue
+			}
+			template := r.ShiftTemplate
+			breakTime := template.BreakTime
+			startTime, endTime, breakMinutes, err := buildShift(day, template.StartTime, template.EndTime, &breakTime)
+			if err != nil {
+				return nil, err
+			}
+			daySlots = append(daySlots, &staffingSlot{
+				day:          day,
+				template:     &template,
+				required:     r.Required,
+				start:        startTime,
+				end:          endTime,
+				breakMinutes: breakMinutes,
+				hours:        endTime.Sub(startTime).Hours() - float64(breakMinutes)/60,
+			})
+		}
+		sort.Slice(daySlots, func(i, j int) bool {
+			if !daySlots[i].start.Equal(daySlots[j].start) {
+				return daySlots[i].start.Before(daySlots[j].start)
+			}
+			return daySlots[i].template.ID < daySlots[j].template.ID
+		})
+		slots = append(slots, daySlots...)
+	}
+	return slots, nil
+}
+
+// buildScheduleDraft runs the auto-scheduler for a department. Existing
+// schedules stay as they are and count towards coverage; each member's
+// calendar, approved leave, availability, the weekly hour cap and the
+// minimum rest are respected.
+func buildScheduleDraft(db *gorm.DB, departmentID uint, start, end time.Time) (*models.ScheduleDraft, error) {
+	var members []uint
+	if err := db.Model(&models.User{}).Where("department_id = ?", departmentID).
+		Order("id ASC").Pluck("id", &members).Error; err != nil {
+		return nil, err
+	}
+
+	solver := newAutoScheduler(members, start, end)
+	slots, err := staffingSlots(db, departmentID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	solver.slots = slots
+
+	if len(members) > 0 {
+		// A week either side catches rest intervals and weekly hours that
+		// cross the range boundary; it always reaches back past the start of
+		// the first week.
+		var existing []models.Schedule
+		if err := db.Where("user_id IN ? AND date >= ? AND date < ?", members, start.AddDate(0, 0, -7), end.AddDate(0, 0, 8)).
+			Order("start_time ASC, id ASC").Find(&existing).Error; err != nil {
+			return nil, err
+		}
+		rules := newWorkRules(db)
+		for i := range existing {
+			rule, err := rules.at(existing[i].UserID, existing[i].Date)
+			if err != nil {
+				return nil, err
+			}
+			solver.addFixed(&existing[i], existing[i].PlannedHours(rule))
+		}
+
+		var leaves []models.Leave
+		if err := db.Where("user_id IN ? AND status IN ? AND start_date <= ? AND end_date >= ?",
+			members, models.EffectiveLeaveStatuses, end.AddDate(0, 0, 1), start).Find(&leaves).Error; err != nil {
+			return nil, err
+		}
+		for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+			for i := range leaves {
+				if !leaves[i].IsPartialDay() && leaves[i].CoveredHours(day, 1) > 0 {
+					markDay(solver.leave, leaves[i].UserID, day)
+				}
+			}
+		}
+
+		// Days off on a member's own calendar, such as a location closure,
+		// are not offered to them.
+		for _, id := range members {
+			calendar, err := loadBusinessCalendar(db, id, start, end)
+			if err != nil {
+				return nil, err
+			}
+			for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+				if status, _ := calendar.status(day); status != dayWorking {
+					markDay(solver.dayOff, id, day)
+				}
+			}
+		}
+
+		var availability []models.Availability
+		if err := db.Where("user_id IN ? AND date >= ? AND date < ?", members, start, end.AddDate(0, 0, 1)).
+			Find(&availability).Error; err != nil {
+			return nil, err
+		}
+		for _, a := range availability {
+			solver.addAvailability(a)
+		}
+	}
+
+	solver.solve()
+
+	draft := &models.ScheduleDraft{
+		DepartmentID: departmentID,
+		StartDate:    start,
+		EndDate:      end,
+		Status:       models.ScheduleDraftOpen,
+	}
+	for _, slot := range slots {
+		draft.Required += slot.required
+		filled := len(slot.filled)
+		if filled > slot.required {
+			filled = slot.required
+		}
+		draft.Filled += filled
+
+		for _, shift := range slot.filled {
+			if shift.fixed {
+				continue
+			}
+			draft.Shifts = append(draft.Shifts, models.ScheduleDraftShift{
+				UserID:          shift.userID,
+				Date:            slot.day,
+				StartTime:       slot.start,
+				EndTime:         slot.end,
+				BreakTime:       slot.breakMinutes,
+				IsFlexTime:      slot.template.IsFlexTime,
+				Note:            slot.template.Note,
+				ShiftTemplateID: slot.template.ID,
+			})
+		}
+		if slot.shortfall() > 0 {
+			reasons, message := solver.explain(slot)
+			draft.Issues = append(draft.Issues, models.ScheduleDraftIssue{
+				Date:            slot.day,
+				ShiftTemplateID: slot.template.ID,
+				Required:        slot.required,
+				Assigned:        len(slot.filled),
+				Reasons:         reasons,
+				Message:         message,
+			})
+		}
+	}
+	return draft, nil
+}
+
+// CreateScheduleDraft runs the auto-scheduler and stores the result as a
+// draft for review. Nothing is scheduled until the draft is accepted.
+func (h *AutoScheduleHandler) CreateScheduleDraft(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+
+	var req CreateScheduleDraftRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := h.requireDepartment(c, req.DepartmentID); err != nil {
+		return err
+	}
+
+	start, err := parseLocalDate(req.StartDate)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid start_date format. Expected YYYY-MM-DD")
+	}
+	end, err := parseLocalDate(req.EndDate)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid end_date format. Expected YYYY-MM-DD")
+	}
+	if end.Before(start) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Start date must be before end date")
+	}
+	if end.Sub(start) >= maxScheduleRangeDays*24*time.Hour {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Range must not exceed %d days", maxScheduleRangeDays))
+	}
+
+	draft, err := buildScheduleDraft(h.db, req.DepartmentID, start, end)
+	if err != nil {
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			return httpErr
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to build schedule draft")
+	}
+	draft.CreatedBy = userID
+	if err := h.db.Create(draft).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to save schedule draft")
+	}
+
+	return c.JSON(http.StatusCreated, draft)
+}
+
+func (h *AutoScheduleHandler) GetScheduleDrafts(c echo.Context) error {
+	query, err := h.manageableDepartments(c, h.db.Preload("Department"))
+	if err != nil {
+		return err
+	}
+	if departmentID := c.QueryParam("department_id"); departmentID != "" {
+		query = query.Where("department_id = ?", departmentID)
+	}
+	if status := c.QueryParam("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var drafts []models.ScheduleDraft
+	if err := query.Order("created_at DESC").Find(&drafts).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve schedule drafts")
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": drafts,
+	})
+}
+
+func (h *AutoScheduleHandler) GetScheduleDraft(c echo.Context) error {
+	draftID, err := strconv.ParseUint(c.Param("draftId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid draft ID")
+	}
+
+	var draft models.ScheduleDraft
+	if err := h.db.Preload("Department").Preload("Shifts", func(db *gorm.DB) *gorm.DB {
+		return db.Order("start_time ASC, user_id ASC")
+	}).Preload("Shifts.User").Preload("Issues", func(db *gorm.DB) *gorm.DB {
+		return db.Order("date ASC, id ASC")
+	}).First(&draft, draftID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Schedule draft not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve schedule draft")
+	}
+	if err := h.requireDepartment(c, draft.DepartmentID); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, draft)
+}
+
+// DraftAvailabilityDay is one member's day in a draft: the proposed shift,
+// if any, against the availability they submitted.
+type DraftAvailabilityDay struct {
+	UserID       uint                       `json:"user_id"`
+	Date         string                     `json:"date"`
+	Shift        *models.ScheduleDraftShift `json:"shift,omitempty"`
+	Availability *models.Availability       `json:"availability,omitempty"`
+	Conflict     bool                       `json:"conflict"` // the shift does not fit the availability
+}
+
+// DraftAvailabilityMember is a department member and when they last
+// submitted availability for a period overlapping the draft.
+type DraftAvailabilityMember struct {
+	User        models.User `json:"user"`
+	SubmittedAt *time.Time  `json:"submitted_at"`
+}
+
+// GetScheduleDraftAvailability overlays the members' availability on a
+// draft, day by day, flagging shifts that do not fit it.
+func (h *AutoScheduleHandler) GetScheduleDraftAvailability(c echo.Context) error {
+	draftID, err := strconv.ParseUint(c.Param("draftId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid draft ID")
+	}
+
+	var draft models.ScheduleDraft
+	if err := h.db.Preload("Shifts").First(&draft, draftID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Schedule draft not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve schedule draft")
+	}
+	if err := h.requireDepartment(c, draft.DepartmentID); err != nil {
+		return err
+	}
+
+	var users []models.User
+	if err := h.db.Where("department_id = ?", draft.DepartmentID).Order("id ASC").Find(&users).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve members")
+	}
+	memberIDs := make([]uint, 0, len(users))
+	for _, u := range users {
+		memberIDs = append(memberIDs, u.ID)
+	}
+
+	var entries []models.Availability
+	if err := h.db.Where("user_id IN ? AND date >= ? AND date < ?", memberIDs, draft.StartDate, draft.EndDate.AddDate(0, 0, 1)).
+		Find(&entries).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve availability")
+	}
+	var submissions []models.AvailabilitySubmission
+	if err := h.db.Where("user_id IN ? AND period_id IN (?)", memberIDs,
+		h.db.Model(&models.AvailabilityPeriod{}).Select("id").
+			Where("start_date <= ? AND end_date >= ?", draft.EndDate, draft.StartDate)).
+		Find(&submissions).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve submissions")
+	}
+
+	type userDay struct {
+		userID uint
+		day    string
+	}
+	days := map[userDay]*DraftAvailabilityDay{}
+	at := func(userID uint, day time.Time) *DraftAvailabilityDay {
+		key := userDay{userID, dateKey(day.In(time.Local))}
+		if days[key] == nil {
+			days[key] = &DraftAvailabilityDay{UserID: userID, Date: key.day}
+		}
+		return days[key]
+	}
+	for i := range entries {
+		at(entries[i].UserID, entries[i].Date).Availability = &entries[i]
+	}
+	for i := range draft.Shifts {
+		at(draft.Shifts[i].UserID, draft.Shifts[i].Date).Shift = &draft.Shifts[i]
+	}
+
+	data := make([]*DraftAvailabilityDay, 0, len(days))
+	conflicts := 0
+	for _, d := range days {
+		if d.Shift != nil && d.Availability != nil && !availabilityAllows(d.Availability, d.Shift.StartTime, d.Shift.EndTime) {
+			d.Conflict = true
+			conflicts++
+		}
+		data = append(data, d)
+	}
+	sort.Slice(data, func(i, j int) bool {
+		if data[i].Date != data[j].Date {
+			return data[i].Date < data[j].Date
+		}
+		return data[i].UserID < data[j].UserID
+	})
+
+	submitted := map[uint]time.Time{}
+	for _, s := range submissions {
+		if s.SubmittedAt.After(submitted[s.UserID]) {
+			submitted[s.UserID] = s.SubmittedAt
+		}
+	}
+	members := make([]DraftAvailabilityMember, 0, len(users))
+	for _, u := range users {
+		member := DraftAvailabilityMember{User: u}
+		if when, ok := submitted[u.ID]; ok {
+			member.SubmittedAt = &when
+		}
+		members = append(members, member)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"draft_id":  draft.ID,
+		"members":   members,
+		"data":      data,
+		"conflicts": conflicts,
+	})
+}
+
+// AcceptScheduleDraft turns the draft's shifts into schedules in one
+// transaction. Shifts that now clash with a schedule, leave or the rest
+// interval fail the whole draft unless skip_conflicts is set.
+func (h *AutoScheduleHandler) AcceptScheduleDraft(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+
+	draftID, err := strconv.ParseUint(c.Param("draftId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid draft ID")
+	}
+	var req AcceptScheduleDraftRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	now := time.Now()
+	var draft models.ScheduleDraft
+	var created []models.Schedule
+	var conflicts []ScheduleConflict
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&draft, draftID).Error; err != nil {
+			return err
+		}
+		if err := h.requireDepartment(c, draft.DepartmentID); err != nil {
+			return err
+		}
+		if draft.Status != models.ScheduleDraftOpen {
+			return errDraftNotOpen
+		}
+		if err := requireOpenPeriod(tx, draft.StartDate.In(time.Local), draft.EndDate.In(time.Local)); err != nil {
+			return err
+		}
+
+		var shifts []models.ScheduleDraftShift
+		if err := tx.Where("draft_id = ?", draft.ID).Order("user_id ASC, start_time ASC").Find(&shifts).Error; err != nil {
+			return err
+		}
+		var locked uint
+		for _, shift := range shifts {
+			if shift.UserID != locked {
+				if err := lockUser(tx, shift.UserID); err != nil {
+					return err
+				}
+				locked = shift.UserID
+			}
+		}
+
+		for _, shift := range shifts {
+			day := shift.Date.In(time.Local)
+			reason, err := scheduleConflict(tx, shift.UserID, day, 0)
+			if err != nil {
+				return err
+			}
+			if reason == "" {
+				if reason, err = restIntervalConflict(tx, shift.UserID, shift.StartTime, shift.EndTime, 0); err != nil {
+					return err
+				}
+			}
+			if reason != "" {
+				conflicts = append(conflicts, ScheduleConflict{Date: dateKey(day), Reason: fmt.Sprintf("user %d: %s", shift.UserID, reason)})
+				continue
+			}
+			templateID := shift.ShiftTemplateID
+			created = append(created, models.Schedule{
+				UserID:          shift.UserID,
+				Date:            shift.Date,
+				StartTime:       shift.StartTime,
+				EndTime:         shift.EndTime,
+				BreakTime:       shift.BreakTime,
+				IsFlexTime:      shift.IsFlexTime,
+				Note:            shift.Note,
+				Source:          models.ScheduleAuto,
+				ShiftTemplateID: &templateID,
+			})
+		}
+		if len(conflicts) > 0 && !req.SkipConflicts {
+			return errScheduleConflict
+		}
+		if len(created) > 0 {
+			if err := tx.CreateInBatches(&created, 500).Error; err != nil {
+				return err
+			}
+		}
+
+		draft.Status = models.ScheduleDraftAccepted
+		draft.AcceptedBy = &userID
+		draft.AcceptedAt = &now
+		return tx.Save(&draft).Error
+	})
+	if err != nil {
+		var httpErr *echo.HTTPError
+		switch {
+		case errors.As(err, &httpErr):
+			return httpErr
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Schedule draft not found")
+		case errors.Is(err, errDraftNotOpen):
+			return echo.NewHTTPError(http.StatusConflict, "Schedule draft is no longer open")
+		case errors.Is(err, errScheduleConflict):
+			return c.JSON(http.StatusConflict, map[string]interface{}{
+				"message":   "Some shifts now conflict with schedules, leave or rest intervals",
+				"conflicts": conflicts,
+			})
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to accept schedule draft")
+	}
+
+	if conflicts == nil {
+		conflicts = []ScheduleConflict{}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"draft":   draft,
+		"created": len(created),
+		"skipped": conflicts,
+	})
+}
+
+// DiscardScheduleDraft closes an open draft without scheduling anything.
+func (h *AutoScheduleHandler) DiscardScheduleDraft(c echo.Context) error {
+	draftID, err := strconv.ParseUint(c.Param("draftId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid draft ID")
+	}
+
+	var draft models.ScheduleDraft
+	if err := h.db.First(&draft, draftID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Schedule draft not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve schedule draft")
+	}
+	if err := h.requireDepartment(c, draft.DepartmentID); err != nil {
+		return err
+	}
+
+	result := h.db.Model(&models.ScheduleDraft{}).
+		Where("id = ? AND status = ?", draft.ID, models.ScheduleDraftOpen).
+		Update("status", models.ScheduleDraftDiscarded)
+	if result.Error != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to discard schedule draft")
+	}
+	if result.RowsAffected == 0 {
+		return echo.NewHTTPError(http.StatusConflict, "Schedule draft is no longer open")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,365 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yudai-uk/backend/models"
+)
+
+// maxRepairRounds bounds the local search after the greedy pass.
+const maxRepairRounds = 5
+
+// maxWeeklyHours caps the planned hours of one employee in a Monday-based
+// week.
+func maxWeeklyHours() int {
+	return envInt("MAX_WEEKLY_HOURS", 40)
+}
+
+// Reasons a member cannot take a slot, as reported in draft issues.
+const (
+	reasonDayOff           = "day_off"
+	reasonLeave            = "leave"
+	reasonUnavailable      = "unavailable"
+	reasonAlreadyScheduled = "already_scheduled"
+	reasonRestInterval     = "rest_interval"
+	reasonWeeklyHours      = "weekly_hours"
+	reasonNoMembers        = "no_members"
+)
+
+// solverShift is a shift held by one member: an existing schedule (fixed)
+// or one the solver placed.
+type solverShift struct {
+	userID uint
+	day    time.Time
+	start  time.Time
+	end    time.Time
+	hours  float64
+	fixed  bool
+	slot   *staffingSlot
+}
+
+// staffingSlot is one template on one day that needs required people.
+type staffingSlot struct {
+	day          time.Time
+	template     *models.ShiftTemplate
+	required     int
+	start        time.Time
+	end          time.Time
+	breakMinutes int
+	hours        float64
+	filled       []*solverShift
+}
+
+func (s *staffingSlot) shortfall() int {
+	return s.required - len(s.filled)
+}
+
+func (s *staffingSlot) has(userID uint) bool {
+	for _, f := range s.filled {
+		if f.userID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// autoScheduler assigns members to staffing slots. Every choice is ordered
+// by a fixed key so the same inputs always produce the same draft.
+type autoScheduler struct {
+	members   []uint
+	slots     []*staffingSlot
+	shifts    map[uint][]*solverShift
+	dayOff    map[uint]map[string]bool
+	leave     map[uint]map[string]bool
+	available map[uint]map[string]models.Availability
+	preferred map[uint]map[string]bool
+	maxWeekly float64
+	rest      time.Duration
+	start     time.Time
+	end       time.Time
+}
+
+func newAutoScheduler(members []uint, start, end time.Time) *autoScheduler {
+	sorted := append([]uint(nil), members...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return &autoScheduler{
+		members:   sorted,
+		shifts:    map[uint][]*solverShift{},
+		dayOff:    map[uint]map[string]bool{},
+		leave:     map[uint]map[string]bool{},
+		available: map[uint]map[string]models.Availability{},
+		preferred: map[uint]map[string]bool{},
+		maxWeekly: float64(maxWeeklyHours()),
+		rest:      time.Duration(minRestHours()) * time.Hour,
+		start:     start,
+		end:       end,
+	}
+}
+
+func markDay(m map[uint]map[string]bool, userID uint, day time.Time) {
+	if m[userID] == nil {
+		m[userID] = map[string]bool{}
+	}
+	m[userID][dateKey(day)] = true
+}
+
+// addAvailability records a member's wish for a day. Preferred days are
+// tried first; any window limits the shifts the member can take.
+func (a *autoScheduler) addAvailability(entry models.Availability) {
+	day := entry.Date.In(time.Local)
+	if a.available[entry.UserID] == nil {
+		a.available[entry.UserID] = map[string]models.Availability{}
+	}
+	a.available[entry.UserID][dateKey(day)] = entry
+	if entry.Kind == models.AvailabilityPreferred {
+		markDay(a.preferred, entry.UserID, day)
+	}
+}
+
+// addFixed records an existing schedule of the given planned hours. It
+// counts towards a slot with the same template, or the same times, on its
+// day.
+func (a *autoScheduler) addFixed(schedule *models.Schedule, hours float64) {
+	day := truncateDate(schedule.Date.In(time.Local))
+	shift := &solverShift{
+		userID: schedule.UserID,
+		day:    day,
+		start:  schedule.StartTime,
+		end:    schedule.EndTime,
+		hours:  hours,
+		fixed:  true,
+	}
+	a.shifts[schedule.UserID] = append(a.shifts[schedule.UserID], shift)
+	for _, slot := range a.slots {
+		if !slot.day.Equal(day) || slot.has(schedule.UserID) {
+			continue
+		}
+		sameTemplate := schedule.ShiftTemplateID != nil && *schedule.ShiftTemplateID == slot.template.ID
+		if sameTemplate || schedule.StartTime.Equal(slot.start) && schedule.EndTime.Equal(slot.end) {
+			shift.slot = slot
+			slot.filled = append(slot.filled, shift)
+			return
+		}
+	}
+}
+
+func weekStart(day time.Time) time.Time {
+	return truncateDate(day).AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// check returns why userID cannot take slot, or "" if they can. ignore is a
+// shift to leave out, as if it had been given away.
+func (a *autoScheduler) check(userID uint, slot *staffingSlot, ignore *solverShift) string {
+	key := dateKey(slot.day)
+	if a.dayOff[userID][key] {
+		return reasonDayOff
+	}
+	if a.leave[userID][key] {
+		return reasonLeave
+	}
+	if entry, ok := a.available[userID][key]; ok && !availabilityAllows(&entry, slot.start, slot.end) {
+		return reasonUnavailable
+	}
+	week := weekStart(slot.day)
+	weekHours := slot.hours
+	for _, s := range a.shifts[userID] {
+		if s == ignore {
+			continue
+		}
+		if dateKey(s.day) == key {
+			return reasonAlreadyScheduled
+		}
+		if s.start.Before(slot.end.Add(a.rest)) && slot.start.Before(s.end.Add(a.rest)) {
+			return reasonRestInterval
+		}
+		if weekStart(s.day).Equal(week) {
+			weekHours += s.hours
+		}
+	}
+	if weekHours > a.maxWeekly+1e-9 {
+		return reasonWeeklyHours
+	}
+	return ""
+}
+
+// plannedHours sums the hours userID holds inside the scheduled range.
+func (a *autoScheduler) plannedHours(userID uint) float64 {
+	total := 0.0
+	for _, s := range a.shifts[userID] {
+		if !s.day.Before(a.start) && !s.day.After(a.end) {
+			total += s.hours
+		}
+	}
+	return total
+}
+
+// candidates lists members who can take slot, best first: those who asked
+// for the day, then those with the fewest hours so far.
+func (a *autoScheduler) candidates(slot *staffingSlot, exclude uint) []uint {
+	key := dateKey(slot.day)
+	var result []uint
+	for _, id := range a.members {
+		if id != exclude && !slot.has(id) && a.check(id, slot, nil) == "" {
+			result = append(result, id)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		pi, pj := a.preferred[result[i]][key], a.preferred[result[j]][key]
+		if pi != pj {
+			return pi
+		}
+		return a.plannedHours(result[i]) < a.plannedHours(result[j])
+	})
+	return result
+}
+
+func (a *autoScheduler) assign(userID uint, slot *staffingSlot) *solverShift {
+	shift := &solverShift{
+		userID: userID,
+		day:    slot.day,
+		start:  slot.start,
+		end:    slot.end,
+		hours:  slot.hours,
+		slot:   slot,
+	}
+	a.shifts[userID] = append(a.shifts[userID], shift)
+	slot.filled = append(slot.filled, shift)
+	return shift
+}
+
+func (a *autoScheduler) unassign(shift *solverShift) {
+	a.shifts[shift.userID] = removeShift(a.shifts[shift.userID], shift)
+	shift.slot.filled = removeShift(shift.slot.filled, shift)
+}
+
+func removeShift(shifts []*solverShift, target *solverShift) []*solverShift {
+	for i, s := range shifts {
+		if s == target {
+			return append(shifts[:i:i], shifts[i+1:]...)
+		}
+	}
+	return shifts
+}
+
+// solve fills the slots greedily, then repairs shortfalls and evens out
+// hours with bounded local search.
+func (a *autoScheduler) solve() {
+	for _, slot := range a.slots {
+		for _, id := range a.candidates(slot, 0) {
+			if slot.shortfall() <= 0 {
+				break
+			}
+			a.assign(id, slot)
+		}
+	}
+
+	for round := 0; round < maxRepairRounds; round++ {
+		if !a.repair() {
+			break
+		}
+	}
+	for round := 0; round < maxRepairRounds; round++ {
+		if !a.balance() {
+			break
+		}
+	}
+}
+
+// repair tries to fill each short slot by moving a member off another
+// placed shift and handing that shift to someone else. It reports whether
+// anything improved.
+func (a *autoScheduler) repair() bool {
+	improved := false
+	for _, slot := range a.slots {
+		for slot.shortfall() > 0 && a.repairSlot(slot) {
+			improved = true
+		}
+	}
+	return improved
+}
+
+func (a *autoScheduler) repairSlot(slot *staffingSlot) bool {
+	for _, id := range a.members {
+		if slot.has(id) {
+			continue
+		}
+		switch a.check(id, slot, nil) {
+		case reasonAlreadyScheduled, reasonRestInterval, reasonWeeklyHours:
+		default:
+			continue
+		}
+		for _, placed := range append([]*solverShift(nil), a.shifts[id]...) {
+			if placed.fixed || a.check(id, slot, placed) != "" {
+				continue
+			}
+			from := placed.slot
+			a.unassign(placed)
+			moved := a.assign(id, slot)
+			if replacements := a.candidates(from, id); len(replacements) > 0 {
+				a.assign(replacements[0], from)
+				return true
+			}
+			a.unassign(moved)
+			a.shifts[id] = append(a.shifts[id], placed)
+			from.filled = append(from.filled, placed)
+		}
+	}
+	return false
+}
+
+// balance hands placed shifts from the busiest members to less busy ones
+// while that narrows the gap between them. Preferred days are kept.
+func (a *autoScheduler) balance() bool {
+	improved := false
+	for _, slot := range a.slots {
+		for _, placed := range append([]*solverShift(nil), slot.filled...) {
+			if placed.fixed || a.preferred[placed.userID][dateKey(slot.day)] {
+				continue
+			}
+			owner := a.plannedHours(placed.userID)
+			for _, id := range a.candidates(slot, placed.userID) {
+				if a.plannedHours(id)+placed.hours < owner {
+					a.unassign(placed)
+					a.assign(id, slot)
+					improved = true
+					break
+				}
+			}
+		}
+	}
+	return improved
+}
+
+// explain counts why each member could not take a short slot.
+func (a *autoScheduler) explain(slot *staffingSlot) (map[string]int, string) {
+	reasons := map[string]int{}
+	for _, id := range a.members {
+		if slot.has(id) {
+			continue
+		}
+		if reason := a.check(id, slot, nil); reason != "" {
+			reasons[reason]++
+		}
+	}
+	if len(a.members) == 0 {
+		reasons[reasonNoMembers] = 1
+	}
+
+	keys := make([]string, 0, len(reasons))
+	for k := range reasons {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s: %d", k, reasons[k]))
+	}
+	message := fmt.Sprintf("%s %s: %d of %d filled", dateKey(slot.day), slot.template.Name, len(slot.filled), slot.required)
+	if len(parts) > 0 {
+		message += " (" + strings.Join(parts, ", ") + ")"
+	}
+	return reasons, message
+}
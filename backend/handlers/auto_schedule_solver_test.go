@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yudai-uk/backend/models"
+)
+
+func solverDay(day int) time.Time {
+	return time.Date(2026, 1, day, 0, 0, 0, 0, time.Local) // 2026-01-05 is a Monday
+}
+
+// solverSlot is a slot for template on day from startHour to endHour, with
+// no break.
+func solverSlot(template *models.ShiftTemplate, day, startHour, endHour, required int) *staffingSlot {
+	start := solverDay(day).Add(time.Duration(startHour) * time.Hour)
+	end := solverDay(day).Add(time.Duration(endHour) * time.Hour)
+	return &staffingSlot{
+		day:      solverDay(day),
+		template: template,
+		required: required,
+		start:    start,
+		end:      end,
+		hours:    end.Sub(start).Hours(),
+	}
+}
+
+// solverResult renders each slot as "date template: members" and each
+// short slot's reasons as "date template: reason=count".
+func solverResult(a *autoScheduler) ([]string, []string) {
+	var draft, issues []string
+	for _, slot := range a.slots {
+		ids := []string{}
+		for _, shift := range slot.filled {
+			ids = append(ids, fmt.Sprint(shift.userID))
+		}
+		sort.Strings(ids)
+		label := dateKey(slot.day) + " " + slot.template.Name
+		draft = append(draft, label+": "+strings.Join(ids, ","))
+
+		if slot.shortfall() > 0 {
+			reasons, _ := a.explain(slot)
+			keys := make([]string, 0, len(reasons))
+			for k, n := range reasons {
+				keys = append(keys, fmt.Sprintf("%s=%d", k, n))
+			}
+			sort.Strings(keys)
+			issues = append(issues, label+": "+strings.Join(keys, ","))
+		}
+	}
+	return draft, issues
+}
+
+func TestAutoSchedulerSolve(t *testing.T) {
+	early := &models.ShiftTemplate{ID: 1, Name: "early"}
+	late := &models.ShiftTemplate{ID: 2, Name: "late"}
+
+	tests := []struct {
+		name       string
+		members    []uint
+		maxWeekly  float64
+		slots      []*staffingSlot
+		setup      func(a *autoScheduler)
+		wantDraft  []string
+		wantIssues []string
+	}{
+		{
+			name:    "spreads hours evenly in member order",
+			members: []uint{2, 1, 3},
+			slots: []*staffingSlot{
+				solverSlot(early, 5, 9, 17, 2),
+				solverSlot(early, 6, 9, 17, 2),
+				solverSlot(early, 7, 9, 17, 2),
+			},
+			wantDraft: []string{
+				"2026-01-05 early: 1,2",
+				"2026-01-06 early: 1,3",
+				"2026-01-07 early: 2,3",
+			},
+		},
+		{
+			name:    "leave keeps a member off the day",
+			members: []uint{1, 2},
+			slots: []*staffingSlot{
+				solverSlot(early, 5, 9, 17, 1),
+				solverSlot(early, 6, 9, 17, 2),
+			},
+			setup: func(a *autoScheduler) {
+				markDay(a.leave, 1, solverDay(5))
+				markDay(a.leave, 1, solverDay(6))
+			},
+			wantDraft: []string{
+				"2026-01-05 early: 2",
+				"2026-01-06 early: 2",
+			},
+			wantIssues: []string{
+				"2026-01-06 early: leave=1",
+			},
+		},
+		{
+			name:    "rest interval after a fixed late shift",
+			members: []uint{1},
+			slots: []*staffingSlot{
+				solverSlot(early, 6, 6, 14, 1),
+				solverSlot(early, 7, 9, 17, 1),
+			},
+			setup: func(a *autoScheduler) {
+				a.addFixed(&models.Schedule{
+					UserID:    1,
+					Date:      solverDay(5),
+					StartTime: solverDay(5).Add(14 * time.Hour),
+					EndTime:   solverDay(5).Add(22 * time.Hour),
+				}, 8)
+			},
+			wantDraft: []string{
+				"2026-01-06 early: ",
+				"2026-01-07 early: 1",
+			},
+			wantIssues: []string{
+				"2026-01-06 early: rest_interval=1",
+			},
+		},
+		{
+			name:      "weekly cap stops a third shift",
+			members:   []uint{1},
+			maxWeekly: 16,
+			slots: []*staffingSlot{
+				solverSlot(early, 5, 9, 17, 1),
+				solverSlot(early, 6, 9, 17, 1),
+				solverSlot(early, 7, 9, 17, 1),
+				solverSlot(early, 12, 9, 17, 1),
+			},
+			wantDraft: []string{
+				"2026-01-05 early: 1",
+				"2026-01-06 early: 1",
+				"2026-01-07 early: ",
+				"2026-01-12 early: 1",
+			},
+			wantIssues: []string{
+				"2026-01-07 early: weekly_hours=1",
+			},
+		},
+		{
+			name:    "repair moves a member to free the short slot",
+			members: []uint{1, 2},
+			slots: []*staffingSlot{
+				solverSlot(early, 5, 6, 14, 1),
+				solverSlot(late, 5, 14, 22, 1),
+			},
+			setup: func(a *autoScheduler) {
+				// Member 2 can only work the early shift, which the greedy
+				// pass hands to member 1 first.
+				a.addAvailability(models.Availability{UserID: 2, Date: solverDay(5),
+					Kind: models.AvailabilityAvailable, StartTime: "06:00", EndTime: "14:00"})
+			},
+			wantDraft: []string{
+				"2026-01-05 early: 2",
+				"2026-01-05 late: 1",
+			},
+		},
+		{
+			name:    "no members",
+			members: nil,
+			slots: []*staffingSlot{
+				solverSlot(early, 5, 9, 17, 1),
+			},
+			wantDraft: []string{
+				"2026-01-05 early: ",
+			},
+			wantIssues: []string{
+				"2026-01-05 early: no_members=1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Run twice to check that the same input gives the same draft.
+			for run := 0; run < 2; run++ {
+				a := newAutoScheduler(tt.members, solverDay(5), solverDay(18))
+				a.maxWeekly = 40
+				if tt.maxWeekly > 0 {
+					a.maxWeekly = tt.maxWeekly
+				}
+				a.rest = 11 * time.Hour
+				a.slots = nil
+				for _, s := range tt.slots {
+					copied := *s
+					copied.filled = nil
+					a.slots = append(a.slots, &copied)
+				}
+				if tt.setup != nil {
+					tt.setup(a)
+				}
+				a.solve()
+
+				draft, issues := solverResult(a)
+				if !reflect.DeepEqual(draft, tt.wantDraft) {
+					t.Errorf("run %d: draft = %q, want %q", run, draft, tt.wantDraft)
+				}
+				if len(issues) == 0 {
+					issues = nil
+				}
+				if !reflect.DeepEqual(issues, tt.wantIssues) {
+					t.Errorf("run %d: issues = %q, want %q", run, issues, tt.wantIssues)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,573 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errDeadlinePassed = errors.New("availability deadline passed")
+
+type AvailabilityHandler struct {
+	db *gorm.DB
+}
+
+func NewAvailabilityHandler(db *gorm.DB) *AvailabilityHandler {
+	return &AvailabilityHandler{db: db}
+}
+
+type AvailabilityRequest struct {
+	Date      string                  `json:"date" validate:"required"` // YYYY-MM-DD
+	Kind      models.AvailabilityKind `json:"kind" validate:"required"` // available, unavailable or preferred
+	StartTime string                  `json:"start_time"`               // HH:MM, empty for the whole day
+	EndTime   string                  `json:"end_time"`                 // HH:MM, empty for the whole day
+	Note      string                  `json:"note"`
+}
+
+type AvailabilitySubmissionRequest struct {
+	Entries []AvailabilityRequest `json:"entries"` // replaces every entry in the period
+}
+
+type AvailabilityPeriodRequest struct {
+	DepartmentID *uint     `json:"department_id"`                  // nil for everyone; admins only
+	StartDate    string    `json:"start_date" validate:"required"` // YYYY-MM-DD
+	EndDate      string    `json:"end_date" validate:"required"`   // YYYY-MM-DD
+	Deadline     time.Time `json:"deadline" validate:"required"`
+	Note         string    `json:"note"`
+}
+
+// AvailabilityPeriodStatus is a period as seen by one employee.
+type AvailabilityPeriodStatus struct {
+	models.AvailabilityPeriod
+	Open        bool       `json:"open"` // the deadline has not passed
+	SubmittedAt *time.Time `json:"submitted_at"`
+}
+
+// AvailabilitySubmissionStatus is whether one member has submitted.
+type AvailabilitySubmissionStatus struct {
+	User        models.User `json:"user"`
+	SubmittedAt *time.Time  `json:"submitted_at"`
+}
+
+// monthRange parses YYYY-MM into its first and last day.
+func monthRange(month string) (time.Time, time.Time, error) {
+	parsed, err := time.ParseInLocation("2006-01", month, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, echo.NewHTTPError(http.StatusBadRequest, "Invalid month format. Expected YYYY-MM")
+	}
+	return parsed, parsed.AddDate(0, 1, -1), nil
+}
+
+// availabilityAllows reports whether a shift from start to end fits the
+// availability entry for its day.
+func availabilityAllows(entry *models.Availability, start, end time.Time) bool {
+	from, errFrom := parseClock(entry.StartTime)
+	to, errTo := parseClock(entry.EndTime)
+	if errFrom != nil || errTo != nil {
+		return entry.Kind != models.AvailabilityUnavailable
+	}
+	windowStart, windowEnd := shiftTimes(entry.Date.In(time.Local), from, to)
+	if entry.Kind == models.AvailabilityUnavailable {
+		return !start.Before(windowEnd) || !windowStart.Before(end)
+	}
+	return !start.Before(windowStart) && !end.After(windowEnd)
+}
+
+// parseAvailability validates req into an entry for userID.
+func parseAvailability(userID uint, req *AvailabilityRequest) (*models.Availability, error) {
+	switch req.Kind {
+	case models.AvailabilityAvailable, models.AvailabilityUnavailable, models.AvailabilityPreferred:
+	default:
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "kind must be available, unavailable or preferred")
+	}
+	day, err := parseLocalDate(req.Date)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid date format. Expected YYYY-MM-DD")
+	}
+	if day.Before(truncateDate(time.Now())) {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Availability can only be set for today or later")
+	}
+	if (req.StartTime == "") != (req.EndTime == "") {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "start_time and end_time must be given together")
+	}
+	if req.StartTime != "" {
+		start, err := parseClock(req.StartTime)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid start_time format. Expected HH:MM")
+		}
+		end, err := parseClock(req.EndTime)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid end_time format. Expected HH:MM")
+		}
+		if start == end {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "start_time and end_time must differ")
+		}
+	}
+	return &models.Availability{
+		UserID:    userID,
+		Date:      day,
+		Kind:      req.Kind,
+		StartTime: req.StartTime,
+		EndTime:   req.EndTime,
+		Note:      req.Note,
+	}, nil
+}
+
+// availabilityPeriodsFor lists the periods that ask userID for availability:
+// company-wide ones and those of their department or one above it.
+func availabilityPeriodsFor(db *gorm.DB, userID uint) ([]models.AvailabilityPeriod, error) {
+	var user models.User
+	if err := db.Select("id", "department_id").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	var departments []uint
+	if user.DepartmentID != nil {
+		chain, err := departmentChain(db, *user.DepartmentID)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range chain {
+			departments = append(departments, d.ID)
+		}
+	}
+
+	query := db.Where("department_id IS NULL")
+	if len(departments) > 0 {
+		query = db.Where("(department_id IS NULL OR department_id IN ?)", departments)
+	}
+	var periods []models.AvailabilityPeriod
+	err := query.Order("start_date ASC, id ASC").Find(&periods).Error
+	return periods, err
+}
+
+// checkAvailabilityDeadline fails with errDeadlinePassed when day belongs
+// to a period of userID's whose deadline has passed.
+func checkAvailabilityDeadline(db *gorm.DB, userID uint, day time.Time) error {
+	periods, err := availabilityPeriodsFor(db, userID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := range periods {
+		if periods[i].Covers(day) && now.After(periods[i].Deadline) {
+			return errDeadlinePassed
+		}
+	}
+	return nil
+}
+
+// GetAvailability lists the caller's availability for a month. Managers
+// may pass user_id for someone in their scope.
+func (h *AvailabilityHandler) GetAvailability(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+
+	start, end, err := monthRange(c.QueryParam("month"))
+	if err != nil {
+		return err
+	}
+
+	if requested := c.QueryParam("user_id"); requested != "" {
+		id, err := strconv.ParseUint(requested, 10, 32)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid user_id parameter")
+		}
+		scope, err := scopeFor(c, h.db)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+		}
+		if !scope.contains(uint(id)) {
+			return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+		}
+		userID = uint(id)
+	}
+
+	var entries []models.Availability
+	if err := h.db.Where("user_id = ? AND date >= ? AND date < ?", userID, start, end.AddDate(0, 0, 1)).
+		Order("date ASC").Find(&entries).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve availability")
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": entries,
+	})
+}
+
+// SetAvailability records or replaces the caller's wish for a future day.
+func (h *AvailabilityHandler) SetAvailability(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+
+	var req AvailabilityRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	entry, err := parseAvailability(userID, &req)
+	if err != nil {
+		return err
+	}
+	if err := checkAvailabilityDeadline(h.db, userID, entry.Date); err != nil {
+		if errors.Is(err, errDeadlinePassed) {
+			return echo.NewHTTPError(http.StatusConflict, "The submission deadline for this date has passed")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve availability periods")
+	}
+
+	if err := h.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"kind", "start_time", "end_time", "note", "updated_at"}),
+	}).Create(entry).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to save availability")
+	}
+
+	h.db.Where("user_id = ? AND date = ?", userID, entry.Date).First(entry)
+	return c.JSON(http.StatusOK, entry)
+}
+
+func (h *AvailabilityHandler) DeleteAvailability(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+
+	availabilityID, err := strconv.ParseUint(c.Param("availabilityId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid availability ID")
+	}
+
+	var entry models.Availability
+	if err := h.db.Where("id = ? AND user_id = ?", availabilityID, userID).First(&entry).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Availability not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve availability")
+	}
+	if err := checkAvailabilityDeadline(h.db, userID, entry.Date); err != nil {
+		if errors.Is(err, errDeadlinePassed) {
+			return echo.NewHTTPError(http.StatusConflict, "The submission deadline for this date has passed")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve availability periods")
+	}
+	if err := h.db.Delete(&entry).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete availability")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetMyAvailabilityPeriods lists the periods that ask the caller for
+// availability and whether they have submitted.
+func (h *AvailabilityHandler) GetMyAvailabilityPeriods(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+
+	periods, err := availabilityPeriodsFor(h.db, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve availability periods")
+	}
+	var submissions []models.AvailabilitySubmission
+	if err := h.db.Where("user_id = ?", userID).Find(&submissions).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve submissions")
+	}
+	submitted := map[uint]time.Time{}
+	for _, s := range submissions {
+		submitted[s.PeriodID] = s.SubmittedAt
+	}
+
+	now := time.Now()
+	data := make([]AvailabilityPeriodStatus, 0, len(periods))
+	for _, p := range periods {
+		status := AvailabilityPeriodStatus{AvailabilityPeriod: p, Open: !now.After(p.Deadline)}
+		if at, ok := submitted[p.ID]; ok {
+			status.SubmittedAt = &at
+		}
+		data = append(data, status)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": data,
+	})
+}
+
+// SubmitAvailability replaces the caller's entries in a period with the
+// submitted ones and records the submission. It may be repeated until the
+// deadline.
+func (h *AvailabilityHandler) SubmitAvailability(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+
+	periodID, err := strconv.ParseUint(c.Param("periodId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid period ID")
+	}
+	var req AvailabilitySubmissionRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	periods, err := availabilityPeriodsFor(h.db, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve availability periods")
+	}
+	var period *models.AvailabilityPeriod
+	for i := range periods {
+		if periods[i].ID == uint(periodID) {
+			period = &periods[i]
+		}
+	}
+	if period == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Availability period not found")
+	}
+	now := time.Now()
+	if now.After(period.Deadline) {
+		return echo.NewHTTPError(http.StatusConflict, "The submission deadline has passed")
+	}
+
+	entries := make([]*models.Availability, 0, len(req.Entries))
+	seen := map[string]bool{}
+	for i := range req.Entries {
+		entry, err := parseAvailability(userID, &req.Entries[i])
+		if err != nil {
+			return err
+		}
+		if !period.Covers(entry.Date) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Entry "+req.Entries[i].Date+" is outside the period")
+		}
+		if seen[dateKey(entry.Date)] {
+			return echo.NewHTTPError(http.StatusBadRequest, "Entry "+req.Entries[i].Date+" is given twice")
+		}
+		seen[dateKey(entry.Date)] = true
+		entries = append(entries, entry)
+	}
+
+	// Days already past stay as they were.
+	from := period.StartDate
+	if today := truncateDate(now); today.After(from) {
+		from = today
+	}
+	submission := models.AvailabilitySubmission{PeriodID: period.ID, UserID: userID, SubmittedAt: now}
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND date >= ? AND date < ?", userID, from, period.EndDate.AddDate(0, 0, 1)).
+			Delete(&models.Availability{}).Error; err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := tx.Create(entry).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "period_id"}, {Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"submitted_at"}),
+		}).Create(&submission).Error
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to submit availability")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"period":       period,
+		"submitted_at": now,
+		"data":         entries,
+	})
+}
+
+// requirePeriodDepartment checks the caller may manage periods for
+// departmentID. Company-wide periods are for admins.
+func (h *AvailabilityHandler) requirePeriodDepartment(c echo.Context, departmentID *uint) error {
+	role := c.Get("user_role").(string)
+	if departmentID == nil {
+		if role != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+		}
+		return nil
+	}
+	allowed, err := canManageDepartment(h.db, c.Get("user_id").(uint), role, *departmentID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+	if !allowed {
+		return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+	}
+	return nil
+}
+
+// GetAvailabilityPeriods lists periods. Managers see the company-wide ones
+// and those of the departments they manage.
+func (h *AvailabilityHandler) GetAvailabilityPeriods(c echo.Context) error {
+	query := h.db.Preload("Department").Order("start_date DESC, id DESC")
+	if c.Get("user_role").(string) != "admin" {
+		managed, err := managedDepartmentIDs(h.db, c.Get("user_id").(uint))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+		}
+		query = query.Where("(department_id IS NULL OR department_id IN ?)", append(managed, 0))
+	}
+
+	var periods []models.AvailabilityPeriod
+	if err := query.Find(&periods).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve availability periods")
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": periods,
+	})
+}
+
+func (h *AvailabilityHandler) CreateAvailabilityPeriod(c echo.Context) error {
+	var req AvailabilityPeriodRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := h.requirePeriodDepartment(c, req.DepartmentID); err != nil {
+		return err
+	}
+
+	period := models.AvailabilityPeriod{CreatedBy: c.Get("user_id").(uint)}
+	if err := applyAvailabilityPeriod(&period, &req); err != nil {
+		return err
+	}
+	if err := h.db.Omit("Department").Create(&period).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create availability period")
+	}
+
+	return c.JSON(http.StatusCreated, period)
+}
+
+func (h *AvailabilityHandler) UpdateAvailabilityPeriod(c echo.Context) error {
+	period, err := h.loadPeriod(c, true)
+	if err != nil {
+		return err
+	}
+	var req AvailabilityPeriodRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := h.requirePeriodDepartment(c, req.DepartmentID); err != nil {
+		return err
+	}
+	if err := applyAvailabilityPeriod(period, &req); err != nil {
+		return err
+	}
+	if err := h.db.Omit("Department").Save(period).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update availability period")
+	}
+
+	return c.JSON(http.StatusOK, period)
+}
+
+func applyAvailabilityPeriod(period *models.AvailabilityPeriod, req *AvailabilityPeriodRequest) error {
+	start, err := parseLocalDate(req.StartDate)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid start_date format. Expected YYYY-MM-DD")
+	}
+	end, err := parseLocalDate(req.EndDate)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid end_date format. Expected YYYY-MM-DD")
+	}
+	if end.Before(start) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Start date must be before end date")
+	}
+	if req.Deadline.IsZero() || !req.Deadline.Before(start) {
+		return echo.NewHTTPError(http.StatusBadRequest, "deadline must be before the start of the period")
+	}
+
+	period.DepartmentID = req.DepartmentID
+	period.StartDate = start
+	period.EndDate = end
+	period.Deadline = req.Deadline
+	period.Note = req.Note
+	return nil
+}
+
+func (h *AvailabilityHandler) DeleteAvailabilityPeriod(c echo.Context) error {
+	period, err := h.loadPeriod(c, true)
+	if err != nil {
+		return err
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("period_id = ?", period.ID).Delete(&models.AvailabilitySubmission{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(period).Error
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete availability period")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetAvailabilitySubmissions lists who in the period's audience has
+// submitted, limited to the caller's scope.
+func (h *AvailabilityHandler) GetAvailabilitySubmissions(c echo.Context) error {
+	period, err := h.loadPeriod(c, false)
+	if err != nil {
+		return err
+	}
+
+	scope, err := scopeFor(c, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+	query := scope.apply(h.db, "id").Where("role != ?", "admin")
+	if period.DepartmentID != nil {
+		departments, err := departmentSubtree(h.db, []uint{*period.DepartmentID})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve department")
+		}
+		query = query.Where("department_id IN ?", departments)
+	}
+	var users []models.User
+	if err := query.Order("id ASC").Find(&users).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve users")
+	}
+
+	var submissions []models.AvailabilitySubmission
+	if err := h.db.Where("period_id = ?", period.ID).Find(&submissions).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve submissions")
+	}
+	submitted := map[uint]time.Time{}
+	for _, s := range submissions {
+		submitted[s.UserID] = s.SubmittedAt
+	}
+
+	data := make([]AvailabilitySubmissionStatus, 0, len(users))
+	missing := 0
+	for _, u := range users {
+		status := AvailabilitySubmissionStatus{User: u}
+		if at, ok := submitted[u.ID]; ok {
+			status.SubmittedAt = &at
+		} else {
+			missing++
+		}
+		data = append(data, status)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"period":  period,
+		"data":    data,
+		"missing": missing,
+	})
+}
+
+// loadPeriod fetches :periodId and checks the caller may manage it, or
+// only view it unless manage is set: anyone in the admin area may view
+// company-wide periods.
+func (h *AvailabilityHandler) loadPeriod(c echo.Context, manage bool) (*models.AvailabilityPeriod, error) {
+	periodID, err := strconv.ParseUint(c.Param("periodId"), 10, 32)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid period ID")
+	}
+	var period models.AvailabilityPeriod
+	if err := h.db.First(&period, periodID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, echo.NewHTTPError(http.StatusNotFound, "Availability period not found")
+		}
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve availability period")
+	}
+	if manage || period.DepartmentID != nil {
+		if err := h.requirePeriodDepartment(c, period.DepartmentID); err != nil {
+			return nil, err
+		}
+	}
+	return &period, nil
+}
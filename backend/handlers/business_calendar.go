@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/yudai-uk/backend/models"
+	"gorm.io/gorm"
+)
+
+const dateKeyLayout = "2006-01-02"
+
+func dateKey(t time.Time) string {
+	return t.Format(dateKeyLayout)
+}
+
+func truncateDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// dayStatus classifies a day on a company calendar.
+type dayStatus string
+
+const (
+	dayWorking          dayStatus = "working"
+	dayWeeklyRest       dayStatus = "weekly_rest"
+	dayStatutoryHoliday dayStatus = "statutory_holiday" // 法定休日
+	dayHoliday          dayStatus = "holiday"
+	dayClosure          dayStatus = "closure"
+)
+
+var sunday = int(time.Sunday)
+
+// builtinCalendar applies when no company calendar is configured: Monday to
+// Friday, with Sunday as the statutory holiday.
+var builtinCalendar = models.CompanyCalendar{Name: "builtin", RestWeekdays: "0,6", StatutoryWeekday: &sunday}
+
+// companyCalendarFor resolves the calendar that applies to a user: their
+// location's, then the nearest department's up the tree, then the default
+// calendar, then the built-in week.
+func companyCalendarFor(db *gorm.DB, userID uint) (*models.CompanyCalendar, error) {
+	var user models.User
+	if err := db.Select("id", "department_id", "location_id").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	var calendarID *uint
+	if user.LocationID != nil {
+		var location models.Location
+		if err := db.Select("id", "calendar_id").Where("id = ?", *user.LocationID).Limit(1).Find(&location).Error; err != nil {
+			return nil, err
+		}
+		calendarID = location.CalendarID
+	}
+	if calendarID == nil && user.DepartmentID != nil {
+		var err error
+		if calendarID, err = departmentCalendarID(db, *user.DepartmentID); err != nil {
+			return nil, err
+		}
+	}
+	return calendarOrDefault(db, calendarID)
+}
+
+// departmentCalendar resolves the calendar of a department: the nearest one
+// set up the tree, then the default calendar, then the built-in week.
+func departmentCalendar(db *gorm.DB, departmentID uint) (*models.CompanyCalendar, error) {
+	calendarID, err := departmentCalendarID(db, departmentID)
+	if err != nil {
+		return nil, err
+	}
+	return calendarOrDefault(db, calendarID)
+}
+
+// departmentCalendarID is the nearest calendar set on departmentID or one
+// of its parents, if any.
+func departmentCalendarID(db *gorm.DB, departmentID uint) (*uint, error) {
+	chain, err := departmentChain(db, departmentID)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range chain {
+		if d.CalendarID != nil {
+			return d.CalendarID, nil
+		}
+	}
+	return nil, nil
+}
+
+// calendarOrDefault loads calendarID, or the default calendar when nil.
+func calendarOrDefault(db *gorm.DB, calendarID *uint) (*models.CompanyCalendar, error) {
+	var calendars []models.CompanyCalendar
+	query := db.Where("is_default = ?", true)
+	if calendarID != nil {
+		query = db.Where("id = ?", *calendarID)
+	}
+	if err := query.Order("id ASC").Limit(1).Find(&calendars).Error; err != nil {
+		return nil, err
+	}
+	if len(calendars) == 0 {
+		calendar := builtinCalendar
+		return &calendar, nil
+	}
+	return &calendars[0], nil
+}
+
+// businessCalendar is a company calendar loaded for a date range together
+// with the company holidays and its per-date overrides. periods, newest
+// first, switch to the calendar of the work rule in effect; a nil calendar
+// there means the rule has none.
+type businessCalendar struct {
+	calendar  *models.CompanyCalendar
+	holidays  map[string]string
+	overrides map[string]models.CompanyCalendarDay
+	periods   []calendarPeriod
+}
+
+type calendarPeriod struct {
+	from     time.Time
+	calendar *businessCalendar
+}
+
+func loadCalendarDays(db *gorm.DB, calendar *models.CompanyCalendar, start, end time.Time) (*businessCalendar, error) {
+	b := &businessCalendar{
+		calendar:  calendar,
+		holidays:  map[string]string{},
+		overrides: map[string]models.CompanyCalendarDay{},
+	}
+
+	var holidays []models.Holiday
+	if err := db.Where("date BETWEEN ? AND ?", start, end).Find(&holidays).Error; err != nil {
+		return nil, err
+	}
+	for _, h := range holidays {
+		b.holidays[dateKey(h.Date)] = h.Name
+	}
+
+	if calendar.ID != 0 {
+		var days []models.CompanyCalendarDay
+		if err := db.Where("calendar_id = ? AND date BETWEEN ? AND ?", calendar.ID, start, end).
+			Find(&days).Error; err != nil {
+			return nil, err
+		}
+		for _, d := range days {
+			b.overrides[dateKey(d.Date)] = d
+		}
+	}
+	return b, nil
+}
+
+// loadBusinessCalendar loads the calendar that applies to userID. On days
+// when the user's work rule names a holiday calendar, that one applies
+// instead.
+func loadBusinessCalendar(db *gorm.DB, userID uint, start, end time.Time) (*businessCalendar, error) {
+	calendar, err := companyCalendarFor(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	b, err := loadCalendarDays(db, calendar, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	periods, err := newWorkRules(db).forUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	loaded := map[uint]*businessCalendar{}
+	for _, p := range periods {
+		if p.from.After(end) {
+			continue
+		}
+		period := calendarPeriod{from: p.from}
+		if id := p.rule.CalendarID; id != nil {
+			if _, ok := loaded[*id]; !ok {
+				var found []models.CompanyCalendar
+				if err := db.Where("id = ?", *id).Limit(1).Find(&found).Error; err != nil {
+					return nil, err
+				}
+				loaded[*id] = nil
+				if len(found) == 1 {
+					if loaded[*id], err = loadCalendarDays(db, &found[0], start, end); err != nil {
+						return nil, err
+					}
+				}
+			}
+			period.calendar = loaded[*id]
+		}
+		b.periods = append(b.periods, period)
+		if !p.from.After(start) {
+			break
+		}
+	}
+	return b, nil
+}
+
+// status classifies day and names the holiday or closure, if any. A dated
+// override beats company holidays, which beat the weekly pattern.
+func (b *businessCalendar) status(day time.Time) (dayStatus, string) {
+	for _, p := range b.periods {
+		if !p.from.After(truncateDate(day)) {
+			if p.calendar != nil {
+				return p.calendar.status(day)
+			}
+			break
+		}
+	}
+
+	key := dateKey(day)
+	if override, ok := b.overrides[key]; ok {
+		switch override.Kind {
+		case models.CalendarWorking:
+			return dayWorking, override.Name
+		case models.CalendarClosure:
+			return dayClosure, override.Name
+		case models.CalendarStatutory:
+			return dayStatutoryHoliday, override.Name
+		}
+	}
+	if name, ok := b.holidays[key]; ok && !b.calendar.OpenOnHolidays {
+		return dayHoliday, name
+	}
+	if b.calendar.IsRestWeekday(day.Weekday()) {
+		if b.calendar.StatutoryWeekday != nil && *b.calendar.StatutoryWeekday == int(day.Weekday()) {
+			return dayStatutoryHoliday, ""
+		}
+		return dayWeeklyRest, ""
+	}
+	return dayWorking, ""
+}
+
+// userWorkingDays returns the dates in [start, end] on which the user is
+// expected to work. A day with a schedule is a working day. In a month where
+// the user has any schedule, unscheduled days are off; otherwise the user's
+// company calendar applies.
+func userWorkingDays(db *gorm.DB, userID uint, start, end time.Time) ([]time.Time, error) {
+	start, end = truncateDate(start), truncateDate(end)
+	if end.Before(start) {
+		return nil, nil
+	}
+
+	monthStart := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, start.Location())
+	monthEnd := time.Date(end.Year(), end.Month(), 1, 0, 0, 0, 0, end.Location()).AddDate(0, 1, -1)
+
+	var schedules []models.Schedule
+	if err := db.Select("date").Where("user_id = ? AND date BETWEEN ? AND ?", userID, monthStart, monthEnd).
+		Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	scheduledDays := map[string]bool{}
+	scheduledMonths := map[string]bool{}
+	for _, s := range schedules {
+		scheduledDays[dateKey(s.Date)] = true
+		scheduledMonths[s.Date.Format("2006-01")] = true
+	}
+
+	calendar, err := loadBusinessCalendar(db, userID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var days []time.Time
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		switch {
+		case scheduledDays[dateKey(d)]:
+			days = append(days, d)
+		case scheduledMonths[d.Format("2006-01")]:
+		default:
+			if status, _ := calendar.status(d); status == dayWorking {
+				days = append(days, d)
+			}
+		}
+	}
+	return days, nil
+}
+
+// chargeableLeaveDays is the number of leave days to charge for a whole-day
+// leave from start to end.
+func chargeableLeaveDays(db *gorm.DB, userID uint, start, end time.Time) (float64, error) {
+	days, err := userWorkingDays(db, userID, start, end)
+	return float64(len(days)), err
+}
+
+// isWorkingDay reports whether the user is expected to work on day.
+func isWorkingDay(db *gorm.DB, userID uint, day time.Time) (bool, error) {
+	days, err := userWorkingDays(db, userID, day, day)
+	return len(days) == 1, err
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+	"gorm.io/gorm"
+)
+
+type CalendarHandler struct {
+	db *gorm.DB
+}
+
+func NewCalendarHandler(db *gorm.DB) *CalendarHandler {
+	return &CalendarHandler{db: db}
+}
+
+type CreateHolidayRequest struct {
+	Date string `json:"date" validate:"required"` // YYYY-MM-DD
+	Name string `json:"name" validate:"required"`
+}
+
+func (h *CalendarHandler) GetHolidays(c echo.Context) error {
+	year, err := strconv.Atoi(c.QueryParam("year"))
+	if err != nil {
+		year = time.Now().Year()
+	}
+
+	start := time.Date(year, 1, 1, 0, 0, 0, 0, time.Local)
+	end := start.AddDate(1, 0, -1)
+
+	var holidays []models.Holiday
+	if err := h.db.Where("date BETWEEN ? AND ?", start, end).Order("date ASC").Find(&holidays).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve holidays")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": holidays,
+		"year": year,
+	})
+}
+
+func (h *CalendarHandler) CreateHoliday(c echo.Context) error {
+	var req CreateHolidayRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	date, err := parseLocalDate(req.Date)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid date format. Expected YYYY-MM-DD")
+	}
+	if req.Name == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Name is required")
+	}
+
+	var count int64
+	h.db.Model(&models.Holiday{}).Where("date = ?", date).Count(&count)
+	if count > 0 {
+		return echo.NewHTTPError(http.StatusConflict, "A holiday already exists on that date")
+	}
+
+	holiday := models.Holiday{Date: date, Name: req.Name}
+	if err := h.db.Create(&holiday).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create holiday")
+	}
+
+	return c.JSON(http.StatusCreated, holiday)
+}
+
+func (h *CalendarHandler) DeleteHoliday(c echo.Context) error {
+	holidayID, err := strconv.ParseUint(c.Param("holidayId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid holiday ID")
+	}
+
+	result := h.db.Delete(&models.Holiday{}, holidayID)
+	if result.Error != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete holiday")
+	}
+	if result.RowsAffected == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "Holiday not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/ical"
+	"github.com/yudai-uk/backend/models"
+	"gorm.io/gorm"
+)
+
+const (
+	feedUIDDomain = "attendance-app"
+	// Feeds cover a window around today so that they stay small.
+	feedPastMonths   = 3
+	feedFutureMonths = 12
+)
+
+type CalendarFeedHandler struct {
+	db *gorm.DB
+}
+
+func NewCalendarFeedHandler(db *gorm.DB) *CalendarFeedHandler {
+	return &CalendarFeedHandler{db: db}
+}
+
+type CreateCalendarFeedRequest struct {
+	Scope        models.CalendarFeedScope `json:"scope"` // personal (default) or team
+	DepartmentID *uint                    `json:"department_id"`
+	Label        string                   `json:"label"`
+}
+
+func hashFeedToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// canReadTeamFeed reports whether a user may subscribe to a department's
+// calendar: admins always, managers for departments they head.
+func canReadTeamFeed(db *gorm.DB, user *models.User, departmentID uint) (bool, error) {
+	switch user.Role {
+	case "admin":
+		return true, nil
+	case "manager":
+		managed, err := managedDepartmentIDs(db, user.ID)
+		if err != nil {
+			return false, err
+		}
+		for _, id := range managed {
+			if id == departmentID {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func feedURL(c echo.Context, token string) string {
+	base := strings.TrimSuffix(os.Getenv("PUBLIC_BASE_URL"), "/")
+	if base == "" {
+		base = c.Scheme() + "://" + c.Request().Host
+	}
+	return base + "/api/v1/feeds/" + token + ".ics"
+}
+
+func (h *CalendarFeedHandler) GetFeeds(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+
+	var feeds []models.CalendarFeedToken
+	if err := h.db.Preload("Department").Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("created_at DESC").Find(&feeds).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve calendar feeds")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": feeds,
+	})
+}
+
+// CreateFeed issues a new subscription URL. The secret is only returned in
+// this response.
+func (h *CalendarFeedHandler) CreateFeed(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+
+	var req CreateCalendarFeedRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	feed := models.CalendarFeedToken{UserID: userID, Scope: req.Scope, Label: req.Label}
+	switch req.Scope {
+	case "", models.CalendarFeedPersonal:
+		feed.Scope = models.CalendarFeedPersonal
+	case models.CalendarFeedTeam:
+		if req.DepartmentID == nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "department_id is required for team feeds")
+		}
+		var user models.User
+		if err := h.db.First(&user, userID).Error; err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve user")
+		}
+		ok, err := canReadTeamFeed(h.db, &user, *req.DepartmentID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+		}
+		if !ok {
+			return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+		}
+		feed.DepartmentID = req.DepartmentID
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "scope must be personal or team")
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to generate token")
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	feed.TokenHash = hashFeedToken(token)
+	feed.TokenPrefix = token[:8]
+
+	if err := h.db.Create(&feed).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create calendar feed")
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"feed":  feed,
+		"token": token,
+		"url":   feedURL(c, token),
+	})
+}
+
+// RevokeFeed disables a subscription URL immediately.
+func (h *CalendarFeedHandler) RevokeFeed(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+	userRole := c.Get("user_role").(string)
+
+	feedID, err := strconv.ParseUint(c.Param("feedId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid feed ID")
+	}
+
+	var feed models.CalendarFeedToken
+	if err := h.db.First(&feed, feedID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Calendar feed not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve calendar feed")
+	}
+	if feed.UserID != userID && userRole != "admin" {
+		return echo.NewHTTPError(http.StatusNotFound, "Calendar feed not found")
+	}
+
+	if feed.RevokedAt == nil {
+		now := time.Now()
+		feed.RevokedAt = &now
+		if err := h.db.Save(&feed).Error; err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to revoke calendar feed")
+		}
+	}
+
+	return c.JSON(http.StatusOK, feed)
+}
+
+// ServeFeed renders the ICS document for a token. It is mounted outside the
+// JWT group: the token in the URL is the credential.
+func (h *CalendarFeedHandler) ServeFeed(c echo.Context) error {
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+
+	var feed models.CalendarFeedToken
+	if err := h.db.Preload("User").Where("token_hash = ? AND revoked_at IS NULL", hashFeedToken(token)).
+		First(&feed).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Calendar feed not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve calendar feed")
+	}
+
+	now := time.Now()
+	start := truncateDate(now).AddDate(0, -feedPastMonths, 0)
+	end := truncateDate(now).AddDate(0, feedFutureMonths, 0)
+	english := c.QueryParam("lang") == "en"
+
+	userIDs := []uint{feed.UserID}
+	name := feed.User.Name
+	if feed.Scope == models.CalendarFeedTeam {
+		// Access is re-checked on every fetch so that a manager who moves on
+		// loses the feed without anyone revoking it.
+		if feed.DepartmentID == nil {
+			return echo.NewHTTPError(http.StatusNotFound, "Calendar feed not found")
+		}
+		ok, err := canReadTeamFeed(h.db, &feed.User, *feed.DepartmentID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+		}
+		if !ok {
+			return echo.NewHTTPError(http.StatusNotFound, "Calendar feed not found")
+		}
+		departmentIDs, err := departmentSubtree(h.db, []uint{*feed.DepartmentID})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve team")
+		}
+		userIDs = nil
+		if err := h.db.Model(&models.User{}).Where("department_id IN ?", departmentIDs).
+			Pluck("id", &userIDs).Error; err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve team")
+		}
+		var department models.Department
+		if err := h.db.First(&department, *feed.DepartmentID).Error; err == nil {
+			name = department.Name
+		}
+	}
+
+	cal, err := h.buildCalendar(userIDs, feed.Scope == models.CalendarFeedTeam, start, end, english)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to build calendar feed")
+	}
+	cal.Name = name
+
+	h.db.Model(&feed).Update("last_used_at", now)
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, "text/calendar; charset=utf-8")
+	header.Set("Content-Disposition", `inline; filename="calendar.ics"`)
+	header.Set("Cache-Control", "private, max-age=900")
+	c.Response().WriteHeader(http.StatusOK)
+	_, err = cal.WriteTo(c.Response())
+	return err
+}
+
+func (h *CalendarFeedHandler) buildCalendar(userIDs []uint, team bool, start, end time.Time, english bool) (*ical.Calendar, error) {
+	cal := &ical.Calendar{ProdID: "-//attendance-app//calendar feed//EN"}
+	if len(userIDs) == 0 {
+		return cal, nil
+	}
+
+	// Feeds leave the building, so they only carry published schedules.
+	schedules, err := publishedSchedules(h.db, userIDs, start, end)
+	if err != nil {
+		return nil, err
+	}
+	var leaves []models.Leave
+	if err := h.db.Preload("User").Where("user_id IN ? AND status IN ? AND start_date <= ? AND end_date >= ?",
+		userIDs, models.EffectiveLeaveStatuses, end, start).Order("start_date ASC").Find(&leaves).Error; err != nil {
+		return nil, err
+	}
+	var types []models.LeaveTypeDefinition
+	if err := h.db.Unscoped().Find(&types).Error; err != nil {
+		return nil, err
+	}
+	typeNames := map[models.LeaveType]string{}
+	for _, t := range types {
+		typeNames[t.Code] = t.NameJa
+		if english {
+			typeNames[t.Code] = t.NameEn
+		}
+	}
+
+	prefix := func(u models.User) string {
+		if team {
+			return u.Name + ": "
+		}
+		return ""
+	}
+
+	for _, s := range schedules {
+		endTime := s.EndTime
+		if !endTime.After(s.StartTime) {
+			endTime = endTime.Add(24 * time.Hour) // overnight shift
+		}
+		cal.Events = append(cal.Events, ical.Event{
+			UID:         fmt.Sprintf("schedule-%d@%s", s.ID, feedUIDDomain),
+			Summary:     prefix(s.User) + localized(english, "勤務", "Shift"),
+			Description: s.Note,
+			Start:       s.StartTime,
+			End:         endTime,
+			Stamp:       s.UpdatedAt,
+			Status:      "CONFIRMED",
+		})
+	}
+
+	for _, l := range leaves {
+		name := typeNames[l.Type]
+		if name == "" {
+			name = string(l.Type)
+		}
+		event := ical.Event{
+			UID:     fmt.Sprintf("leave-%d@%s", l.ID, feedUIDDomain),
+			Summary: prefix(l.User) + name,
+			Stamp:   l.UpdatedAt,
+			Status:  "CONFIRMED",
+			AllDay:  true,
+			Start:   truncateDate(l.StartDate),
+			End:     truncateDate(l.EndDate).AddDate(0, 0, 1),
+		}
+		switch l.Unit {
+		case models.LeaveUnitAMHalf:
+			event.Summary += localized(english, "（午前）", " (AM)")
+		case models.LeaveUnitPMHalf:
+			event.Summary += localized(english, "（午後）", " (PM)")
+		case models.LeaveUnitHours:
+			if l.StartTime != nil && l.EndTime != nil {
+				day := l.StartDate
+				event.AllDay = false
+				event.Start = time.Date(day.Year(), day.Month(), day.Day(),
+					l.StartTime.Hour(), l.StartTime.Minute(), 0, 0, l.StartTime.Location())
+				event.End = time.Date(day.Year(), day.Month(), day.Day(),
+					l.EndTime.Hour(), l.EndTime.Minute(), 0, 0, l.EndTime.Location())
+			}
+		}
+		cal.Events = append(cal.Events, event)
+	}
+	return cal, nil
+}
+
+func localized(english bool, ja, en string) string {
+	if english {
+		return en
+	}
+	return ja
+}
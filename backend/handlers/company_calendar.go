@@ -0,0 +1,448 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CompanyCalendarHandler struct {
+	db *gorm.DB
+}
+
+func NewCompanyCalendarHandler(db *gorm.DB) *CompanyCalendarHandler {
+	return &CompanyCalendarHandler{db: db}
+}
+
+type CompanyCalendarRequest struct {
+	Name             string `json:"name" validate:"required"`
+	RestWeekdays     []int  `json:"rest_weekdays"`     // 0 = Sunday
+	StatutoryWeekday *int   `json:"statutory_weekday"` // must be one of rest_weekdays
+	OpenOnHolidays   bool   `json:"open_on_holidays"`
+	IsDefault        bool   `json:"is_default"`
+}
+
+type CalendarDayRequest struct {
+	Date string                 `json:"date" validate:"required"` // YYYY-MM-DD
+	Kind models.CalendarDayKind `json:"kind" validate:"required"` // closure, working or statutory_holiday
+	Name string                 `json:"name"`
+}
+
+type LocationRequest struct {
+	Name       string `json:"name" validate:"required"`
+	CalendarID *uint  `json:"calendar_id"`
+}
+
+type UserLocationRequest struct {
+	LocationID *uint `json:"location_id"` // null to remove
+}
+
+// BusinessDay is one resolved day of a company calendar.
+type BusinessDay struct {
+	Date    string    `json:"date"`
+	Status  dayStatus `json:"status"`
+	Working bool      `json:"working"`
+	Name    string    `json:"name,omitempty"`
+}
+
+func (h *CompanyCalendarHandler) GetCalendars(c echo.Context) error {
+	var calendars []models.CompanyCalendar
+	if err := h.db.Order("id ASC").Find(&calendars).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve calendars")
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": calendars,
+	})
+}
+
+// GetCalendar returns a calendar with its dated overrides for a year
+// (default: the current one).
+func (h *CompanyCalendarHandler) GetCalendar(c echo.Context) error {
+	calendarID, err := strconv.ParseUint(c.Param("calendarId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid calendar ID")
+	}
+	year, err := strconv.Atoi(c.QueryParam("year"))
+	if err != nil {
+		year = time.Now().Year()
+	}
+	start := time.Date(year, 1, 1, 0, 0, 0, 0, time.Local)
+
+	var calendar models.CompanyCalendar
+	if err := h.db.Preload("Days", func(db *gorm.DB) *gorm.DB {
+		return db.Where("date >= ? AND date < ?", start, start.AddDate(1, 0, 0)).Order("date ASC")
+	}).First(&calendar, calendarID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Calendar not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve calendar")
+	}
+	return c.JSON(http.StatusOK, calendar)
+}
+
+// GetBusinessDays resolves each day of a month on the calendar that applies
+// to the caller, or to user_id when it is in the caller's scope.
+func (h *CompanyCalendarHandler) GetBusinessDays(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+
+	start, end, err := monthRange(c.QueryParam("month"))
+	if err != nil {
+		return err
+	}
+	if requested := c.QueryParam("user_id"); requested != "" {
+		id, err := strconv.ParseUint(requested, 10, 32)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid user_id parameter")
+		}
+		scope, err := scopeFor(c, h.db)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+		}
+		if !scope.contains(uint(id)) {
+			return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+		}
+		userID = uint(id)
+	}
+
+	calendar, err := loadBusinessCalendar(h.db, userID, start, end)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to load the company calendar")
+	}
+
+	days := []BusinessDay{}
+	working := 0
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		status, name := calendar.status(d)
+		if status == dayWorking {
+			working++
+		}
+		days = append(days, BusinessDay{Date: dateKey(d), Status: status, Working: status == dayWorking, Name: name})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"calendar":     calendar.calendar,
+		"month":        c.QueryParam("month"),
+		"working_days": working,
+		"data":         days,
+	})
+}
+
+func (h *CompanyCalendarHandler) CreateCalendar(c echo.Context) error {
+	var req CompanyCalendarRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	var calendar models.CompanyCalendar
+	if err := applyCompanyCalendar(&calendar, &req); err != nil {
+		return err
+	}
+	if err := h.saveCalendar(&calendar); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, calendar)
+}
+
+func (h *CompanyCalendarHandler) UpdateCalendar(c echo.Context) error {
+	calendarID, err := strconv.ParseUint(c.Param("calendarId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid calendar ID")
+	}
+	var req CompanyCalendarRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	var calendar models.CompanyCalendar
+	if err := h.db.First(&calendar, calendarID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Calendar not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve calendar")
+	}
+	if err := applyCompanyCalendar(&calendar, &req); err != nil {
+		return err
+	}
+	if err := h.saveCalendar(&calendar); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, calendar)
+}
+
+// saveCalendar stores calendar, making it the only default when flagged.
+func (h *CompanyCalendarHandler) saveCalendar(calendar *models.CompanyCalendar) error {
+	var count int64
+	h.db.Model(&models.CompanyCalendar{}).Where("name = ? AND id != ?", calendar.Name, calendar.ID).Count(&count)
+	if count > 0 {
+		return echo.NewHTTPError(http.StatusConflict, "A calendar with this name already exists")
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if calendar.IsDefault {
+			if err := tx.Model(&models.CompanyCalendar{}).Where("is_default = ? AND id != ?", true, calendar.ID).
+				Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(calendar).Error
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to save calendar")
+	}
+	return nil
+}
+
+func applyCompanyCalendar(calendar *models.CompanyCalendar, req *CompanyCalendarRequest) error {
+	if strings.TrimSpace(req.Name) == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Name is required")
+	}
+	seen := map[int]bool{}
+	var parts []string
+	for _, w := range req.RestWeekdays {
+		if w < 0 || w > 6 {
+			return echo.NewHTTPError(http.StatusBadRequest, "rest_weekdays must be between 0 (Sunday) and 6 (Saturday)")
+		}
+		if !seen[w] {
+			seen[w] = true
+			parts = append(parts, strconv.Itoa(w))
+		}
+	}
+	if req.StatutoryWeekday != nil && !seen[*req.StatutoryWeekday] {
+		return echo.NewHTTPError(http.StatusBadRequest, "statutory_weekday must be one of rest_weekdays")
+	}
+
+	calendar.Name = strings.TrimSpace(req.Name)
+	calendar.RestWeekdays = strings.Join(parts, ",")
+	calendar.StatutoryWeekday = req.StatutoryWeekday
+	calendar.OpenOnHolidays = req.OpenOnHolidays
+	calendar.IsDefault = req.IsDefault
+	return nil
+}
+
+// DeleteCalendar removes a calendar no location, department or work rule
+// uses.
+func (h *CompanyCalendarHandler) DeleteCalendar(c echo.Context) error {
+	calendarID, err := strconv.ParseUint(c.Param("calendarId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid calendar ID")
+	}
+
+	var locations, departments, rules int64
+	h.db.Model(&models.Location{}).Where("calendar_id = ?", calendarID).Count(&locations)
+	h.db.Model(&models.Department{}).Where("calendar_id = ?", calendarID).Count(&departments)
+	h.db.Model(&models.WorkRule{}).Where("calendar_id = ?", calendarID).Count(&rules)
+	if locations > 0 || departments > 0 || rules > 0 {
+		return echo.NewHTTPError(http.StatusConflict, "Calendar is still assigned to a location, department or work rule")
+	}
+
+	result := h.db.Delete(&models.CompanyCalendar{}, calendarID)
+	if result.Error != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete calendar")
+	}
+	if result.RowsAffected == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "Calendar not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// SetCalendarDay records or replaces the override for one date.
+func (h *CompanyCalendarHandler) SetCalendarDay(c echo.Context) error {
+	calendarID, err := strconv.ParseUint(c.Param("calendarId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid calendar ID")
+	}
+	var req CalendarDayRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	switch req.Kind {
+	case models.CalendarClosure, models.CalendarWorking, models.CalendarStatutory:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "kind must be closure, working or statutory_holiday")
+	}
+	day, err := parseLocalDate(req.Date)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid date format. Expected YYYY-MM-DD")
+	}
+
+	var count int64
+	h.db.Model(&models.CompanyCalendar{}).Where("id = ?", calendarID).Count(&count)
+	if count == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "Calendar not found")
+	}
+
+	entry := models.CompanyCalendarDay{CalendarID: uint(calendarID), Date: day, Kind: req.Kind, Name: req.Name}
+	if err := h.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "calendar_id"}, {Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"kind", "name", "updated_at"}),
+	}).Create(&entry).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to save calendar day")
+	}
+
+	h.db.Where("calendar_id = ? AND date = ?", calendarID, day).First(&entry)
+	return c.JSON(http.StatusOK, entry)
+}
+
+func (h *CompanyCalendarHandler) DeleteCalendarDay(c echo.Context) error {
+	calendarID, err := strconv.ParseUint(c.Param("calendarId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid calendar ID")
+	}
+	day, err := parseLocalDate(c.Param("date"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid date format. Expected YYYY-MM-DD")
+	}
+
+	result := h.db.Where("calendar_id = ? AND date = ?", calendarID, day).Delete(&models.CompanyCalendarDay{})
+	if result.Error != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete calendar day")
+	}
+	if result.RowsAffected == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "Calendar day not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *CompanyCalendarHandler) GetLocations(c echo.Context) error {
+	var locations []models.Location
+	if err := h.db.Preload("Calendar").Order("id ASC").Find(&locations).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve locations")
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": locations,
+	})
+}
+
+func (h *CompanyCalendarHandler) CreateLocation(c echo.Context) error {
+	var req LocationRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	var location models.Location
+	if err := h.applyLocation(&location, &req); err != nil {
+		return err
+	}
+	if err := h.db.Create(&location).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create location")
+	}
+
+	return c.JSON(http.StatusCreated, location)
+}
+
+func (h *CompanyCalendarHandler) UpdateLocation(c echo.Context) error {
+	locationID, err := strconv.ParseUint(c.Param("locationId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid location ID")
+	}
+	var req LocationRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	var location models.Location
+	if err := h.db.First(&location, locationID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Location not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve location")
+	}
+	if err := h.applyLocation(&location, &req); err != nil {
+		return err
+	}
+	if err := h.db.Save(&location).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update location")
+	}
+
+	return c.JSON(http.StatusOK, location)
+}
+
+func (h *CompanyCalendarHandler) applyLocation(location *models.Location, req *LocationRequest) error {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Name is required")
+	}
+	var count int64
+	h.db.Model(&models.Location{}).Where("name = ? AND id != ?", name, location.ID).Count(&count)
+	if count > 0 {
+		return echo.NewHTTPError(http.StatusConflict, "A location with this name already exists")
+	}
+	if req.CalendarID != nil {
+		h.db.Model(&models.CompanyCalendar{}).Where("id = ?", *req.CalendarID).Count(&count)
+		if count == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Calendar not found")
+		}
+	}
+	location.Name = name
+	location.CalendarID = req.CalendarID
+	return nil
+}
+
+// DeleteLocation removes a location nobody is assigned to.
+func (h *CompanyCalendarHandler) DeleteLocation(c echo.Context) error {
+	locationID, err := strconv.ParseUint(c.Param("locationId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid location ID")
+	}
+
+	var members int64
+	h.db.Model(&models.User{}).Where("location_id = ?", locationID).Count(&members)
+	if members > 0 {
+		return echo.NewHTTPError(http.StatusConflict, "Location still has members")
+	}
+
+	result := h.db.Delete(&models.Location{}, locationID)
+	if result.Error != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete location")
+	}
+	if result.RowsAffected == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "Location not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// UpdateUserLocation assigns a user to a location, or removes them from it.
+func (h *CompanyCalendarHandler) UpdateUserLocation(c echo.Context) error {
+	userID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+	var req UserLocationRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "User not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve user")
+	}
+	if req.LocationID != nil {
+		var count int64
+		h.db.Model(&models.Location{}).Where("id = ?", *req.LocationID).Count(&count)
+		if count == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Location not found")
+		}
+	}
+
+	user.LocationID = req.LocationID
+	if err := h.db.Model(&user).Select("location_id").Updates(&user).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update user")
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"os"
+	"strconv"
+)
+
+// envInt reads an integer setting from the environment, falling back when
+// it is unset or malformed.
+func envInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DelegationHandler struct {
+	db *gorm.DB
+}
+
+func NewDelegationHandler(db *gorm.DB) *DelegationHandler {
+	return &DelegationHandler{db: db}
+}
+
+type CreateDelegationRequest struct {
+	DelegateID uint   `json:"delegate_id" validate:"required"`
+	StartDate  string `json:"start_date" validate:"required"` // YYYY-MM-DD
+	EndDate    string `json:"end_date" validate:"required"`   // YYYY-MM-DD
+	Reason     string `json:"reason"`
+}
+
+// approvalPrincipal is someone the caller may decide approvals as: the caller
+// themselves, or a manager who has delegated to them.
+type approvalPrincipal struct {
+	userID uint
+	role   string
+	scope  userScope
+}
+
+// approvalPrincipals returns the caller followed by every manager with an
+// active delegation to the caller today.
+func approvalPrincipals(db *gorm.DB, actorID uint, actorRole string) ([]approvalPrincipal, error) {
+	scope, err := resolveUserScope(db, actorID, actorRole)
+	if err != nil {
+		return nil, err
+	}
+	principals := []approvalPrincipal{{userID: actorID, role: actorRole, scope: scope}}
+
+	today := time.Now()
+	var delegations []models.ApprovalDelegation
+	if err := db.Preload("Manager").
+		Where("delegate_id = ? AND revoked_at IS NULL AND start_date <= ? AND end_date >= ?",
+			actorID, today, truncateDate(today)).
+		Find(&delegations).Error; err != nil {
+		return nil, err
+	}
+	for _, d := range delegations {
+		if !d.ActiveOn(today) || d.ManagerID == actorID {
+			continue
+		}
+		managerScope, err := resolveUserScope(db, d.ManagerID, d.Manager.Role)
+		if err != nil {
+			return nil, err
+		}
+		principals = append(principals, approvalPrincipal{userID: d.ManagerID, role: d.Manager.Role, scope: managerScope})
+	}
+	return principals, nil
+}
+
+// principalForStep picks the first principal allowed to decide step on a
+// request filed by requesterID. Nobody may decide their own request.
+func principalForStep(principals []approvalPrincipal, step *models.ApprovalStep, requesterID uint) *approvalPrincipal {
+	for i := range principals {
+		p := &principals[i]
+		if p.userID == requesterID && p.role != "admin" {
+			continue
+		}
+		if canActOnStep(step, p.userID, p.role, p.scope.contains(requesterID)) {
+			return p
+		}
+	}
+	return nil
+}
+
+func (h *DelegationHandler) GetDelegations(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+	userRole := c.Get("user_role").(string)
+
+	query := h.db.Preload("Manager").Preload("Delegate").Order("start_date DESC")
+	if userRole != "admin" {
+		query = query.Where("manager_id = ? OR delegate_id = ?", userID, userID)
+	}
+	if c.QueryParam("active") == "true" {
+		today := time.Now()
+		query = query.Where("revoked_at IS NULL AND start_date <= ? AND end_date >= ?", today, truncateDate(today))
+	}
+
+	var delegations []models.ApprovalDelegation
+	if err := query.Find(&delegations).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve delegations")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": delegations,
+	})
+}
+
+// CreateDelegation registers a delegate for the caller's approvals.
+func (h *DelegationHandler) CreateDelegation(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+
+	var req CreateDelegationRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	startDate, err := parseLocalDate(req.StartDate)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid start_date format. Expected YYYY-MM-DD")
+	}
+	endDate, err := parseLocalDate(req.EndDate)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid end_date format. Expected YYYY-MM-DD")
+	}
+	if startDate.After(endDate) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Start date must be before end date")
+	}
+	if req.DelegateID == 0 || req.DelegateID == userID {
+		return echo.NewHTTPError(http.StatusBadRequest, "delegate_id must be another user")
+	}
+
+	var delegate models.User
+	if err := h.db.First(&delegate, req.DelegateID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Delegate not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve delegate")
+	}
+
+	delegation := models.ApprovalDelegation{
+		ManagerID:  userID,
+		DelegateID: req.DelegateID,
+		StartDate:  startDate,
+		EndDate:    endDate,
+		Reason:     req.Reason,
+	}
+	if err := h.db.Create(&delegation).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create delegation")
+	}
+	delegation.Delegate = delegate
+
+	return c.JSON(http.StatusCreated, delegation)
+}
+
+// RevokeDelegation ends a delegation early. Decisions already made stay recorded.
+func (h *DelegationHandler) RevokeDelegation(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+	userRole := c.Get("user_role").(string)
+
+	delegationID, err := strconv.ParseUint(c.Param("delegationId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid delegation ID")
+	}
+
+	var delegation models.ApprovalDelegation
+	if err := h.db.First(&delegation, delegationID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Delegation not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve delegation")
+	}
+	if delegation.ManagerID != userID && userRole != "admin" {
+		return echo.NewHTTPError(http.StatusNotFound, "Delegation not found")
+	}
+	if delegation.RevokedAt != nil {
+		return c.JSON(http.StatusOK, delegation)
+	}
+
+	now := time.Now()
+	delegation.RevokedAt = &now
+	if err := h.db.Save(&delegation).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to revoke delegation")
+	}
+
+	return c.JSON(http.StatusOK, delegation)
+}
+
+// EscalateApprovals runs one escalation pass immediately.
+func (h *DelegationHandler) EscalateApprovals(c echo.Context) error {
+	count, err := EscalateStaleApprovals(h.db, approvalEscalationThreshold(), time.Now())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to escalate approvals")
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"escalated": count,
+	})
+}
+
+// approvalEscalationThreshold is how long a step may wait before it is
+// routed elsewhere.
+func approvalEscalationThreshold() time.Duration {
+	return time.Duration(envInt("APPROVAL_ESCALATION_HOURS", 72)) * time.Hour
+}
+
+// EscalateStaleApprovals reassigns every pending approval step that has
+// waited longer than threshold: to an active delegate of its approver when
+// there is one, otherwise to the approver's own line manager. The step's
+// clock restarts so that it keeps climbing if still ignored. Each leave is
+// locked as UpdateLeaveStatus locks it, so a decision made meanwhile is
+// never overwritten.
+func EscalateStaleApprovals(db *gorm.DB, threshold time.Duration, now time.Time) (int, error) {
+	var leaveIDs []uint
+	if err := db.Model(&models.Leave{}).Where("status = ?", models.LeavePending).Pluck("id", &leaveIDs).Error; err != nil {
+		return 0, err
+	}
+
+	escalated := 0
+	for _, leaveID := range leaveIDs {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var leave models.Leave
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&leave, leaveID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return nil
+				}
+				return err
+			}
+			if leave.Status != models.LeavePending {
+				return nil
+			}
+			var steps []models.ApprovalStep
+			if err := tx.Where("request_type = ? AND request_id = ?", models.ApprovalRequestLeave, leave.ID).
+				Order("step_order ASC").Find(&steps).Error; err != nil {
+				return err
+			}
+			step := firstPendingStep(steps)
+			if step == nil || step.ActivatedAt == nil || now.Sub(*step.ActivatedAt) < threshold {
+				return nil
+			}
+
+			current, err := stepOwner(tx, step, &leave)
+			if err != nil || current == nil {
+				return err
+			}
+			target, err := escalationTarget(tx, *current, now)
+			if err != nil || target == nil || *target == leave.UserID {
+				return err
+			}
+
+			result := tx.Model(&models.ApprovalStep{}).
+				Where("id = ? AND decision = ?", step.ID, models.ApprovalPending).
+				Updates(map[string]interface{}{
+					"escalated_from":   *current,
+					"escalated_at":     now,
+					"activated_at":     now,
+					"approver_kind":    models.ApproverUser,
+					"approver_user_id": *target,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			escalated += int(result.RowsAffected)
+			return nil
+		})
+		if err != nil {
+			return escalated, err
+		}
+	}
+	return escalated, nil
+}
+
+// stepOwner is the person currently expected to decide step. Role-based
+// steps are attributed to the requester's line manager.
+func stepOwner(db *gorm.DB, step *models.ApprovalStep, leave *models.Leave) (*uint, error) {
+	if step.ApproverUserID != nil {
+		return step.ApproverUserID, nil
+	}
+	var requester models.User
+	if err := db.First(&requester, leave.UserID).Error; err != nil {
+		return nil, err
+	}
+	return lineManagerOf(db, &requester)
+}
+
+func escalationTarget(db *gorm.DB, approverID uint, now time.Time) (*uint, error) {
+	var delegations []models.ApprovalDelegation
+	if err := db.Where("manager_id = ? AND revoked_at IS NULL", approverID).
+		Order("start_date DESC").Find(&delegations).Error; err != nil {
+		return nil, err
+	}
+	for _, d := range delegations {
+		if d.ActiveOn(now) {
+			return &d.DelegateID, nil
+		}
+	}
+
+	var approver models.User
+	if err := db.First(&approver, approverID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return lineManagerOf(db, &approver)
+}
+
+// StartApprovalEscalation runs EscalateStaleApprovals every interval until
+// the process exits.
+func StartApprovalEscalation(db *gorm.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			count, err := EscalateStaleApprovals(db, approvalEscalationThreshold(), now)
+			if err != nil {
+				log.Printf("approval escalation failed: %v", err)
+				continue
+			}
+			if count > 0 {
+				log.Printf("escalated %d approval steps", count)
+			}
+		}
+	}()
+}
@@ -0,0 +1,516 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+	"gorm.io/gorm"
+)
+
+var errCompensatoryNotOpen = errors.New("compensatory day already taken or expired")
+
+type HolidayWorkHandler struct {
+	db *gorm.DB
+}
+
+func NewHolidayWorkHandler(db *gorm.DB) *HolidayWorkHandler {
+	return &HolidayWorkHandler{db: db}
+}
+
+type CreateHolidayWorkRequest struct {
+	UserID         uint                          `json:"user_id" validate:"required"`
+	WorkDate       string                        `json:"work_date" validate:"required"` // YYYY-MM-DD
+	Kind           models.HolidayWorkKind        `json:"kind"`                          // defaults from the weekday
+	Arrangement    models.HolidayWorkArrangement `json:"arrangement" validate:"required"`
+	SubstituteDate string                        `json:"substitute_date"` // substitute only
+	ExpiresAt      string                        `json:"expires_at"`      // compensatory only
+	Note           string                        `json:"note"`
+}
+
+// HolidayWorkSummary splits a month's holiday work the way payroll needs it.
+// Substituted days are ordinary working days and carry no holiday premium.
+type HolidayWorkSummary struct {
+	StatutoryDays         int     `json:"statutory_days"`
+	StatutoryHours        string  `json:"statutory_hours"`
+	NonStatutoryDays      int     `json:"non_statutory_days"`
+	NonStatutoryHours     string  `json:"non_statutory_hours"`
+	SubstitutedDays       int     `json:"substituted_days"`
+	SubstitutedHours      string  `json:"substituted_hours"`
+	CompensatoryDaysTaken float64 `json:"compensatory_days_taken"`
+}
+
+// compensatoryExpiryDays is how long a compensatory day may be kept.
+func compensatoryExpiryDays() int {
+	return envInt("COMPENSATORY_EXPIRY_DAYS", 60)
+}
+
+// companyDayOff reports whether day is off on the user's company calendar,
+// and whether it is their statutory holiday.
+func companyDayOff(db *gorm.DB, userID uint, day time.Time) (bool, bool, error) {
+	calendar, err := loadBusinessCalendar(db, userID, day, day)
+	if err != nil {
+		return false, false, err
+	}
+	status, _ := calendar.status(day)
+	return status != dayWorking, status == dayStatutoryHoliday, nil
+}
+
+// expireCompensatoryDays writes off open compensatory days whose expiry has
+// passed, for the given users or everyone when none are given.
+func expireCompensatoryDays(tx *gorm.DB, now time.Time, userIDs ...uint) (int, error) {
+	query := tx.Where("arrangement = ? AND status = ? AND expires_at < ?",
+		models.HolidayWorkCompensatory, models.CompensatoryOpen, truncateDate(now))
+	if len(userIDs) > 0 {
+		query = query.Where("user_id IN ?", userIDs)
+	}
+	var works []models.HolidayWork
+	if err := query.Order("expires_at ASC").Find(&works).Error; err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for i := range works {
+		w := &works[i]
+		// Flip the status first so that a concurrent run which read the
+		// same row finds nothing to do and does not debit the day twice.
+		result := tx.Model(&models.HolidayWork{}).Where("id = ? AND status = ?", w.ID, models.CompensatoryOpen).
+			Update("status", models.CompensatoryExpired)
+		if result.Error != nil {
+			return expired, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		entry := models.LeaveBalanceTransaction{
+			UserID:        w.UserID,
+			LeaveType:     models.LeaveTypeCompensatory,
+			Kind:          models.LeaveTxExpire,
+			Days:          -1,
+			EffectiveDate: *w.ExpiresAt,
+			Note:          fmt.Sprintf("Compensatory day for %s expired", dateKey(w.WorkDate)),
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return expired, err
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+// takeCompensatoryDays links an approved compensatory leave to the open
+// holiday work it uses up, oldest expiry first.
+func takeCompensatoryDays(tx *gorm.DB, leave *models.Leave) error {
+	var works []models.HolidayWork
+	if err := tx.Where("user_id = ? AND arrangement = ? AND status = ?",
+		leave.UserID, models.HolidayWorkCompensatory, models.CompensatoryOpen).
+		Order("expires_at ASC, work_date ASC").Find(&works).Error; err != nil {
+		return err
+	}
+	need := leave.Days
+	for i := 0; i < len(works) && need > 0; i++ {
+		works[i].Status = models.CompensatoryTaken
+		works[i].LeaveID = &leave.ID
+		if err := tx.Save(&works[i]).Error; err != nil {
+			return err
+		}
+		need--
+	}
+	return nil
+}
+
+// releaseCompensatoryDays reopens the holiday work a cancelled compensatory
+// leave had used. Days past their expiry are written off again by the next
+// expiry run.
+func releaseCompensatoryDays(tx *gorm.DB, leave *models.Leave) error {
+	return tx.Model(&models.HolidayWork{}).
+		Where("leave_id = ? AND arrangement = ?", leave.ID, models.HolidayWorkCompensatory).
+		Updates(map[string]interface{}{"status": models.CompensatoryOpen, "leave_id": nil}).Error
+}
+
+// expireAllCompensatoryDays runs expireCompensatoryDays for each user with
+// a day past its expiry, under the same user lock as leave approval.
+func expireAllCompensatoryDays(db *gorm.DB, now time.Time) (int, error) {
+	var userIDs []uint
+	if err := db.Model(&models.HolidayWork{}).Distinct("user_id").
+		Where("arrangement = ? AND status = ? AND expires_at < ?",
+			models.HolidayWorkCompensatory, models.CompensatoryOpen, truncateDate(now)).
+		Order("user_id ASC").Pluck("user_id", &userIDs).Error; err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, id := range userIDs {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := lockUser(tx, id); err != nil {
+				return err
+			}
+			count, err := expireCompensatoryDays(tx, now, id)
+			total += count
+			return err
+		})
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// StartCompensatoryExpiry runs expireAllCompensatoryDays every interval
+// until the process exits.
+func StartCompensatoryExpiry(db *gorm.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			count, err := expireAllCompensatoryDays(db, now)
+			if err != nil {
+				log.Printf("compensatory day expiry failed: %v", err)
+				continue
+			}
+			if count > 0 {
+				log.Printf("expired %d compensatory days", count)
+			}
+		}
+	}()
+}
+
+// summarizeHolidayWork totals a user's holiday work for a month, taking the
+// hours from the attendance recorded on each work date.
+func summarizeHolidayWork(works []models.HolidayWork, attendances []models.Attendance, leaves []models.Leave, rules *workRules, start, end time.Time) (HolidayWorkSummary, error) {
+	hoursOn := map[string]float64{}
+	for i := range attendances {
+		rule, err := rules.at(attendances[i].UserID, attendances[i].Date)
+		if err != nil {
+			return HolidayWorkSummary{}, err
+		}
+		hoursOn[dateKey(attendances[i].Date)] += attendances[i].WorkingHours(rule)
+	}
+
+	var summary HolidayWorkSummary
+	var statutory, nonStatutory, substituted float64
+	for _, w := range works {
+		hours := hoursOn[dateKey(w.WorkDate)]
+		switch {
+		case w.Arrangement == models.HolidayWorkSubstitute:
+			summary.SubstitutedDays++
+			substituted += hours
+		case w.Kind == models.HolidayWorkStatutory:
+			summary.StatutoryDays++
+			statutory += hours
+		default:
+			summary.NonStatutoryDays++
+			nonStatutory += hours
+		}
+	}
+	for _, l := range leaves {
+		if l.Type == models.LeaveTypeCompensatory && !l.StartDate.Before(start) && !l.StartDate.After(end) {
+			summary.CompensatoryDaysTaken += l.Days
+		}
+	}
+	summary.StatutoryHours = fmt.Sprintf("%.2f", statutory)
+	summary.NonStatutoryHours = fmt.Sprintf("%.2f", nonStatutory)
+	summary.SubstitutedHours = fmt.Sprintf("%.2f", substituted)
+	return summary, nil
+}
+
+// GetHolidayWorks lists holiday work records. Employees see their own;
+// managers and admins see everyone in scope.
+func (h *HolidayWorkHandler) GetHolidayWorks(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+	userRole := c.Get("user_role").(string)
+
+	query := h.db.Preload("User").Preload("Leave").Order("work_date DESC")
+	if userRole == "admin" || userRole == "manager" {
+		scope, err := resolveUserScope(h.db, userID, userRole)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+		}
+		query = scope.apply(query, "user_id")
+		if requestUserID := c.QueryParam("user_id"); requestUserID != "" {
+			query = query.Where("user_id = ?", requestUserID)
+		}
+	} else {
+		query = query.Where("user_id = ?", userID)
+	}
+	if month := c.QueryParam("month"); month != "" {
+		start, end, err := monthRange(month)
+		if err != nil {
+			return err
+		}
+		query = query.Where("work_date BETWEEN ? AND ?", start, end)
+	}
+
+	var works []models.HolidayWork
+	if err := query.Find(&works).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve holiday work")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": works,
+	})
+}
+
+// CreateHolidayWork records work on a day off together with how the day off
+// is given back: a substitute day designated now, a compensatory day
+// credited to the user's balance, or nothing beyond the premium.
+func (h *HolidayWorkHandler) CreateHolidayWork(c echo.Context) error {
+	actorID := c.Get("user_id").(uint)
+	userRole := c.Get("user_role").(string)
+
+	var req CreateHolidayWorkRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	scope, err := resolveUserScope(h.db, actorID, userRole)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+	if !scope.contains(req.UserID) || req.UserID == actorID && userRole != "admin" {
+		return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+	}
+
+	workDate, err := parseLocalDate(req.WorkDate)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid work_date format. Expected YYYY-MM-DD")
+	}
+	if err := requireOpenPeriod(h.db, workDate, workDate); err != nil {
+		return err
+	}
+	dayOff, statutory, err := companyDayOff(h.db, req.UserID, workDate)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to check the company calendar")
+	}
+	if !dayOff {
+		return echo.NewHTTPError(http.StatusBadRequest, "work_date is not a day off")
+	}
+
+	kind := req.Kind
+	switch kind {
+	case "":
+		kind = models.HolidayWorkNonStatutory
+		if statutory {
+			kind = models.HolidayWorkStatutory
+		}
+	case models.HolidayWorkStatutory, models.HolidayWorkNonStatutory:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "kind must be statutory or non_statutory")
+	}
+
+	var existing int64
+	h.db.Model(&models.HolidayWork{}).Where("user_id = ? AND work_date = ?", req.UserID, workDate).Count(&existing)
+	if existing > 0 {
+		return echo.NewHTTPError(http.StatusConflict, "Holiday work is already recorded for this day")
+	}
+
+	work := models.HolidayWork{
+		UserID:      req.UserID,
+		WorkDate:    workDate,
+		Kind:        kind,
+		Arrangement: req.Arrangement,
+		Note:        req.Note,
+		CreatedBy:   actorID,
+	}
+
+	now := time.Now()
+	switch req.Arrangement {
+	case models.HolidayWorkSubstitute:
+		err = h.createSubstitute(&work, req.SubstituteDate, actorID, now)
+	case models.HolidayWorkCompensatory:
+		err = h.createCompensatory(&work, req.ExpiresAt, actorID)
+	case models.HolidayWorkPaidOnly:
+		err = h.db.Create(&work).Error
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "arrangement must be substitute, compensatory or none")
+	}
+	if err != nil {
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			return httpErr
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to record holiday work")
+	}
+
+	if err := h.db.Preload("User").Preload("Leave").First(&work, work.ID).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve holiday work")
+	}
+	return c.JSON(http.StatusCreated, work)
+}
+
+// createSubstitute designates the substitute day as an approved leave. A
+// substitution must be decided before the holiday is worked.
+func (h *HolidayWorkHandler) createSubstitute(work *models.HolidayWork, substituteDate string, actorID uint, now time.Time) error {
+	if work.WorkDate.Before(truncateDate(now)) {
+		return echo.NewHTTPError(http.StatusBadRequest, "A substitute holiday must be designated before the work date; record past work as compensatory")
+	}
+	day, err := parseLocalDate(substituteDate)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "substitute_date is required (YYYY-MM-DD)")
+	}
+	if err := requireOpenPeriod(h.db, day, day); err != nil {
+		return err
+	}
+	working, err := isWorkingDay(h.db, work.UserID, day)
+	if err != nil {
+		return err
+	}
+	if !working {
+		return echo.NewHTTPError(http.StatusBadRequest, "substitute_date must be a working day")
+	}
+
+	leave := models.Leave{
+		UserID:     work.UserID,
+		Type:       models.LeaveTypeSubstitute,
+		StartDate:  day,
+		EndDate:    day,
+		Unit:       models.LeaveUnitFull,
+		Days:       1,
+		Reason:     fmt.Sprintf("振替休日 (%s)", dateKey(work.WorkDate)),
+		Status:     models.LeaveApproved,
+		ApprovedBy: &actorID,
+		ApprovedAt: &now,
+	}
+	overlap, err := hasOverlappingLeave(h.db, &leave)
+	if err != nil {
+		return err
+	}
+	if overlap {
+		return echo.NewHTTPError(http.StatusConflict, "substitute_date overlaps existing leave")
+	}
+
+	return h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&leave).Error; err != nil {
+			return err
+		}
+		work.LeaveID = &leave.ID
+		return tx.Create(work).Error
+	})
+}
+
+// createCompensatory credits one compensatory day that expires after
+// COMPENSATORY_EXPIRY_DAYS unless an explicit expiry is given.
+func (h *HolidayWorkHandler) createCompensatory(work *models.HolidayWork, expiresAt string, actorID uint) error {
+	expiry := work.WorkDate.AddDate(0, 0, compensatoryExpiryDays())
+	if expiresAt != "" {
+		parsed, err := parseLocalDate(expiresAt)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid expires_at format. Expected YYYY-MM-DD")
+		}
+		if !parsed.After(work.WorkDate) {
+			return echo.NewHTTPError(http.StatusBadRequest, "expires_at must be after work_date")
+		}
+		expiry = parsed
+	}
+
+	return h.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockUser(tx, work.UserID); err != nil {
+			return err
+		}
+		grant := models.LeaveBalanceTransaction{
+			UserID:        work.UserID,
+			LeaveType:     models.LeaveTypeCompensatory,
+			Kind:          models.LeaveTxGrant,
+			Days:          1,
+			EffectiveDate: work.WorkDate,
+			ExpiresAt:     &expiry,
+			Note:          fmt.Sprintf("Compensatory day for %s", dateKey(work.WorkDate)),
+			CreatedBy:     &actorID,
+		}
+		if err := tx.Create(&grant).Error; err != nil {
+			return err
+		}
+		work.GrantID = &grant.ID
+		work.Status = models.CompensatoryOpen
+		work.ExpiresAt = &expiry
+		return tx.Create(work).Error
+	})
+}
+
+// DeleteHolidayWork withdraws a record whose day off has not been used:
+// the substitute leave is cancelled, or the compensatory credit reversed.
+func (h *HolidayWorkHandler) DeleteHolidayWork(c echo.Context) error {
+	actorID := c.Get("user_id").(uint)
+	userRole := c.Get("user_role").(string)
+
+	workID, err := strconv.ParseUint(c.Param("holidayWorkId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid holiday work ID")
+	}
+
+	scope, err := resolveUserScope(h.db, actorID, userRole)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+
+	now := time.Now()
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var work models.HolidayWork
+		if err := tx.First(&work, workID).Error; err != nil {
+			return err
+		}
+		if !scope.contains(work.UserID) {
+			return gorm.ErrRecordNotFound
+		}
+		if err := requireOpenPeriod(tx, work.WorkDate, work.WorkDate); err != nil {
+			return err
+		}
+		if err := lockUser(tx, work.UserID); err != nil {
+			return err
+		}
+
+		switch work.Arrangement {
+		case models.HolidayWorkSubstitute:
+			if work.LeaveID != nil {
+				var leave models.Leave
+				if err := tx.First(&leave, *work.LeaveID).Error; err != nil {
+					return err
+				}
+				if leave.StartDate.Before(truncateDate(now)) {
+					return errCompensatoryNotOpen
+				}
+				leave.Status = models.LeaveCancelled
+				leave.CancelledBy = &actorID
+				leave.CancelledAt = &now
+				if err := tx.Save(&leave).Error; err != nil {
+					return err
+				}
+			}
+		case models.HolidayWorkCompensatory:
+			if work.Status != models.CompensatoryOpen {
+				return errCompensatoryNotOpen
+			}
+			reversal := models.LeaveBalanceTransaction{
+				UserID:        work.UserID,
+				LeaveType:     models.LeaveTypeCompensatory,
+				Kind:          models.LeaveTxAdjust,
+				Days:          -1,
+				EffectiveDate: now,
+				Note:          fmt.Sprintf("Holiday work on %s withdrawn", dateKey(work.WorkDate)),
+				CreatedBy:     &actorID,
+			}
+			if err := tx.Create(&reversal).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&work).Error
+	})
+	if err != nil {
+		var httpErr *echo.HTTPError
+		switch {
+		case errors.As(err, &httpErr):
+			return httpErr
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Holiday work not found")
+		case errors.Is(err, errCompensatoryNotOpen):
+			return echo.NewHTTPError(http.StatusConflict, "The day off for this holiday work has already been used")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete holiday work")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
@@ -8,8 +10,11 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/yudai-uk/backend/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+var errLeaveAlreadyProcessed = errors.New("leave request already processed")
+
 type LeaveHandler struct {
 	db *gorm.DB
 }
@@ -22,12 +27,15 @@ type CreateLeaveRequest struct {
 	Type      models.LeaveType `json:"type" validate:"required"`
 	StartDate time.Time        `json:"start_date" validate:"required"`
 	EndDate   time.Time        `json:"end_date" validate:"required"`
-	Days      int              `json:"days" validate:"required,min=1"`
+	Unit      models.LeaveUnit `json:"unit"`
+	StartTime *time.Time       `json:"start_time"` // hours unit only
+	EndTime   *time.Time       `json:"end_time"`   // hours unit only
 	Reason    string           `json:"reason" validate:"required"`
 }
 
 type UpdateLeaveStatusRequest struct {
-	Status models.LeaveStatus `json:"status" validate:"required"`
+	Status  models.LeaveStatus `json:"status" validate:"required"`
+	Comment string             `json:"comment"`
 }
 
 func (h *LeaveHandler) CreateLeave(c echo.Context) error {
@@ -38,22 +46,16 @@ func (h *LeaveHandler) CreateLeave(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
 	}
 
+	req.StartDate, req.EndDate = localDate(req.StartDate), localDate(req.EndDate)
 	if req.StartDate.After(req.EndDate) {
 		return echo.NewHTTPError(http.StatusBadRequest, "Start date must be before end date")
 	}
 
-	if req.StartDate.Before(time.Now().Truncate(24 * time.Hour)) {
+	if req.StartDate.Before(truncateDate(time.Now())) {
 		return echo.NewHTTPError(http.StatusBadRequest, "Cannot apply for leave in the past")
 	}
-
-	var overlappingLeaves []models.Leave
-	if err := h.db.Where("user_id = ? AND status != ? AND ((start_date <= ? AND end_date >= ?) OR (start_date <= ? AND end_date >= ?))",
-		userID, models.LeaveRejected, req.StartDate, req.StartDate, req.EndDate, req.EndDate).Find(&overlappingLeaves).Error; err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to check for overlapping leaves")
-	}
-
-	if len(overlappingLeaves) > 0 {
-		return echo.NewHTTPError(http.StatusConflict, "Leave request overlaps with existing leave")
+	if err := requireOpenPeriod(h.db, req.StartDate, req.EndDate); err != nil {
+		return err
 	}
 
 	leave := models.Leave{
@@ -61,18 +63,169 @@ func (h *LeaveHandler) CreateLeave(c echo.Context) error {
 		Type:      req.Type,
 		StartDate: req.StartDate,
 		EndDate:   req.EndDate,
-		Days:      req.Days,
 		Reason:    req.Reason,
 		Status:    models.LeavePending,
 	}
+	if err := applyLeaveUnit(h.db, &leave, &req); err != nil {
+		return err
+	}
+	if err := h.checkLeaveTypeRules(&leave); err != nil {
+		return err
+	}
+
+	overlap, err := hasOverlappingLeave(h.db, &leave)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to check for overlapping leaves")
+	}
 
-	if err := h.db.Create(&leave).Error; err != nil {
+	if overlap {
+		return echo.NewHTTPError(http.StatusConflict, "Leave request overlaps with existing leave")
+	}
+
+	if err := checkHourlyLeaveCap(h.db, &leave, true); err != nil {
+		if errors.Is(err, errHourlyLeaveCapExceeded) {
+			return echo.NewHTTPError(http.StatusConflict, "Hourly leave would exceed the yearly limit")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to check hourly leave usage")
+	}
+
+	// Pending requests count here so that two people asking for the same
+	// day both hear about it.
+	shortfalls, policy, err := checkCoverage(h.db, &leave,
+		append([]models.LeaveStatus{models.LeavePending}, models.EffectiveLeaveStatuses...))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to check team coverage")
+	}
+	if len(shortfalls) > 0 && policy == models.CoverageBlock {
+		return coverageBlockedError(shortfalls)
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&leave).Error; err != nil {
+			return err
+		}
+		steps, err := createApprovalSteps(tx, &leave)
+		if err != nil {
+			return err
+		}
+		leave.ApprovalSteps = steps
+		return nil
+	})
+	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create leave request")
 	}
+	leave.CoverageWarnings = shortfalls
 
 	return c.JSON(http.StatusCreated, leave)
 }
 
+// applyLeaveUnit validates the unit-specific fields of req and fills in the
+// unit, time range, hours and days on leave. Days are always computed from
+// the user's working calendar, never taken from the client.
+func applyLeaveUnit(db *gorm.DB, leave *models.Leave, req *CreateLeaveRequest) error {
+	unit := req.Unit
+	if unit == "" {
+		unit = models.LeaveUnitFull
+	}
+	leave.Unit = unit
+
+	if unit != models.LeaveUnitFull {
+		working, err := isWorkingDay(db, leave.UserID, req.StartDate)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve working days")
+		}
+		if !working {
+			return echo.NewHTTPError(http.StatusBadRequest, "Leave date is not a working day")
+		}
+	}
+
+	switch unit {
+	case models.LeaveUnitFull:
+		days, err := chargeableLeaveDays(db, leave.UserID, req.StartDate, req.EndDate)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve working days")
+		}
+		if days == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Leave period contains no working days")
+		}
+		leave.Days = days
+	case models.LeaveUnitAMHalf, models.LeaveUnitPMHalf:
+		if !sameDay(req.StartDate, req.EndDate) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Half-day leave must start and end on the same day")
+		}
+		leave.Days = 0.5
+	case models.LeaveUnitHours:
+		if !sameDay(req.StartDate, req.EndDate) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Hourly leave must start and end on the same day")
+		}
+		if req.StartTime == nil || req.EndTime == nil || !req.StartTime.Before(*req.EndTime) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Hourly leave requires start_time before end_time")
+		}
+		if !sameDay(*req.StartTime, req.StartDate) || !sameDay(*req.EndTime, req.StartDate) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Hourly leave times must fall on the leave date")
+		}
+		duration := req.EndTime.Sub(*req.StartTime)
+		if duration%time.Hour != 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Hourly leave must be taken in whole hours")
+		}
+		leave.StartTime = req.StartTime
+		leave.EndTime = req.EndTime
+		leave.Hours = duration.Hours()
+		rule, err := newWorkRules(db).at(leave.UserID, req.StartDate)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve work rule")
+		}
+		leave.Days = leave.Hours / rule.StandardDailyHours()
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "Unit must be full, am_half, pm_half or hours")
+	}
+	return nil
+}
+
+// checkLeaveTypeRules enforces the rules configured on the leave's type.
+func (h *LeaveHandler) checkLeaveTypeRules(leave *models.Leave) error {
+	def, err := loadLeaveType(h.db, leave.Type)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Unknown leave type")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve leave type")
+	}
+	if !def.Active {
+		return echo.NewHTTPError(http.StatusBadRequest, "Leave type is no longer available")
+	}
+	if def.Code == models.LeaveTypeSubstitute {
+		return echo.NewHTTPError(http.StatusBadRequest, "Substitute holidays are designated when holiday work is recorded")
+	}
+	if !def.AllowsUnit(leave.Unit) {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Leave type %s cannot be taken as %s", def.Code, leave.Unit))
+	}
+	// Each compensatory day is one holiday work record, taken or expired
+	// as a whole.
+	if def.Code == models.LeaveTypeCompensatory && leave.Unit != models.LeaveUnitFull {
+		return echo.NewHTTPError(http.StatusBadRequest, "Compensatory days can only be taken as full days")
+	}
+
+	if def.MaxConsecutiveDays != nil {
+		span := int(truncateDate(leave.EndDate).Sub(truncateDate(leave.StartDate)).Hours()/24) + 1
+		if span > *def.MaxConsecutiveDays {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Leave type %s allows at most %d consecutive days", def.Code, *def.MaxConsecutiveDays))
+		}
+	}
+
+	if def.MinNoticeDays > 0 {
+		earliest := truncateDate(time.Now()).AddDate(0, 0, def.MinNoticeDays)
+		if truncateDate(leave.StartDate).Before(earliest) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Leave type %s requires %d days notice", def.Code, def.MinNoticeDays))
+		}
+	}
+	return nil
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
+}
+
 func (h *LeaveHandler) GetLeaves(c echo.Context) error {
 	userID := c.Get("user_id").(uint)
 	userRole := c.Get("user_role").(string)
@@ -89,42 +242,33 @@ func (h *LeaveHandler) GetLeaves(c echo.Context) error {
 
 	offset := (page - 1) * limit
 
-	query := h.db.Model(&models.Leave{}).Preload("User").Order("created_at DESC")
+	scope, err := resolveUserScope(h.db, userID, userRole)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
 
-	if userRole == "admin" || userRole == "manager" {
-		status := c.QueryParam("status")
-		if status != "" {
+	filter := func(query *gorm.DB) *gorm.DB {
+		if userRole != "admin" && userRole != "manager" {
+			return query.Where("user_id = ?", userID)
+		}
+		query = scope.apply(query, "user_id")
+		if status := c.QueryParam("status"); status != "" {
 			query = query.Where("status = ?", status)
 		}
-		
-		requestUserID := c.QueryParam("user_id")
-		if requestUserID != "" {
+		if requestUserID := c.QueryParam("user_id"); requestUserID != "" {
 			query = query.Where("user_id = ?", requestUserID)
 		}
-	} else {
-		query = query.Where("user_id = ?", userID)
+		return query
 	}
 
 	var leaves []models.Leave
-	if err := query.Offset(offset).Limit(limit).Find(&leaves).Error; err != nil {
+	if err := filter(h.db.Model(&models.Leave{})).Preload("User").Order("created_at DESC").
+		Offset(offset).Limit(limit).Find(&leaves).Error; err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve leave requests")
 	}
 
 	var total int64
-	countQuery := h.db.Model(&models.Leave{})
-	if userRole == "admin" || userRole == "manager" {
-		status := c.QueryParam("status")
-		if status != "" {
-			countQuery = countQuery.Where("status = ?", status)
-		}
-		requestUserID := c.QueryParam("user_id")
-		if requestUserID != "" {
-			countQuery = countQuery.Where("user_id = ?", requestUserID)
-		}
-	} else {
-		countQuery = countQuery.Where("user_id = ?", userID)
-	}
-	countQuery.Count(&total)
+	filter(h.db.Model(&models.Leave{})).Count(&total)
 
 	response := map[string]interface{}{
 		"data":     leaves,
@@ -137,11 +281,11 @@ func (h *LeaveHandler) GetLeaves(c echo.Context) error {
 	return c.JSON(http.StatusOK, response)
 }
 
+// UpdateLeaveStatus records the caller's decision on the current approval
+// step. A rejection ends the chain; the leave is approved only once the last
+// step approves it.
 func (h *LeaveHandler) UpdateLeaveStatus(c echo.Context) error {
 	userRole := c.Get("user_role").(string)
-	if userRole != "admin" && userRole != "manager" {
-		return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
-	}
 
 	leaveID, err := strconv.ParseUint(c.Param("leaveId"), 10, 32)
 	if err != nil {
@@ -157,32 +301,118 @@ func (h *LeaveHandler) UpdateLeaveStatus(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Status must be approved or rejected")
 	}
 
+	approverID := c.Get("user_id").(uint)
+	now := time.Now()
+
+	principals, err := approvalPrincipals(h.db, approverID, userRole)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+
 	var leave models.Leave
-	if err := h.db.First(&leave, leaveID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return echo.NewHTTPError(http.StatusNotFound, "Leave request not found")
+	var shortfalls []models.CoverageShortfall
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&leave, leaveID).Error; err != nil {
+			return err
 		}
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve leave request")
-	}
 
-	if leave.Status != models.LeavePending {
-		return echo.NewHTTPError(http.StatusBadRequest, "Leave request has already been processed")
-	}
+		if leave.Status != models.LeavePending {
+			return errLeaveAlreadyProcessed
+		}
+		// Checked against the caller, not the principals: a delegate must not
+		// approve their own leave on behalf of the manager who delegated.
+		if leave.UserID == approverID && userRole != "admin" {
+			return errNotApprover
+		}
+		if err := requireOpenPeriod(tx, leave.StartDate, leave.EndDate); err != nil {
+			return err
+		}
 
-	approverID := c.Get("user_id").(uint)
-	now := time.Now()
+		step, last, err := currentApprovalStep(tx, &leave)
+		if err != nil {
+			return err
+		}
+		principal := principalForStep(principals, step, leave.UserID)
+		if principal == nil {
+			return errNotApprover
+		}
+
+		step.Decision = models.ApprovalDecision(req.Status)
+		step.DecidedBy = &approverID
+		step.DecidedAt = &now
+		step.Comment = req.Comment
+		if principal.userID != approverID {
+			step.OnBehalfOf = &principal.userID
+		}
+		if err := tx.Save(step).Error; err != nil {
+			return err
+		}
 
-	leave.Status = req.Status
-	leave.ApprovedBy = &approverID
-	leave.ApprovedAt = &now
+		if req.Status == models.LeaveApproved && !last {
+			return tx.Model(&models.ApprovalStep{}).
+				Where("request_type = ? AND request_id = ? AND step_order = ?",
+					models.ApprovalRequestLeave, leave.ID, step.StepOrder+1).
+				Update("activated_at", now).Error
+		}
 
-	if err := h.db.Save(&leave).Error; err != nil {
+		leave.Status = req.Status
+		leave.ApprovedBy = &approverID
+		leave.ApprovedAt = &now
+
+		if leave.Status == models.LeaveApproved {
+			if err := checkRequiredAttachment(tx, &leave); err != nil {
+				return err
+			}
+			var policy models.CoveragePolicy
+			shortfalls, policy, err = checkCoverage(tx, &leave, models.EffectiveLeaveStatuses)
+			if err != nil {
+				return err
+			}
+			if len(shortfalls) > 0 && policy == models.CoverageBlock {
+				return errCoverageBelowMinimum
+			}
+			usesBalance, err := drawsFromBalance(tx, leave.Type)
+			if err != nil {
+				return err
+			}
+			if usesBalance {
+				if err := debitLeaveBalance(tx, &leave, approverID); err != nil {
+					return err
+				}
+			}
+		}
+
+		return tx.Save(&leave).Error
+	})
+	if err != nil {
+		var httpErr *echo.HTTPError
+		switch {
+		case errors.As(err, &httpErr):
+			return httpErr
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Leave request not found")
+		case errors.Is(err, errLeaveAlreadyProcessed):
+			return echo.NewHTTPError(http.StatusBadRequest, "Leave request has already been processed")
+		case errors.Is(err, errNotApprover):
+			return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+		case errors.Is(err, errInsufficientLeaveBalance):
+			return echo.NewHTTPError(http.StatusConflict, "Insufficient leave balance")
+		case errors.Is(err, errHourlyLeaveCapExceeded):
+			return echo.NewHTTPError(http.StatusConflict, "Hourly leave would exceed the yearly limit")
+		case errors.Is(err, errAttachmentRequired):
+			return echo.NewHTTPError(http.StatusConflict, "A supporting document must be attached before approval")
+		case errors.Is(err, errCoverageBelowMinimum):
+			return coverageBlockedError(shortfalls)
+		}
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update leave status")
 	}
 
-	if err := h.db.Preload("User").Preload("Approver").First(&leave, leaveID).Error; err != nil {
+	if err := h.db.Preload("User").Preload("Approver").Preload("ApprovalSteps", func(db *gorm.DB) *gorm.DB {
+		return db.Order("step_order ASC")
+	}).First(&leave, leaveID).Error; err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve updated leave request")
 	}
+	leave.CoverageWarnings = shortfalls
 
 	return c.JSON(http.StatusOK, leave)
-}
\ No newline at end of file
+}
@@ -0,0 +1,424 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errInsufficientLeaveBalance = errors.New("insufficient leave balance")
+	errHourlyLeaveCapExceeded   = errors.New("hourly leave cap exceeded")
+)
+
+type CreateBalanceTransactionRequest struct {
+	UserID        uint                        `json:"user_id" validate:"required"`
+	LeaveType     models.LeaveType            `json:"leave_type" validate:"required"`
+	Kind          models.LeaveTransactionKind `json:"kind" validate:"required"`
+	Days          float64                     `json:"days" validate:"required"`
+	EffectiveDate *time.Time                  `json:"effective_date"`
+	ExpiresAt     *time.Time                  `json:"expires_at"`
+	Note          string                      `json:"note"`
+}
+
+type LeaveBalance struct {
+	LeaveType models.LeaveType `json:"leave_type"`
+	Current   float64          `json:"current"`
+	Pending   float64          `json:"pending"`
+	Projected float64          `json:"projected"`
+	// Hourly usage in the current leave year, for types with an hourly cap.
+	HourlyUsed float64 `json:"hourly_used,omitempty"`
+	HourlyCap  float64 `json:"hourly_cap,omitempty"`
+}
+
+// lockUser serializes writes to a user's ledger and schedules for the rest
+// of tx.
+func lockUser(tx *gorm.DB, userID uint) error {
+	var user models.User
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&user, userID).Error
+}
+
+func leaveBalance(db *gorm.DB, userID uint, leaveType models.LeaveType) (float64, error) {
+	var total float64
+	err := db.Model(&models.LeaveBalanceTransaction{}).
+		Where("user_id = ? AND leave_type = ?", userID, leaveType).
+		Select("COALESCE(SUM(days), 0)").Scan(&total).Error
+	return total, err
+}
+
+// leaveYear returns the leave year containing day: one year from the user's
+// most recent vacation grant, or the calendar year when there is none.
+func leaveYear(db *gorm.DB, userID uint, day time.Time) (time.Time, time.Time, error) {
+	var grant models.LeaveBalanceTransaction
+	if err := db.Where("user_id = ? AND leave_type = ? AND kind = ? AND effective_date <= ?",
+		userID, models.LeaveTypeVacation, models.LeaveTxGrant, day).
+		Order("effective_date DESC").Limit(1).Find(&grant).Error; err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if grant.ID != 0 {
+		return grant.EffectiveDate, grant.EffectiveDate.AddDate(1, 0, 0), nil
+	}
+	start := time.Date(day.Year(), 1, 1, 0, 0, 0, 0, day.Location())
+	return start, start.AddDate(1, 0, 0), nil
+}
+
+func hourlyLeaveUsed(db *gorm.DB, userID uint, start, end time.Time, statuses []models.LeaveStatus, excludeID uint) (float64, error) {
+	var used float64
+	err := db.Model(&models.Leave{}).
+		Where("user_id = ? AND type = ? AND unit = ? AND status IN ? AND start_date >= ? AND start_date < ? AND id != ?",
+			userID, models.LeaveTypeVacation, models.LeaveUnitHours, statuses, start, end, excludeID).
+		Select("COALESCE(SUM(hours), 0)").Scan(&used).Error
+	return used, err
+}
+
+// hourlyLeaveCap is the yearly limit on hourly leave for userID: five of
+// the standard days of the work rule in effect on day. A day with part of
+// an hour counts as the next whole hour, as the statute requires.
+func hourlyLeaveCap(db *gorm.DB, userID uint, day time.Time) (float64, error) {
+	rule, err := newWorkRules(db).at(userID, day)
+	if err != nil {
+		return 0, err
+	}
+	return models.HourlyLeaveCapDays * math.Ceil(rule.StandardDailyHours()), nil
+}
+
+// checkHourlyLeaveCap enforces the statutory limit of five days per leave
+// year taken as hourly paid leave. Pending requests count when includePending
+// is set so that a batch of requests cannot overshoot before approval.
+func checkHourlyLeaveCap(db *gorm.DB, leave *models.Leave, includePending bool) error {
+	if leave.Unit != models.LeaveUnitHours || leave.Type != models.LeaveTypeVacation {
+		return nil
+	}
+	start, end, err := leaveYear(db, leave.UserID, leave.StartDate)
+	if err != nil {
+		return err
+	}
+	statuses := models.EffectiveLeaveStatuses
+	if includePending {
+		statuses = append(statuses, models.LeavePending)
+	}
+	used, err := hourlyLeaveUsed(db, leave.UserID, start, end, statuses, leave.ID)
+	if err != nil {
+		return err
+	}
+	limit, err := hourlyLeaveCap(db, leave.UserID, leave.StartDate)
+	if err != nil {
+		return err
+	}
+	if used+leave.Hours > limit {
+		return errHourlyLeaveCapExceeded
+	}
+	return nil
+}
+
+// debitLeaveBalance records the use of leave against the ledger. It must run
+// inside the same transaction that approves the leave.
+func debitLeaveBalance(tx *gorm.DB, leave *models.Leave, actorID uint) error {
+	if err := lockUser(tx, leave.UserID); err != nil {
+		return err
+	}
+	if leave.Type == models.LeaveTypeCompensatory {
+		if _, err := expireCompensatoryDays(tx, time.Now(), leave.UserID); err != nil {
+			return err
+		}
+	}
+
+	balance, err := leaveBalance(tx, leave.UserID, leave.Type)
+	if err != nil {
+		return err
+	}
+	if balance < leave.Days {
+		return errInsufficientLeaveBalance
+	}
+	if err := checkHourlyLeaveCap(tx, leave, false); err != nil {
+		return err
+	}
+
+	entry := models.LeaveBalanceTransaction{
+		UserID:        leave.UserID,
+		LeaveType:     leave.Type,
+		Kind:          models.LeaveTxUse,
+		Days:          -leave.Days,
+		Hours:         -leave.Hours,
+		LeaveID:       &leave.ID,
+		EffectiveDate: leave.StartDate,
+		CreatedBy:     &actorID,
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return err
+	}
+	if leave.Type == models.LeaveTypeCompensatory {
+		return takeCompensatoryDays(tx, leave)
+	}
+	return nil
+}
+
+// restoreLeaveBalance credits back whatever the ledger has debited for leave.
+// It must run inside the same transaction that cancels the leave.
+func restoreLeaveBalance(tx *gorm.DB, leave *models.Leave, actorID uint) error {
+	if err := lockUser(tx, leave.UserID); err != nil {
+		return err
+	}
+
+	var net struct {
+		Days  float64
+		Hours float64
+	}
+	if err := tx.Model(&models.LeaveBalanceTransaction{}).
+		Select("COALESCE(SUM(days), 0) AS days, COALESCE(SUM(hours), 0) AS hours").
+		Where("leave_id = ?", leave.ID).Scan(&net).Error; err != nil {
+		return err
+	}
+	if net.Days >= 0 {
+		return nil
+	}
+
+	entry := models.LeaveBalanceTransaction{
+		UserID:        leave.UserID,
+		LeaveType:     leave.Type,
+		Kind:          models.LeaveTxRestore,
+		Days:          -net.Days,
+		Hours:         -net.Hours,
+		LeaveID:       &leave.ID,
+		EffectiveDate: time.Now(),
+		CreatedBy:     &actorID,
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return err
+	}
+	if leave.Type == models.LeaveTypeCompensatory {
+		return releaseCompensatoryDays(tx, leave)
+	}
+	return nil
+}
+
+// GetBalance returns current and projected balances for the caller, or for
+// user_id when requested by an admin or manager.
+func (h *LeaveHandler) GetBalance(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+	userRole := c.Get("user_role").(string)
+
+	if requestUserID := c.QueryParam("user_id"); requestUserID != "" {
+		if userRole != "admin" && userRole != "manager" {
+			return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+		}
+		uid, err := strconv.ParseUint(requestUserID, 10, 32)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid user_id parameter")
+		}
+		scope, err := resolveUserScope(h.db, userID, userRole)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+		}
+		if !scope.contains(uint(uid)) {
+			return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+		}
+		userID = uint(uid)
+	}
+
+	var current []struct {
+		LeaveType models.LeaveType
+		Total     float64
+	}
+	if err := h.db.Model(&models.LeaveBalanceTransaction{}).
+		Select("leave_type, SUM(days) AS total").
+		Where("user_id = ?", userID).
+		Group("leave_type").Scan(&current).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve leave balance")
+	}
+
+	var pending []struct {
+		Type  models.LeaveType
+		Total float64
+	}
+	if err := h.db.Model(&models.Leave{}).
+		Select("type, SUM(days) AS total").
+		Where("user_id = ? AND status = ?", userID, models.LeavePending).
+		Group("type").Scan(&pending).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve pending leaves")
+	}
+
+	balances := map[models.LeaveType]*LeaveBalance{}
+	get := func(t models.LeaveType) *LeaveBalance {
+		if b, ok := balances[t]; ok {
+			return b
+		}
+		b := &LeaveBalance{LeaveType: t}
+		balances[t] = b
+		return b
+	}
+	for _, row := range current {
+		get(row.LeaveType).Current = row.Total
+	}
+	for _, row := range pending {
+		usesBalance, err := drawsFromBalance(h.db, row.Type)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve leave type")
+		}
+		if usesBalance {
+			get(row.Type).Pending = row.Total
+		}
+	}
+
+	if b, ok := balances[models.LeaveTypeVacation]; ok {
+		start, end, err := leaveYear(h.db, userID, time.Now())
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve leave year")
+		}
+		used, err := hourlyLeaveUsed(h.db, userID, start, end, models.EffectiveLeaveStatuses, 0)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve hourly leave usage")
+		}
+		b.HourlyUsed = used
+		if b.HourlyCap, err = hourlyLeaveCap(h.db, userID, time.Now()); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve work rule")
+		}
+	}
+
+	data := make([]LeaveBalance, 0, len(balances))
+	for _, b := range balances {
+		b.Projected = b.Current - b.Pending
+		data = append(data, *b)
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].LeaveType < data[j].LeaveType })
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"user_id": userID,
+		"data":    data,
+	})
+}
+
+// GetBalanceTransactions lists ledger entries for a user, newest first.
+func (h *LeaveHandler) GetBalanceTransactions(c echo.Context) error {
+	uid, err := strconv.ParseUint(c.QueryParam("user_id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "user_id parameter is required")
+	}
+
+	scope, err := scopeFor(c, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+	if !scope.contains(uint(uid)) {
+		return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+	}
+
+	query := h.db.Where("user_id = ?", uid).Order("created_at DESC, id DESC")
+	if leaveType := c.QueryParam("leave_type"); leaveType != "" {
+		query = query.Where("leave_type = ?", leaveType)
+	}
+
+	var transactions []models.LeaveBalanceTransaction
+	if err := query.Find(&transactions).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve leave transactions")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": transactions,
+	})
+}
+
+// CreateBalanceTransaction records a manual grant, adjustment or expiry.
+// Use and restore entries are only written by the leave workflow.
+func (h *LeaveHandler) CreateBalanceTransaction(c echo.Context) error {
+	actorID := c.Get("user_id").(uint)
+
+	var req CreateBalanceTransactionRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.UserID == 0 || req.LeaveType == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "user_id and leave_type are required")
+	}
+	usesBalance, err := drawsFromBalance(h.db, req.LeaveType)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve leave type")
+	}
+	if !usesBalance {
+		return echo.NewHTTPError(http.StatusBadRequest, "Leave type does not use a balance")
+	}
+
+	scope, err := scopeFor(c, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+	if !scope.contains(req.UserID) || req.UserID == actorID && c.Get("user_role") != "admin" {
+		return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+	}
+
+	days := req.Days
+	switch req.Kind {
+	case models.LeaveTxGrant:
+		if days <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Grant days must be positive")
+		}
+	case models.LeaveTxExpire:
+		if days == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Expire days must not be zero")
+		}
+		if days > 0 {
+			days = -days
+		}
+	case models.LeaveTxAdjust:
+		if days == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Adjustment days must not be zero")
+		}
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "Kind must be grant, adjust or expire")
+	}
+
+	effective := time.Now()
+	if req.EffectiveDate != nil {
+		effective = localDate(*req.EffectiveDate)
+	}
+
+	entry := models.LeaveBalanceTransaction{
+		UserID:        req.UserID,
+		LeaveType:     req.LeaveType,
+		Kind:          req.Kind,
+		Days:          days,
+		EffectiveDate: effective,
+		Note:          req.Note,
+		CreatedBy:     &actorID,
+	}
+	if req.Kind == models.LeaveTxGrant && req.ExpiresAt != nil {
+		expires := localDate(*req.ExpiresAt)
+		entry.ExpiresAt = &expires
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockUser(tx, req.UserID); err != nil {
+			return err
+		}
+		if days < 0 {
+			balance, err := leaveBalance(tx, req.UserID, req.LeaveType)
+			if err != nil {
+				return err
+			}
+			if balance+days < 0 {
+				return errInsufficientLeaveBalance
+			}
+		}
+		return tx.Create(&entry).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "User not found")
+		}
+		if errors.Is(err, errInsufficientLeaveBalance) {
+			return echo.NewHTTPError(http.StatusConflict, "Transaction would make the balance negative")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to record leave transaction")
+	}
+
+	return c.JSON(http.StatusCreated, entry)
+}
@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+	"gorm.io/gorm"
+)
+
+var errCoverageBelowMinimum = errors.New("leave would take the team below minimum staffing")
+
+// maxCalendarDays bounds the range one calendar request may cover.
+const maxCalendarDays = 62
+
+// CalendarEntry is one person's leave on one day of the team calendar. The
+// leave type is only shown to callers whose scope covers the person.
+type CalendarEntry struct {
+	LeaveID  uint               `json:"leave_id"`
+	UserID   uint               `json:"user_id"`
+	UserName string             `json:"user_name"`
+	Type     models.LeaveType   `json:"type,omitempty"`
+	Unit     models.LeaveUnit   `json:"unit"`
+	Hours    float64            `json:"hours,omitempty"`
+	Status   models.LeaveStatus `json:"status"`
+}
+
+type CalendarDay struct {
+	Date               string          `json:"date"`
+	Working            int             `json:"working"`             // members expected to work
+	Available          float64         `json:"available"`           // after approved leave
+	ProjectedAvailable float64         `json:"projected_available"` // after approved and pending leave
+	BelowMinimum       bool            `json:"below_minimum"`
+	Approved           []CalendarEntry `json:"approved"`
+	Pending            []CalendarEntry `json:"pending"`
+}
+
+// teamCalendar holds a department's members, the days each is expected to
+// work with the standard hours of that day, and their leave over a date
+// range.
+type teamCalendar struct {
+	members map[uint]models.User
+	working map[uint]map[string]float64
+	leaves  []models.Leave
+}
+
+func loadTeamCalendar(db *gorm.DB, departmentID uint, start, end time.Time, statuses []models.LeaveStatus) (*teamCalendar, error) {
+	t := &teamCalendar{members: map[uint]models.User{}, working: map[uint]map[string]float64{}}
+
+	var members []models.User
+	if err := db.Select("id", "name").Where("department_id = ?", departmentID).Find(&members).Error; err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return t, nil
+	}
+
+	rules := newWorkRules(db)
+	ids := make([]uint, 0, len(members))
+	for _, m := range members {
+		days, err := userWorkingDays(db, m.ID, start, end)
+		if err != nil {
+			return nil, err
+		}
+		set := map[string]float64{}
+		for _, d := range days {
+			rule, err := rules.at(m.ID, d)
+			if err != nil {
+				return nil, err
+			}
+			set[dateKey(d)] = rule.StandardDailyHours()
+		}
+		t.members[m.ID] = m
+		t.working[m.ID] = set
+		ids = append(ids, m.ID)
+	}
+
+	if err := db.Where("user_id IN ? AND status IN ? AND start_date <= ? AND end_date >= ?",
+		ids, statuses, end, start).Order("start_date ASC, id ASC").Find(&t.leaves).Error; err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// availability returns how many members are expected to work on day and how
+// many of them remain after the leaves accepted by include. Partial-day
+// leave takes away the share of the member's standard day it covers.
+func (t *teamCalendar) availability(day time.Time, include func(*models.Leave) bool) (int, float64) {
+	key := dateKey(day)
+	working := 0
+	for id := range t.members {
+		if _, ok := t.working[id][key]; ok {
+			working++
+		}
+	}
+	absent := 0.0
+	for i := range t.leaves {
+		l := &t.leaves[i]
+		hours, ok := t.working[l.UserID][key]
+		if !ok || hours <= 0 || !include(l) {
+			continue
+		}
+		absent += l.CoveredHours(day, hours) / hours
+	}
+	return working, float64(working) - absent
+}
+
+// checkCoverage returns the days on which adding leave to the team's
+// existing leave in statuses leaves fewer members available than the
+// department's minimum staffing, along with the department's policy.
+func checkCoverage(db *gorm.DB, leave *models.Leave, statuses []models.LeaveStatus) ([]models.CoverageShortfall, models.CoveragePolicy, error) {
+	var requester models.User
+	if err := db.First(&requester, leave.UserID).Error; err != nil {
+		return nil, "", err
+	}
+	if requester.DepartmentID == nil {
+		return nil, "", nil
+	}
+	var department models.Department
+	if err := db.First(&department, *requester.DepartmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+	if department.MinStaffing <= 0 {
+		return nil, department.CoveragePolicy, nil
+	}
+
+	start, end := truncateDate(leave.StartDate), truncateDate(leave.EndDate)
+	team, err := loadTeamCalendar(db, department.ID, start, end, statuses)
+	if err != nil {
+		return nil, "", err
+	}
+	kept := team.leaves[:0]
+	for _, l := range team.leaves {
+		if l.ID != leave.ID {
+			kept = append(kept, l)
+		}
+	}
+	team.leaves = append(kept, *leave)
+
+	var shortfalls []models.CoverageShortfall
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		if _, ok := team.working[leave.UserID][dateKey(d)]; !ok {
+			continue
+		}
+		_, available := team.availability(d, func(*models.Leave) bool { return true })
+		if available < float64(department.MinStaffing) {
+			shortfalls = append(shortfalls, models.CoverageShortfall{
+				Date:      dateKey(d),
+				Required:  department.MinStaffing,
+				Available: roundTo(available, 2),
+			})
+		}
+	}
+	return shortfalls, department.CoveragePolicy, nil
+}
+
+func coverageBlockedError(shortfalls []models.CoverageShortfall) error {
+	dates := make([]string, len(shortfalls))
+	for i, s := range shortfalls {
+		dates[i] = s.Date
+	}
+	return echo.NewHTTPError(http.StatusConflict,
+		fmt.Sprintf("Team would fall below minimum staffing on %s", strings.Join(dates, ", ")))
+}
+
+// GetLeaveCalendar shows who in a team is off on each day of a range, with
+// approved and pending leave listed separately. Without department_id the
+// caller's own department is used.
+func (h *LeaveHandler) GetLeaveCalendar(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+	userRole := c.Get("user_role").(string)
+
+	now := time.Now()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	end := start.AddDate(0, 1, -1)
+	var err error
+	if from := c.QueryParam("from"); from != "" {
+		if start, err = time.ParseInLocation("2006-01-02", from, time.Local); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid from format. Expected YYYY-MM-DD")
+		}
+		end = start.AddDate(0, 1, -1)
+	}
+	if to := c.QueryParam("to"); to != "" {
+		if end, err = time.ParseInLocation("2006-01-02", to, time.Local); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid to format. Expected YYYY-MM-DD")
+		}
+	}
+	if end.Before(start) {
+		return echo.NewHTTPError(http.StatusBadRequest, "from must not be after to")
+	}
+	if end.Sub(start) >= maxCalendarDays*24*time.Hour {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Range must not exceed %d days", maxCalendarDays))
+	}
+
+	department, err := h.calendarDepartment(userID, userRole, c.QueryParam("department_id"))
+	if err != nil {
+		return err
+	}
+
+	statuses := append([]models.LeaveStatus{models.LeavePending}, models.EffectiveLeaveStatuses...)
+	team, err := loadTeamCalendar(h.db, department.ID, start, end, statuses)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve team calendar")
+	}
+
+	scope, err := resolveUserScope(h.db, userID, userRole)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+
+	effective := func(l *models.Leave) bool { return l.Status != models.LeavePending }
+	days := []CalendarDay{}
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		working, available := team.availability(d, effective)
+		_, projected := team.availability(d, func(*models.Leave) bool { return true })
+		day := CalendarDay{
+			Date:               dateKey(d),
+			Working:            working,
+			Available:          roundTo(available, 2),
+			ProjectedAvailable: roundTo(projected, 2),
+			BelowMinimum:       department.MinStaffing > 0 && working > 0 && available < float64(department.MinStaffing),
+			Approved:           []CalendarEntry{},
+			Pending:            []CalendarEntry{},
+		}
+		for i := range team.leaves {
+			l := &team.leaves[i]
+			if l.CoveredHours(d, 1) == 0 {
+				continue
+			}
+			entry := CalendarEntry{
+				LeaveID:  l.ID,
+				UserID:   l.UserID,
+				UserName: team.members[l.UserID].Name,
+				Unit:     l.Unit,
+				Hours:    l.Hours,
+				Status:   l.Status,
+			}
+			if scope.contains(l.UserID) {
+				entry.Type = l.Type
+			}
+			if effective(l) {
+				day.Approved = append(day.Approved, entry)
+			} else {
+				day.Pending = append(day.Pending, entry)
+			}
+		}
+		days = append(days, day)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"department":      department,
+		"min_staffing":    department.MinStaffing,
+		"coverage_policy": department.CoveragePolicy,
+		"from":            dateKey(start),
+		"to":              dateKey(end),
+		"data":            days,
+	})
+}
+
+// calendarDepartment resolves which team's calendar the caller asked for.
+// Employees may only see their own department; managers also see the
+// departments they head; admins see any.
+func (h *LeaveHandler) calendarDepartment(userID uint, userRole, param string) (*models.Department, error) {
+	var caller models.User
+	if err := h.db.First(&caller, userID).Error; err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve user")
+	}
+
+	var departmentID uint
+	if param == "" {
+		if caller.DepartmentID == nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "department_id is required")
+		}
+		departmentID = *caller.DepartmentID
+	} else {
+		id, err := strconv.ParseUint(param, 10, 32)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid department_id")
+		}
+		departmentID = uint(id)
+	}
+
+	allowed := userRole == "admin" || caller.DepartmentID != nil && *caller.DepartmentID == departmentID
+	if !allowed && userRole == "manager" {
+		managed, err := managedDepartmentIDs(h.db, userID)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+		}
+		for _, id := range managed {
+			if id == departmentID {
+				allowed = true
+				break
+			}
+		}
+	}
+	if !allowed {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+	}
+
+	var department models.Department
+	if err := h.db.First(&department, departmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, echo.NewHTTPError(http.StatusNotFound, "Department not found")
+		}
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve department")
+	}
+	return &department, nil
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errLeaveNotOwned       = errors.New("leave belongs to another user")
+	errLeaveNotCancellable = errors.New("leave cannot be cancelled")
+)
+
+type CancelLeaveRequest struct {
+	Reason string `json:"reason"`
+}
+
+type UpdateCancellationRequest struct {
+	Status models.LeaveStatus `json:"status" validate:"required"` // approved or rejected
+}
+
+// CancelLeave lets an employee withdraw their own leave. Pending requests are
+// cancelled immediately; approved leave that has not started yet moves to
+// cancel_requested and waits for a manager.
+func (h *LeaveHandler) CancelLeave(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+
+	leaveID, err := strconv.ParseUint(c.Param("leaveId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid leave ID")
+	}
+
+	var req CancelLeaveRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	var leave models.Leave
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&leave, leaveID).Error; err != nil {
+			return err
+		}
+		if leave.UserID != userID {
+			return errLeaveNotOwned
+		}
+		if err := requireOpenPeriod(tx, leave.StartDate, leave.EndDate); err != nil {
+			return err
+		}
+
+		leave.CancelReason = req.Reason
+		switch {
+		case leave.Status == models.LeavePending:
+			leave.Status = models.LeaveCancelled
+			leave.CancelledBy = &userID
+			leave.CancelledAt = &now
+		case leave.Status == models.LeaveApproved && !leave.StartDate.Before(today):
+			leave.Status = models.LeaveCancelRequested
+			leave.CancelRequestedAt = &now
+		default:
+			return errLeaveNotCancellable
+		}
+
+		return tx.Save(&leave).Error
+	})
+	if err != nil {
+		var httpErr *echo.HTTPError
+		switch {
+		case errors.As(err, &httpErr):
+			return httpErr
+		case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, errLeaveNotOwned):
+			return echo.NewHTTPError(http.StatusNotFound, "Leave request not found")
+		case errors.Is(err, errLeaveNotCancellable):
+			return echo.NewHTTPError(http.StatusBadRequest, "Only pending or future approved leave can be cancelled")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to cancel leave request")
+	}
+
+	return c.JSON(http.StatusOK, leave)
+}
+
+// UpdateCancellation lets a manager approve or reject a cancellation request.
+// Approving it cancels the leave and restores any balance it consumed.
+func (h *LeaveHandler) UpdateCancellation(c echo.Context) error {
+	userRole := c.Get("user_role").(string)
+	if userRole != "admin" && userRole != "manager" {
+		return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+	}
+
+	leaveID, err := strconv.ParseUint(c.Param("leaveId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid leave ID")
+	}
+
+	var req UpdateCancellationRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Status != models.LeaveApproved && req.Status != models.LeaveRejected {
+		return echo.NewHTTPError(http.StatusBadRequest, "Status must be approved or rejected")
+	}
+
+	approverID := c.Get("user_id").(uint)
+	now := time.Now()
+
+	scope, err := resolveUserScope(h.db, approverID, userRole)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+
+	var leave models.Leave
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&leave, leaveID).Error; err != nil {
+			return err
+		}
+		if !scope.contains(leave.UserID) || leave.UserID == approverID && userRole != "admin" {
+			return errNotApprover
+		}
+		if leave.Status != models.LeaveCancelRequested {
+			return errLeaveAlreadyProcessed
+		}
+		if err := requireOpenPeriod(tx, leave.StartDate, leave.EndDate); err != nil {
+			return err
+		}
+
+		if req.Status == models.LeaveRejected {
+			leave.Status = models.LeaveApproved
+			return tx.Save(&leave).Error
+		}
+
+		leave.Status = models.LeaveCancelled
+		leave.CancelledBy = &approverID
+		leave.CancelledAt = &now
+		if err := restoreLeaveBalance(tx, &leave, approverID); err != nil {
+			return err
+		}
+		return tx.Save(&leave).Error
+	})
+	if err != nil {
+		var httpErr *echo.HTTPError
+		switch {
+		case errors.As(err, &httpErr):
+			return httpErr
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Leave request not found")
+		case errors.Is(err, errNotApprover):
+			return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+		case errors.Is(err, errLeaveAlreadyProcessed):
+			return echo.NewHTTPError(http.StatusBadRequest, "Leave request has no pending cancellation")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update cancellation")
+	}
+
+	if err := h.db.Preload("User").Preload("Approver").First(&leave, leaveID).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve updated leave request")
+	}
+
+	return c.JSON(http.StatusOK, leave)
+}
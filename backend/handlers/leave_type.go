@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+	"gorm.io/gorm"
+)
+
+type LeaveTypeHandler struct {
+	db *gorm.DB
+}
+
+func NewLeaveTypeHandler(db *gorm.DB) *LeaveTypeHandler {
+	return &LeaveTypeHandler{db: db}
+}
+
+type LeaveTypeRequest struct {
+	Code               models.LeaveType `json:"code" validate:"required"`
+	NameJa             string           `json:"name_ja" validate:"required"`
+	NameEn             string           `json:"name_en" validate:"required"`
+	IsPaid             bool             `json:"is_paid"`
+	UsesBalance        bool             `json:"uses_balance"`
+	MaxConsecutiveDays *int             `json:"max_consecutive_days"`
+	MinNoticeDays      int              `json:"min_notice_days"`
+	RequiresAttachment bool             `json:"requires_attachment"`
+	AllowHalfDay       bool             `json:"allow_half_day"`
+	AllowHourly        bool             `json:"allow_hourly"`
+	Active             *bool            `json:"active"`
+}
+
+func loadLeaveType(db *gorm.DB, code models.LeaveType) (*models.LeaveTypeDefinition, error) {
+	var def models.LeaveTypeDefinition
+	if err := db.Where("code = ?", code).First(&def).Error; err != nil {
+		return nil, err
+	}
+	return &def, nil
+}
+
+// paidLeaveTypes returns the codes of the paid leave types. Deleted types
+// are included so that past leave keeps its classification.
+func paidLeaveTypes(db *gorm.DB) (map[models.LeaveType]bool, error) {
+	var codes []models.LeaveType
+	if err := db.Unscoped().Model(&models.LeaveTypeDefinition{}).Where("is_paid = ?", true).
+		Pluck("code", &codes).Error; err != nil {
+		return nil, err
+	}
+	paid := map[models.LeaveType]bool{}
+	for _, code := range codes {
+		paid[code] = true
+	}
+	return paid, nil
+}
+
+// drawsFromBalance reports whether approving leave of this type debits the ledger.
+func drawsFromBalance(db *gorm.DB, code models.LeaveType) (bool, error) {
+	def, err := loadLeaveType(db, code)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return def.UsesBalance, nil
+}
+
+// GetLeaveTypes lists leave types. Inactive types are included only for
+// admins and managers who pass all=true.
+func (h *LeaveTypeHandler) GetLeaveTypes(c echo.Context) error {
+	userRole := c.Get("user_role").(string)
+
+	query := h.db.Order("id ASC")
+	if c.QueryParam("all") != "true" || (userRole != "admin" && userRole != "manager") {
+		query = query.Where("active = ?", true)
+	}
+
+	var types []models.LeaveTypeDefinition
+	if err := query.Find(&types).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve leave types")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": types,
+	})
+}
+
+func (h *LeaveTypeHandler) CreateLeaveType(c echo.Context) error {
+	var req LeaveTypeRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	def := models.LeaveTypeDefinition{Active: true}
+	if err := applyLeaveType(&def, &req); err != nil {
+		return err
+	}
+
+	var count int64
+	h.db.Unscoped().Model(&models.LeaveTypeDefinition{}).Where("code = ?", def.Code).Count(&count)
+	if count > 0 {
+		return echo.NewHTTPError(http.StatusConflict, "A leave type with that code already exists")
+	}
+
+	if err := h.db.Create(&def).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create leave type")
+	}
+
+	return c.JSON(http.StatusCreated, def)
+}
+
+// UpdateLeaveType changes a type's rules. The code is immutable because
+// existing leaves and ledger entries refer to it.
+func (h *LeaveTypeHandler) UpdateLeaveType(c echo.Context) error {
+	typeID, err := strconv.ParseUint(c.Param("leaveTypeId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid leave type ID")
+	}
+
+	var req LeaveTypeRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	var def models.LeaveTypeDefinition
+	if err := h.db.First(&def, typeID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Leave type not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve leave type")
+	}
+
+	if req.Code == "" {
+		req.Code = def.Code
+	}
+	if req.Code != def.Code {
+		return echo.NewHTTPError(http.StatusBadRequest, "Leave type code cannot be changed")
+	}
+	if err := applyLeaveType(&def, &req); err != nil {
+		return err
+	}
+
+	if err := h.db.Save(&def).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update leave type")
+	}
+
+	return c.JSON(http.StatusOK, def)
+}
+
+// DeleteLeaveType deactivates a type so it can no longer be requested.
+// Historical leaves keep referring to it.
+func (h *LeaveTypeHandler) DeleteLeaveType(c echo.Context) error {
+	typeID, err := strconv.ParseUint(c.Param("leaveTypeId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid leave type ID")
+	}
+
+	result := h.db.Model(&models.LeaveTypeDefinition{}).Where("id = ?", typeID).Update("active", false)
+	if result.Error != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to deactivate leave type")
+	}
+	if result.RowsAffected == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "Leave type not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func applyLeaveType(def *models.LeaveTypeDefinition, req *LeaveTypeRequest) error {
+	if req.Code == "" || req.NameJa == "" || req.NameEn == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "code, name_ja and name_en are required")
+	}
+	if req.MaxConsecutiveDays != nil && *req.MaxConsecutiveDays < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "max_consecutive_days must be at least 1")
+	}
+	if req.MinNoticeDays < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "min_notice_days must not be negative")
+	}
+
+	def.Code = req.Code
+	def.NameJa = req.NameJa
+	def.NameEn = req.NameEn
+	def.IsPaid = req.IsPaid
+	def.UsesBalance = req.UsesBalance
+	def.MaxConsecutiveDays = req.MaxConsecutiveDays
+	def.MinNoticeDays = req.MinNoticeDays
+	def.RequiresAttachment = req.RequiresAttachment
+	def.AllowHalfDay = req.AllowHalfDay
+	def.AllowHourly = req.AllowHourly
+	if req.Active != nil {
+		def.Active = *req.Active
+	}
+	return nil
+}
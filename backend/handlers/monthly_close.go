@@ -0,0 +1,442 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type MonthlyCloseHandler struct {
+	db *gorm.DB
+}
+
+func NewMonthlyCloseHandler(db *gorm.DB) *MonthlyCloseHandler {
+	return &MonthlyCloseHandler{db: db}
+}
+
+type MonthlyConfirmRequest struct {
+	Comment string `json:"comment"`
+}
+
+type CloseMonthRequest struct {
+	Force bool `json:"force"` // close even if some employees have not been approved
+}
+
+type ReopenMonthRequest struct {
+	Reason string `json:"reason" validate:"required"`
+}
+
+// MonthlyCloseStatus is where one employee's month stands in the close.
+type MonthlyCloseStatus struct {
+	Status       models.MonthlyConfirmationStatus `json:"status"`
+	ConfirmedAt  *time.Time                       `json:"confirmed_at"`
+	ApprovedBy   *uint                            `json:"approved_by"`
+	ApprovedAt   *time.Time                       `json:"approved_at"`
+	Comment      string                           `json:"comment,omitempty"`
+	PeriodStatus models.ClosingStatus             `json:"period_status"`
+}
+
+// MonthlyCloseEntry is an employee's status in the admin list.
+type MonthlyCloseEntry struct {
+	User models.User `json:"user"`
+	MonthlyCloseStatus
+}
+
+// requireOpenPeriod rejects a write touching any day from start to end
+// when its month has been closed.
+func requireOpenPeriod(db *gorm.DB, start, end time.Time) error {
+	closed, err := models.ClosedMonths(db, start, end)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to check the closing period")
+	}
+	if len(closed) > 0 {
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("The period %s is closed", closed[0]))
+	}
+	return nil
+}
+
+// closingPeriod returns the close of month, open when none is recorded.
+func closingPeriod(db *gorm.DB, month string) (models.ClosingPeriod, error) {
+	var periods []models.ClosingPeriod
+	if err := db.Where("month = ?", month).Limit(1).Find(&periods).Error; err != nil {
+		return models.ClosingPeriod{}, err
+	}
+	if len(periods) == 0 {
+		return models.ClosingPeriod{Month: month, Status: models.ClosingOpen}, nil
+	}
+	return periods[0], nil
+}
+
+// monthlyCloseStatuses returns each user's status for month.
+func monthlyCloseStatuses(db *gorm.DB, userIDs []uint, month string) (map[uint]MonthlyCloseStatus, error) {
+	period, err := closingPeriod(db, month)
+	if err != nil {
+		return nil, err
+	}
+	var confirmations []models.MonthlyConfirmation
+	if err := db.Where("user_id IN ? AND month = ?", userIDs, month).Find(&confirmations).Error; err != nil {
+		return nil, err
+	}
+
+	statuses := map[uint]MonthlyCloseStatus{}
+	for _, id := range userIDs {
+		statuses[id] = MonthlyCloseStatus{Status: models.MonthlyConfirmationOpen, PeriodStatus: period.Status}
+	}
+	for _, m := range confirmations {
+		statuses[m.UserID] = MonthlyCloseStatus{
+			Status:       m.Status,
+			ConfirmedAt:  m.ConfirmedAt,
+			ApprovedBy:   m.ApprovedBy,
+			ApprovedAt:   m.ApprovedAt,
+			Comment:      m.Comment,
+			PeriodStatus: period.Status,
+		}
+	}
+	return statuses, nil
+}
+
+// closeMonthParam validates :month and returns it with its first and last
+// day.
+func closeMonthParam(c echo.Context) (string, time.Time, time.Time, error) {
+	month := c.Param("month")
+	if month == "" {
+		month = c.QueryParam("month")
+	}
+	start, end, err := monthRange(month)
+	return month, start, end, err
+}
+
+// GetMyMonthlyClose returns the caller's close status for a month.
+func (h *MonthlyCloseHandler) GetMyMonthlyClose(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+
+	month, _, _, err := closeMonthParam(c)
+	if err != nil {
+		return err
+	}
+	statuses, err := monthlyCloseStatuses(h.db, []uint{userID}, month)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve closing status")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"month": month,
+		"data":  statuses[userID],
+	})
+}
+
+// ConfirmMonth records that the caller has checked their records for a
+// month that has started. A month sent back can be confirmed again.
+func (h *MonthlyCloseHandler) ConfirmMonth(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+
+	month, start, end, err := closeMonthParam(c)
+	if err != nil {
+		return err
+	}
+	var req MonthlyConfirmRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	now := time.Now()
+	if start.After(now) {
+		return echo.NewHTTPError(http.StatusBadRequest, "A month can only be confirmed once it has started")
+	}
+	if err := requireOpenPeriod(h.db, start, end); err != nil {
+		return err
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var confirmation models.MonthlyConfirmation
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND month = ?", userID, month).First(&confirmation).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			confirmation = models.MonthlyConfirmation{UserID: userID, Month: month}
+		case err != nil:
+			return err
+		case confirmation.Status == models.MonthlyConfirmationApproved:
+			return echo.NewHTTPError(http.StatusConflict, "This month has already been approved")
+		}
+		confirmation.Status = models.MonthlyConfirmationConfirmed
+		confirmation.ConfirmedAt = &now
+		confirmation.ApprovedBy = nil
+		confirmation.ApprovedAt = nil
+		confirmation.Comment = req.Comment
+		return tx.Save(&confirmation).Error
+	})
+	if err != nil {
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			return httpErr
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to confirm month")
+	}
+
+	statuses, _ := monthlyCloseStatuses(h.db, []uint{userID}, month)
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"month": month,
+		"data":  statuses[userID],
+	})
+}
+
+// GetMonthlyCloses lists the close status of every employee in scope for a
+// month, with the period's close history.
+func (h *MonthlyCloseHandler) GetMonthlyCloses(c echo.Context) error {
+	month, _, _, err := closeMonthParam(c)
+	if err != nil {
+		return err
+	}
+
+	scope, err := scopeFor(c, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+	query := scope.apply(h.db, "id").Where("role != ?", "admin")
+	if status := c.QueryParam("status"); status != "" {
+		if status == string(models.MonthlyConfirmationOpen) {
+			query = query.Where("id NOT IN (?)", h.db.Model(&models.MonthlyConfirmation{}).Select("user_id").Where("month = ?", month))
+		} else {
+			query = query.Where("id IN (?)", h.db.Model(&models.MonthlyConfirmation{}).Select("user_id").
+				Where("month = ? AND status = ?", month, status))
+		}
+	}
+	var users []models.User
+	if err := query.Order("id ASC").Find(&users).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve users")
+	}
+	ids := make([]uint, 0, len(users))
+	for _, u := range users {
+		ids = append(ids, u.ID)
+	}
+
+	statuses, err := monthlyCloseStatuses(h.db, ids, month)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve closing status")
+	}
+	period, err := closingPeriod(h.db, month)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve closing period")
+	}
+	var events []models.ClosingEvent
+	if err := h.db.Where("month = ?", month).Order("created_at ASC, id ASC").Find(&events).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve closing history")
+	}
+
+	data := make([]MonthlyCloseEntry, 0, len(users))
+	counts := map[models.MonthlyConfirmationStatus]int{}
+	for _, u := range users {
+		data = append(data, MonthlyCloseEntry{User: u, MonthlyCloseStatus: statuses[u.ID]})
+		counts[statuses[u.ID].Status]++
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"period":  period,
+		"events":  events,
+		"summary": counts,
+		"data":    data,
+	})
+}
+
+// ApproveMonth approves an employee's confirmed month. Managers cannot
+// approve their own.
+func (h *MonthlyCloseHandler) ApproveMonth(c echo.Context) error {
+	return h.review(c, true)
+}
+
+// ReturnMonth sends an employee's month back with a comment so that they
+// can correct it and confirm again.
+func (h *MonthlyCloseHandler) ReturnMonth(c echo.Context) error {
+	return h.review(c, false)
+}
+
+func (h *MonthlyCloseHandler) review(c echo.Context, approve bool) error {
+	actorID := c.Get("user_id").(uint)
+	role := c.Get("user_role").(string)
+
+	month, start, end, err := closeMonthParam(c)
+	if err != nil {
+		return err
+	}
+	userID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+	var req MonthlyConfirmRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	scope, err := scopeFor(c, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+	if !scope.contains(uint(userID)) || (uint(userID) == actorID && role != "admin") {
+		return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+	}
+	if err := requireOpenPeriod(h.db, start, end); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var confirmation models.MonthlyConfirmation
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND month = ?", userID, month).First(&confirmation).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return echo.NewHTTPError(http.StatusConflict, "The employee has not confirmed this month")
+			}
+			return err
+		}
+		if approve {
+			if confirmation.Status != models.MonthlyConfirmationConfirmed {
+				return echo.NewHTTPError(http.StatusConflict, "Only a confirmed month can be approved")
+			}
+			confirmation.Status = models.MonthlyConfirmationApproved
+			confirmation.ApprovedBy = &actorID
+			confirmation.ApprovedAt = &now
+		} else {
+			if confirmation.Status == models.MonthlyConfirmationReturned {
+				return echo.NewHTTPError(http.StatusConflict, "This month has already been returned")
+			}
+			confirmation.Status = models.MonthlyConfirmationReturned
+			confirmation.ApprovedBy = nil
+			confirmation.ApprovedAt = nil
+		}
+		if req.Comment != "" {
+			confirmation.Comment = req.Comment
+		}
+		return tx.Save(&confirmation).Error
+	})
+	if err != nil {
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			return httpErr
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update monthly confirmation")
+	}
+
+	return c.JSON(http.StatusOK, confirmation)
+}
+
+// CloseMonth closes a month for payroll. Every employee must have been
+// approved unless force is set.
+func (h *MonthlyCloseHandler) CloseMonth(c echo.Context) error {
+	actorID := c.Get("user_id").(uint)
+
+	month, _, end, err := closeMonthParam(c)
+	if err != nil {
+		return err
+	}
+	var req CloseMonthRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	now := time.Now()
+	if !now.After(end.AddDate(0, 0, 1)) {
+		return echo.NewHTTPError(http.StatusBadRequest, "A month can only be closed after it has ended")
+	}
+
+	if !req.Force {
+		var pending []uint
+		if err := h.db.Model(&models.User{}).Where("role != ?", "admin").
+			Where("id NOT IN (?)", h.db.Model(&models.MonthlyConfirmation{}).Select("user_id").
+				Where("month = ? AND status = ?", month, models.MonthlyConfirmationApproved)).
+			Order("id ASC").Pluck("id", &pending).Error; err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to check confirmations")
+		}
+		if len(pending) > 0 {
+			return c.JSON(http.StatusConflict, map[string]interface{}{
+				"message": "Some employees have not been approved for this month",
+				"pending": pending,
+			})
+		}
+	}
+
+	var period models.ClosingPeriod
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("month = ?", month).First(&period).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			period = models.ClosingPeriod{Month: month}
+		case err != nil:
+			return err
+		case period.Status == models.ClosingClosed:
+			return echo.NewHTTPError(http.StatusConflict, "This month is already closed")
+		}
+		period.Status = models.ClosingClosed
+		period.ClosedBy = &actorID
+		period.ClosedAt = &now
+		if err := tx.Save(&period).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ClosingEvent{Month: month, Status: models.ClosingClosed, ActorID: actorID}).Error
+	})
+	if err != nil {
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			return httpErr
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to close month")
+	}
+
+	return c.JSON(http.StatusOK, period)
+}
+
+// ReopenMonth opens a closed month again so that records can be corrected.
+// The reason is kept in the close history.
+func (h *MonthlyCloseHandler) ReopenMonth(c echo.Context) error {
+	actorID := c.Get("user_id").(uint)
+
+	month, _, _, err := closeMonthParam(c)
+	if err != nil {
+		return err
+	}
+	var req ReopenMonthRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "A reason is required to reopen a month")
+	}
+
+	now := time.Now()
+	var period models.ClosingPeriod
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("month = ?", month).First(&period).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return echo.NewHTTPError(http.StatusConflict, "This month is not closed")
+			}
+			return err
+		}
+		if period.Status != models.ClosingClosed {
+			return echo.NewHTTPError(http.StatusConflict, "This month is not closed")
+		}
+		period.Status = models.ClosingOpen
+		period.ReopenedBy = &actorID
+		period.ReopenedAt = &now
+		period.ReopenReason = reason
+		if err := tx.Save(&period).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ClosingEvent{Month: month, Status: models.ClosingOpen, ActorID: actorID, Reason: reason}).Error
+	})
+	if err != nil {
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			return httpErr
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to reopen month")
+	}
+
+	return c.JSON(http.StatusOK, period)
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+	"github.com/yudai-uk/backend/xlsx"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/transform"
+)
+
+// monthlyReportColumn is one column of the monthly report export.
+type monthlyReportColumn struct {
+	key   string
+	ja    string
+	en    string
+	value func(r *MonthlyReportData, departments map[uint]string) string
+}
+
+var monthlyReportColumns = []monthlyReportColumn{
+	{"employee_code", "社員番号", "Employee code", func(r *MonthlyReportData, _ map[uint]string) string {
+		if r.User.EmployeeCode != nil {
+			return *r.User.EmployeeCode
+		}
+		return ""
+	}},
+	{"name", "氏名", "Name", func(r *MonthlyReportData, _ map[uint]string) string { return r.User.Name }},
+	{"email", "メールアドレス", "Email", func(r *MonthlyReportData, _ map[uint]string) string { return r.User.Email }},
+	{"department", "部署", "Department", func(r *MonthlyReportData, departments map[uint]string) string {
+		if r.User.DepartmentID != nil {
+			return departments[*r.User.DepartmentID]
+		}
+		return ""
+	}},
+	{"total_working_days", "所定労働日数", "Working days", func(r *MonthlyReportData, _ map[uint]string) string {
+		return strconv.Itoa(r.TotalWorkingDays)
+	}},
+	{"actual_working_days", "出勤日数", "Days worked", func(r *MonthlyReportData, _ map[uint]string) string {
+		return strconv.Itoa(r.ActualWorkingDays)
+	}},
+	{"total_working_hours", "実労働時間", "Hours worked", func(r *MonthlyReportData, _ map[uint]string) string {
+		return r.TotalWorkingHours
+	}},
+	{"planned_hours", "予定労働時間", "Planned hours", func(r *MonthlyReportData, _ map[uint]string) string {
+		return r.PlannedHours
+	}},
+	{"overtime", "時間外労働時間", "Overtime hours", func(r *MonthlyReportData, _ map[uint]string) string {
+		return r.Overtime
+	}},
+	{"leave_days", "休暇日数", "Leave days", func(r *MonthlyReportData, _ map[uint]string) string {
+		return strconv.FormatFloat(r.LeaveDays, 'f', -1, 64)
+	}},
+	{"paid_leave_days", "有給休暇日数", "Paid leave days", func(r *MonthlyReportData, _ map[uint]string) string {
+		return strconv.FormatFloat(r.PaidLeaveDays, 'f', -1, 64)
+	}},
+	{"unpaid_leave_days", "無給休暇日数", "Unpaid leave days", func(r *MonthlyReportData, _ map[uint]string) string {
+		return strconv.FormatFloat(r.UnpaidLeaveDays, 'f', -1, 64)
+	}},
+	{"leave_hours", "休暇時間", "Leave hours", func(r *MonthlyReportData, _ map[uint]string) string {
+		return r.LeaveHours
+	}},
+	{"pending_leaves", "承認待ち休暇", "Pending leaves", func(r *MonthlyReportData, _ map[uint]string) string {
+		return strconv.Itoa(r.PendingLeaves)
+	}},
+	{"attendance_rate", "出勤率", "Attendance rate", func(r *MonthlyReportData, _ map[uint]string) string {
+		return r.AttendanceRate
+	}},
+	{"statutory_holiday_days", "法定休日労働日数", "Statutory holiday work days", func(r *MonthlyReportData, _ map[uint]string) string {
+		return strconv.Itoa(r.HolidayWork.StatutoryDays)
+	}},
+	{"statutory_holiday_hours", "法定休日労働時間", "Statutory holiday work hours", func(r *MonthlyReportData, _ map[uint]string) string {
+		return r.HolidayWork.StatutoryHours
+	}},
+	{"non_statutory_holiday_days", "所定休日労働日数", "Non-statutory holiday work days", func(r *MonthlyReportData, _ map[uint]string) string {
+		return strconv.Itoa(r.HolidayWork.NonStatutoryDays)
+	}},
+	{"non_statutory_holiday_hours", "所定休日労働時間", "Non-statutory holiday work hours", func(r *MonthlyReportData, _ map[uint]string) string {
+		return r.HolidayWork.NonStatutoryHours
+	}},
+	{"substituted_days", "振替休日日数", "Substituted days", func(r *MonthlyReportData, _ map[uint]string) string {
+		return strconv.Itoa(r.HolidayWork.SubstitutedDays)
+	}},
+	{"substituted_hours", "振替休日労働時間", "Substituted hours", func(r *MonthlyReportData, _ map[uint]string) string {
+		return r.HolidayWork.SubstitutedHours
+	}},
+	{"compensatory_days_taken", "代休取得日数", "Compensatory days taken", func(r *MonthlyReportData, _ map[uint]string) string {
+		return strconv.FormatFloat(r.HolidayWork.CompensatoryDaysTaken, 'f', -1, 64)
+	}},
+	{"confirmation_status", "月次確認", "Confirmation", func(r *MonthlyReportData, _ map[uint]string) string {
+		return string(r.Closing.Status)
+	}},
+	{"period_status", "締め状態", "Period", func(r *MonthlyReportData, _ map[uint]string) string {
+		return string(r.Closing.PeriodStatus)
+	}},
+}
+
+// monthlyReportExport holds the options of a CSV or XLSX monthly report.
+type monthlyReportExport struct {
+	format   string
+	english  bool
+	shiftJIS bool
+	columns  []monthlyReportColumn
+}
+
+// parseMonthlyReportExport reads format, columns, lang and encoding. It
+// returns nil when the report is wanted as JSON.
+func parseMonthlyReportExport(c echo.Context) (*monthlyReportExport, error) {
+	format := c.QueryParam("format")
+	switch format {
+	case "", "json":
+		return nil, nil
+	case "csv", "xlsx":
+	default:
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "format must be json, csv or xlsx")
+	}
+
+	export := &monthlyReportExport{format: format, english: c.QueryParam("lang") == "en"}
+	switch strings.ToLower(strings.ReplaceAll(c.QueryParam("encoding"), "-", "_")) {
+	case "", "utf8", "utf_8":
+	case "shift_jis", "sjis":
+		if format != "csv" {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Shift_JIS is only available for csv")
+		}
+		export.shiftJIS = true
+	default:
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "encoding must be utf-8 or shift_jis")
+	}
+
+	requested := c.QueryParam("columns")
+	if requested == "" {
+		export.columns = monthlyReportColumns
+		return export, nil
+	}
+	byKey := map[string]monthlyReportColumn{}
+	for _, col := range monthlyReportColumns {
+		byKey[col.key] = col
+	}
+	for _, key := range strings.Split(requested, ",") {
+		col, ok := byKey[strings.TrimSpace(key)]
+		if !ok {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Unknown column %q", strings.TrimSpace(key)))
+		}
+		export.columns = append(export.columns, col)
+	}
+	return export, nil
+}
+
+func (e *monthlyReportExport) header() []string {
+	header := make([]string, len(e.columns))
+	for i, col := range e.columns {
+		header[i] = col.ja
+		if e.english {
+			header[i] = col.en
+		}
+	}
+	return header
+}
+
+func (e *monthlyReportExport) row(r *MonthlyReportData, departments map[uint]string) []string {
+	row := make([]string, len(e.columns))
+	for i, col := range e.columns {
+		row[i] = col.value(r, departments)
+	}
+	return row
+}
+
+// exportMonthlyReports streams one row per user, building each report just
+// before it is written so that large organizations are not held in memory.
+func (h *AdminHandler) exportMonthlyReports(c echo.Context, export *monthlyReportExport, month string, users []models.User, closing map[uint]MonthlyCloseStatus, startOfMonth, endOfMonth time.Time) error {
+	var departments []models.Department
+	if err := h.db.Select("id", "name").Find(&departments).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve departments")
+	}
+	names := map[uint]string{}
+	for _, d := range departments {
+		names[d.ID] = d.Name
+	}
+
+	res := c.Response()
+	fileName := fmt.Sprintf("monthly-report-%s.%s", month, export.format)
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, fileName))
+
+	// The status line has gone out by the time a report fails, so the
+	// error can only cut the file short.
+	report := func(user models.User) ([]string, error) {
+		data, err := h.generateUserMonthlyReport(user, startOfMonth, endOfMonth)
+		if err != nil {
+			return nil, err
+		}
+		data.Closing = closing[user.ID]
+		return export.row(&data, names), nil
+	}
+
+	if export.format == "xlsx" {
+		res.Header().Set(echo.HeaderContentType, xlsx.ContentType)
+		res.WriteHeader(http.StatusOK)
+		w, err := xlsx.NewWriter(res, "monthly report")
+		if err != nil {
+			return err
+		}
+		if err := w.WriteRow(export.header()); err != nil {
+			return err
+		}
+		for _, user := range users {
+			row, err := report(user)
+			if err != nil {
+				return err
+			}
+			if err := w.WriteRow(row); err != nil {
+				return err
+			}
+		}
+		return w.Close()
+	}
+
+	// Older Excel installs open CSV as Shift_JIS; newer ones detect UTF-8
+	// from the byte order mark. Characters Shift_JIS lacks are replaced
+	// rather than failing the export halfway through.
+	var out io.Writer = res
+	var encoder *transform.Writer
+	if export.shiftJIS {
+		res.Header().Set(echo.HeaderContentType, "text/csv; charset=Shift_JIS")
+		encoder = transform.NewWriter(res, encoding.ReplaceUnsupported(japanese.ShiftJIS.NewEncoder()))
+		out = encoder
+	} else {
+		res.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	}
+	res.WriteHeader(http.StatusOK)
+	if !export.shiftJIS {
+		if _, err := io.WriteString(res, utf8BOM); err != nil {
+			return err
+		}
+	}
+
+	w := csv.NewWriter(out)
+	if err := w.Write(export.header()); err != nil {
+		return err
+	}
+	for _, user := range users {
+		row, err := report(user)
+		if err != nil {
+			return err
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+		res.Flush()
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	if encoder != nil {
+		return encoder.Close()
+	}
+	return nil
+}
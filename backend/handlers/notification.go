@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+	"gorm.io/gorm"
+)
+
+// maxNotifications caps how many notifications one request returns.
+const maxNotifications = 100
+
+type NotificationHandler struct {
+	db *gorm.DB
+}
+
+func NewNotificationHandler(db *gorm.DB) *NotificationHandler {
+	return &NotificationHandler{db: db}
+}
+
+// GetNotifications lists the caller's newest notifications; unread=true
+// limits it to unread ones.
+func (h *NotificationHandler) GetNotifications(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+
+	query := h.db.Where("user_id = ?", userID)
+	if unread, _ := strconv.ParseBool(c.QueryParam("unread")); unread {
+		query = query.Where("read_at IS NULL")
+	}
+	var notifications []models.Notification
+	if err := query.Order("created_at DESC, id DESC").Limit(maxNotifications).Find(&notifications).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve notifications")
+	}
+
+	var unreadCount int64
+	h.db.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&unreadCount)
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":   notifications,
+		"unread": unreadCount,
+	})
+}
+
+func (h *NotificationHandler) MarkNotificationRead(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+
+	notificationID, err := strconv.ParseUint(c.Param("notificationId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid notification ID")
+	}
+
+	result := h.db.Model(&models.Notification{}).
+		Where("id = ? AND user_id = ? AND read_at IS NULL", notificationID, userID).
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update notification")
+	}
+	if result.RowsAffected == 0 {
+		var count int64
+		h.db.Model(&models.Notification{}).Where("id = ? AND user_id = ?", notificationID, userID).Count(&count)
+		if count == 0 {
+			return echo.NewHTTPError(http.StatusNotFound, "Notification not found")
+		}
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *NotificationHandler) MarkAllNotificationsRead(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+
+	result := h.db.Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update notifications")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"updated": result.RowsAffected,
+	})
+}
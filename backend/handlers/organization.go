@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+	"gorm.io/gorm"
+)
+
+var errHierarchyCycle = errors.New("assignment would create a cycle")
+
+type OrganizationHandler struct {
+	db *gorm.DB
+}
+
+func NewOrganizationHandler(db *gorm.DB) *OrganizationHandler {
+	return &OrganizationHandler{db: db}
+}
+
+type DepartmentRequest struct {
+	Name           string                `json:"name" validate:"required"`
+	ParentID       *uint                 `json:"parent_id"`
+	ManagerID      *uint                 `json:"manager_id"`
+	MinStaffing    int                   `json:"min_staffing"`
+	CoveragePolicy models.CoveragePolicy `json:"coverage_policy"` // warn (default) or block
+	CalendarID     *uint                 `json:"calendar_id"`
+}
+
+type UserOrganizationRequest struct {
+	DepartmentID *uint   `json:"department_id"`
+	ManagerID    *uint   `json:"manager_id"`
+	EmployeeCode *string `json:"employee_code"` // omit to keep, "" to clear
+}
+
+func (h *OrganizationHandler) GetDepartments(c echo.Context) error {
+	var departments []models.Department
+	if err := h.db.Preload("Manager").Order("id ASC").Find(&departments).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve departments")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": departments,
+	})
+}
+
+func (h *OrganizationHandler) CreateDepartment(c echo.Context) error {
+	var req DepartmentRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.Name == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Name is required")
+	}
+
+	department := models.Department{
+		Name:           req.Name,
+		ParentID:       req.ParentID,
+		ManagerID:      req.ManagerID,
+		MinStaffing:    req.MinStaffing,
+		CoveragePolicy: req.CoveragePolicy,
+		CalendarID:     req.CalendarID,
+	}
+	if err := h.validateDepartment(&department); err != nil {
+		return err
+	}
+
+	if err := h.db.Create(&department).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create department")
+	}
+
+	return c.JSON(http.StatusCreated, department)
+}
+
+func (h *OrganizationHandler) UpdateDepartment(c echo.Context) error {
+	departmentID, err := strconv.ParseUint(c.Param("departmentId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid department ID")
+	}
+
+	var req DepartmentRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.Name == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Name is required")
+	}
+
+	var department models.Department
+	if err := h.db.First(&department, departmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Department not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve department")
+	}
+
+	department.Name = req.Name
+	department.ParentID = req.ParentID
+	department.ManagerID = req.ManagerID
+	department.MinStaffing = req.MinStaffing
+	department.CoveragePolicy = req.CoveragePolicy
+	department.CalendarID = req.CalendarID
+	if err := h.validateDepartment(&department); err != nil {
+		return err
+	}
+
+	if err := h.db.Save(&department).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update department")
+	}
+
+	return c.JSON(http.StatusOK, department)
+}
+
+// DeleteDepartment removes a department that has no members or children.
+func (h *OrganizationHandler) DeleteDepartment(c echo.Context) error {
+	departmentID, err := strconv.ParseUint(c.Param("departmentId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid department ID")
+	}
+
+	var children, members int64
+	h.db.Model(&models.Department{}).Where("parent_id = ?", departmentID).Count(&children)
+	h.db.Model(&models.User{}).Where("department_id = ?", departmentID).Count(&members)
+	if children > 0 || members > 0 {
+		return echo.NewHTTPError(http.StatusConflict, "Department still has sub-departments or members")
+	}
+
+	result := h.db.Delete(&models.Department{}, departmentID)
+	if result.Error != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete department")
+	}
+	if result.RowsAffected == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "Department not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// UpdateUserOrganization sets a user's department and reporting line.
+func (h *OrganizationHandler) UpdateUserOrganization(c echo.Context) error {
+	userID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	var req UserOrganizationRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "User not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve user")
+	}
+
+	if req.DepartmentID != nil {
+		var count int64
+		h.db.Model(&models.Department{}).Where("id = ?", *req.DepartmentID).Count(&count)
+		if count == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Department not found")
+		}
+	}
+	if req.ManagerID != nil {
+		if err := h.checkReportingLine(user.ID, *req.ManagerID); err != nil {
+			if errors.Is(err, errHierarchyCycle) {
+				return echo.NewHTTPError(http.StatusBadRequest, "Reporting line would create a cycle")
+			}
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return echo.NewHTTPError(http.StatusBadRequest, "Manager not found")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to validate reporting line")
+		}
+	}
+
+	columns := []string{"department_id", "manager_id"}
+	if req.EmployeeCode != nil {
+		code := strings.TrimSpace(*req.EmployeeCode)
+		if len(code) > 32 {
+			return echo.NewHTTPError(http.StatusBadRequest, "employee_code must be at most 32 characters")
+		}
+		user.EmployeeCode = nil
+		if code != "" {
+			var count int64
+			h.db.Model(&models.User{}).Where("employee_code = ? AND id != ?", code, user.ID).Count(&count)
+			if count > 0 {
+				return echo.NewHTTPError(http.StatusConflict, "employee_code is already in use")
+			}
+			user.EmployeeCode = &code
+		}
+		columns = append(columns, "employee_code")
+	}
+
+	user.DepartmentID = req.DepartmentID
+	user.ManagerID = req.ManagerID
+	if err := h.db.Model(&user).Select(columns).Updates(&user).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update user")
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
+
+func (h *OrganizationHandler) validateDepartment(department *models.Department) error {
+	if department.MinStaffing < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "min_staffing must not be negative")
+	}
+	switch department.CoveragePolicy {
+	case "":
+		department.CoveragePolicy = models.CoverageWarn
+	case models.CoverageWarn, models.CoverageBlock:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "coverage_policy must be warn or block")
+	}
+	if department.ManagerID != nil {
+		var count int64
+		h.db.Model(&models.User{}).Where("id = ?", *department.ManagerID).Count(&count)
+		if count == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Manager not found")
+		}
+	}
+	if department.CalendarID != nil {
+		var count int64
+		h.db.Model(&models.CompanyCalendar{}).Where("id = ?", *department.CalendarID).Count(&count)
+		if count == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Calendar not found")
+		}
+	}
+	if department.ParentID == nil {
+		return nil
+	}
+
+	chain, err := departmentChain(h.db, *department.ParentID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to validate parent department")
+	}
+	if len(chain) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Parent department not found")
+	}
+	for _, ancestor := range chain {
+		if department.ID != 0 && ancestor.ID == department.ID {
+			return echo.NewHTTPError(http.StatusBadRequest, "Parent department would create a cycle")
+		}
+	}
+	return nil
+}
+
+// checkReportingLine rejects a manager assignment that would make a user
+// report to themselves, directly or indirectly.
+func (h *OrganizationHandler) checkReportingLine(userID, managerID uint) error {
+	seen := map[uint]bool{}
+	id := &managerID
+	for id != nil {
+		if *id == userID {
+			return errHierarchyCycle
+		}
+		if seen[*id] {
+			return nil
+		}
+		seen[*id] = true
+		var manager models.User
+		if err := h.db.Select("id", "manager_id").First(&manager, *id).Error; err != nil {
+			return err
+		}
+		id = manager.ManagerID
+	}
+	return nil
+}
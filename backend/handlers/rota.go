@@ -0,0 +1,651 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+	"gorm.io/gorm"
+)
+
+var errDryRun = errors.New("dry run")
+
+type RotaHandler struct {
+	db *gorm.DB
+}
+
+func NewRotaHandler(db *gorm.DB) *RotaHandler {
+	return &RotaHandler{db: db}
+}
+
+type ShiftTemplateRequest struct {
+	Name       string `json:"name" validate:"required"`
+	StartTime  string `json:"start_time" validate:"required"` // HH:MM
+	EndTime    string `json:"end_time" validate:"required"`   // HH:MM
+	BreakTime  *int   `json:"break_time"`                     // minutes, default 60
+	IsFlexTime bool   `json:"is_flex_time"`
+	Note       string `json:"note"`
+}
+
+type RotationSlotRequest struct {
+	DayIndex        int  `json:"day_index"`
+	ShiftTemplateID uint `json:"shift_template_id" validate:"required"`
+}
+
+type RotationPatternRequest struct {
+	Name       string                `json:"name" validate:"required"`
+	CycleWeeks int                   `json:"cycle_weeks" validate:"required"`
+	Slots      []RotationSlotRequest `json:"slots"`
+}
+
+type RotationAssignmentRequest struct {
+	UserID     uint   `json:"user_id" validate:"required"`
+	PatternID  uint   `json:"pattern_id" validate:"required"`
+	StartDate  string `json:"start_date" validate:"required"` // YYYY-MM-DD
+	EndDate    string `json:"end_date"`                       // YYYY-MM-DD, optional
+	WeekOffset int    `json:"week_offset"`
+}
+
+type GenerateRotaRequest struct {
+	UserIDs    []uint `json:"user_ids"` // empty means every assigned user in scope
+	StartDate  string `json:"start_date" validate:"required"`
+	EndDate    string `json:"end_date" validate:"required"`
+	Regenerate bool   `json:"regenerate"` // replace previously generated rows
+	DryRun     bool   `json:"dry_run"`
+}
+
+// RotaGenerationResult counts what a generation run did, per outcome.
+type RotaGenerationResult struct {
+	Created        int `json:"created"`
+	Updated        int `json:"updated"`
+	Deleted        int `json:"deleted"`
+	Unchanged      int `json:"unchanged"`
+	KeptManual     int `json:"kept_manual"`
+	SkippedHoliday int `json:"skipped_holiday"` // days off on the company calendar
+	SkippedLeave   int `json:"skipped_leave"`
+}
+
+// daysBetween counts calendar days from a to b, ignoring clock time and DST.
+func daysBetween(a, b time.Time) int {
+	ua := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	ub := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(ub.Sub(ua).Hours() / 24)
+}
+
+// slotFor returns the shift template the assignment puts on day, or nil for
+// a day off.
+func slotFor(a *models.RotationAssignment, day time.Time) *models.ShiftTemplate {
+	cycle := a.Pattern.CycleDays()
+	if cycle <= 0 {
+		return nil
+	}
+	anchor := a.StartDate.AddDate(0, 0, -((int(a.StartDate.Weekday()) + 6) % 7)) // Monday
+	index := (daysBetween(anchor, day) + a.WeekOffset*7) % cycle
+	if index < 0 {
+		index += cycle
+	}
+	for i := range a.Pattern.Slots {
+		if a.Pattern.Slots[i].DayIndex == index {
+			return &a.Pattern.Slots[i].ShiftTemplate
+		}
+	}
+	return nil
+}
+
+// applyTemplate sets the shift fields of schedule from template on day.
+func applyTemplate(schedule *models.Schedule, template *models.ShiftTemplate, day time.Time) error {
+	breakTime := template.BreakTime
+	startTime, endTime, breakMinutes, err := buildShift(day, template.StartTime, template.EndTime, &breakTime)
+	if err != nil {
+		return err
+	}
+	schedule.Date = day
+	schedule.StartTime = startTime
+	schedule.EndTime = endTime
+	schedule.BreakTime = breakMinutes
+	schedule.IsFlexTime = template.IsFlexTime
+	schedule.Note = template.Note
+	schedule.ShiftTemplateID = &template.ID
+	schedule.Source = models.ScheduleGenerated
+	return nil
+}
+
+// generateRota expands assignments into schedules for [start, end]. Days
+// off on the user's company calendar and days with approved whole-day leave
+// are skipped. Manual
+// schedules are never touched; generated ones are replaced only when
+// regenerate is set.
+func generateRota(tx *gorm.DB, assignments []models.RotationAssignment, start, end time.Time, regenerate bool) (RotaGenerationResult, error) {
+	var result RotaGenerationResult
+
+	byUser := map[uint][]*models.RotationAssignment{}
+	var userIDs []uint
+	for i := range assignments {
+		a := &assignments[i]
+		if _, ok := byUser[a.UserID]; !ok {
+			userIDs = append(userIDs, a.UserID)
+		}
+		byUser[a.UserID] = append(byUser[a.UserID], a)
+	}
+
+	for _, userID := range userIDs {
+		if err := lockUser(tx, userID); err != nil {
+			return result, err
+		}
+
+		var existing []models.Schedule
+		if err := tx.Where("user_id = ? AND date >= ? AND date < ?", userID, start, end.AddDate(0, 0, 1)).
+			Find(&existing).Error; err != nil {
+			return result, err
+		}
+		existingOn := map[string][]*models.Schedule{}
+		for i := range existing {
+			key := dateKey(existing[i].Date.In(time.Local))
+			existingOn[key] = append(existingOn[key], &existing[i])
+		}
+
+		var leaves []models.Leave
+		if err := tx.Where("user_id = ? AND status IN ? AND start_date <= ? AND end_date >= ?",
+			userID, models.EffectiveLeaveStatuses, end.AddDate(0, 0, 1), start).Find(&leaves).Error; err != nil {
+			return result, err
+		}
+		calendar, err := loadBusinessCalendar(tx, userID, start, end)
+		if err != nil {
+			return result, err
+		}
+
+		for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+			key := dateKey(day)
+
+			// The most recently started assignment wins when they overlap.
+			var active *models.RotationAssignment
+			for _, a := range byUser[userID] {
+				if a.Covers(day) && (active == nil || a.StartDate.After(active.StartDate)) {
+					active = a
+				}
+			}
+			if active == nil {
+				continue
+			}
+			template := slotFor(active, day)
+
+			current := existingOn[key]
+			manual := false
+			for _, s := range current {
+				if s.Source != models.ScheduleGenerated {
+					manual = true
+				}
+			}
+			if manual {
+				result.KeptManual++
+				continue
+			}
+
+			onLeave := false
+			for i := range leaves {
+				if !leaves[i].IsPartialDay() && leaves[i].CoveredHours(day, 1) > 0 {
+					onLeave = true
+				}
+			}
+
+			status, _ := calendar.status(day)
+			switch {
+			case template == nil:
+			case status != dayWorking:
+				result.SkippedHoliday++
+				template = nil
+			case onLeave:
+				result.SkippedLeave++
+				template = nil
+			}
+
+			if template == nil {
+				if regenerate && len(current) > 0 {
+					if err := tx.Delete(current[0]).Error; err != nil {
+						return result, err
+					}
+					result.Deleted++
+				}
+				continue
+			}
+
+			if len(current) > 0 {
+				if !regenerate {
+					result.Unchanged++
+					continue
+				}
+				if err := applyTemplate(current[0], template, day); err != nil {
+					return result, err
+				}
+				if err := tx.Save(current[0]).Error; err != nil {
+					return result, err
+				}
+				result.Updated++
+				continue
+			}
+
+			schedule := models.Schedule{UserID: userID}
+			if err := applyTemplate(&schedule, template, day); err != nil {
+				return result, err
+			}
+			if err := tx.Create(&schedule).Error; err != nil {
+				return result, err
+			}
+			result.Created++
+		}
+	}
+	return result, nil
+}
+
+// GenerateRota expands rotation assignments into schedules for a date range.
+// With dry_run the counts are computed and the changes rolled back.
+func (h *RotaHandler) GenerateRota(c echo.Context) error {
+	var req GenerateRotaRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	start, err := parseLocalDate(req.StartDate)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid start_date format. Expected YYYY-MM-DD")
+	}
+	end, err := parseLocalDate(req.EndDate)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid end_date format. Expected YYYY-MM-DD")
+	}
+	if end.Before(start) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Start date must be before end date")
+	}
+	if end.Sub(start) >= maxScheduleRangeDays*24*time.Hour {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Range must not exceed %d days", maxScheduleRangeDays))
+	}
+
+	scope, err := scopeFor(c, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+	for _, id := range req.UserIDs {
+		if !scope.contains(id) {
+			return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+		}
+	}
+	if !req.DryRun {
+		if err := requireOpenPeriod(h.db, start, end); err != nil {
+			return err
+		}
+	}
+
+	query := scope.apply(h.db, "user_id").
+		Preload("Pattern.Slots.ShiftTemplate").
+		Where("start_date <= ? AND (end_date IS NULL OR end_date >= ?)", end, start)
+	if len(req.UserIDs) > 0 {
+		query = query.Where("user_id IN ?", req.UserIDs)
+	}
+	var assignments []models.RotationAssignment
+	if err := query.Order("user_id ASC, start_date ASC").Find(&assignments).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve rotation assignments")
+	}
+
+	var result RotaGenerationResult
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = generateRota(tx, assignments, start, end, req.Regenerate)
+		if err != nil {
+			return err
+		}
+		if req.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			return httpErr
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to generate schedules")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"dry_run": req.DryRun,
+		"result":  result,
+	})
+}
+
+func (h *RotaHandler) GetShiftTemplates(c echo.Context) error {
+	var templates []models.ShiftTemplate
+	if err := h.db.Order("start_time ASC, name ASC").Find(&templates).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve shift templates")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": templates,
+	})
+}
+
+func applyShiftTemplate(template *models.ShiftTemplate, req *ShiftTemplateRequest) error {
+	if req.Name == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Name is required")
+	}
+	// Validate against an arbitrary day; only the clock times matter.
+	_, _, breakMinutes, err := buildShift(time.Now(), req.StartTime, req.EndTime, req.BreakTime)
+	if err != nil {
+		return err
+	}
+	template.BreakTime = breakMinutes
+	template.Name = req.Name
+	template.StartTime = req.StartTime
+	template.EndTime = req.EndTime
+	template.IsFlexTime = req.IsFlexTime
+	template.Note = req.Note
+	return nil
+}
+
+func (h *RotaHandler) CreateShiftTemplate(c echo.Context) error {
+	var req ShiftTemplateRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	var template models.ShiftTemplate
+	if err := applyShiftTemplate(&template, &req); err != nil {
+		return err
+	}
+	if err := h.db.Create(&template).Error; err != nil {
+		return echo.NewHTTPError(http.StatusConflict, "A shift template with this name already exists")
+	}
+
+	return c.JSON(http.StatusCreated, template)
+}
+
+// UpdateShiftTemplate changes a template. Schedules already generated from it
+// change only when the rota is regenerated.
+func (h *RotaHandler) UpdateShiftTemplate(c echo.Context) error {
+	templateID, err := strconv.ParseUint(c.Param("templateId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid template ID")
+	}
+
+	var req ShiftTemplateRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	var template models.ShiftTemplate
+	if err := h.db.First(&template, templateID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Shift template not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve shift template")
+	}
+	if err := applyShiftTemplate(&template, &req); err != nil {
+		return err
+	}
+	if err := h.db.Save(&template).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update shift template")
+	}
+
+	return c.JSON(http.StatusOK, template)
+}
+
+// DeleteShiftTemplate removes a template no rotation pattern uses.
+func (h *RotaHandler) DeleteShiftTemplate(c echo.Context) error {
+	templateID, err := strconv.ParseUint(c.Param("templateId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid template ID")
+	}
+
+	var inUse int64
+	h.db.Model(&models.RotationSlot{}).
+		Joins("JOIN rotation_patterns ON rotation_patterns.id = rotation_slots.pattern_id AND rotation_patterns.deleted_at IS NULL").
+		Where("rotation_slots.shift_template_id = ?", templateID).Count(&inUse)
+	if inUse > 0 {
+		return echo.NewHTTPError(http.StatusConflict, "Shift template is used by a rotation pattern")
+	}
+
+	result := h.db.Delete(&models.ShiftTemplate{}, templateID)
+	if result.Error != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete shift template")
+	}
+	if result.RowsAffected == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "Shift template not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *RotaHandler) GetRotationPatterns(c echo.Context) error {
+	var patterns []models.RotationPattern
+	if err := h.db.Preload("Slots", func(db *gorm.DB) *gorm.DB {
+		return db.Order("day_index ASC")
+	}).Preload("Slots.ShiftTemplate").Order("name ASC").Find(&patterns).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve rotation patterns")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": patterns,
+	})
+}
+
+// buildRotationSlots validates req and returns the slots it describes.
+func (h *RotaHandler) buildRotationSlots(req *RotationPatternRequest) ([]models.RotationSlot, error) {
+	if req.Name == "" {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Name is required")
+	}
+	if req.CycleWeeks < 1 || req.CycleWeeks > 12 {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "cycle_weeks must be between 1 and 12")
+	}
+
+	seen := map[int]bool{}
+	slots := make([]models.RotationSlot, 0, len(req.Slots))
+	for _, s := range req.Slots {
+		if s.DayIndex < 0 || s.DayIndex >= req.CycleWeeks*7 {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("day_index must be between 0 and %d", req.CycleWeeks*7-1))
+		}
+		if seen[s.DayIndex] {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("day_index %d appears more than once", s.DayIndex))
+		}
+		seen[s.DayIndex] = true
+
+		var count int64
+		h.db.Model(&models.ShiftTemplate{}).Where("id = ?", s.ShiftTemplateID).Count(&count)
+		if count == 0 {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Shift template %d not found", s.ShiftTemplateID))
+		}
+		slots = append(slots, models.RotationSlot{DayIndex: s.DayIndex, ShiftTemplateID: s.ShiftTemplateID})
+	}
+	return slots, nil
+}
+
+func (h *RotaHandler) CreateRotationPattern(c echo.Context) error {
+	var req RotationPatternRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	slots, err := h.buildRotationSlots(&req)
+	if err != nil {
+		return err
+	}
+	pattern := models.RotationPattern{Name: req.Name, CycleWeeks: req.CycleWeeks, Slots: slots}
+	if err := h.db.Create(&pattern).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create rotation pattern")
+	}
+
+	return c.JSON(http.StatusCreated, pattern)
+}
+
+// UpdateRotationPattern replaces a pattern's cycle and slots.
+func (h *RotaHandler) UpdateRotationPattern(c echo.Context) error {
+	patternID, err := strconv.ParseUint(c.Param("patternId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid pattern ID")
+	}
+
+	var req RotationPatternRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	slots, err := h.buildRotationSlots(&req)
+	if err != nil {
+		return err
+	}
+
+	var pattern models.RotationPattern
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&pattern, patternID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("pattern_id = ?", pattern.ID).Delete(&models.RotationSlot{}).Error; err != nil {
+			return err
+		}
+		pattern.Name = req.Name
+		pattern.CycleWeeks = req.CycleWeeks
+		for i := range slots {
+			slots[i].PatternID = pattern.ID
+		}
+		if len(slots) > 0 {
+			if err := tx.Create(&slots).Error; err != nil {
+				return err
+			}
+		}
+		pattern.Slots = slots
+		return tx.Omit("Slots").Save(&pattern).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Rotation pattern not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update rotation pattern")
+	}
+
+	return c.JSON(http.StatusOK, pattern)
+}
+
+// DeleteRotationPattern removes a pattern nobody is assigned to.
+func (h *RotaHandler) DeleteRotationPattern(c echo.Context) error {
+	patternID, err := strconv.ParseUint(c.Param("patternId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid pattern ID")
+	}
+
+	var inUse int64
+	h.db.Model(&models.RotationAssignment{}).Where("pattern_id = ?", patternID).Count(&inUse)
+	if inUse > 0 {
+		return echo.NewHTTPError(http.StatusConflict, "Rotation pattern is still assigned")
+	}
+
+	result := h.db.Delete(&models.RotationPattern{}, patternID)
+	if result.Error != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete rotation pattern")
+	}
+	if result.RowsAffected == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "Rotation pattern not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *RotaHandler) GetRotationAssignments(c echo.Context) error {
+	scope, err := scopeFor(c, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+
+	query := scope.apply(h.db, "user_id").Preload("User").Preload("Pattern").Order("user_id ASC, start_date ASC")
+	if requestUserID := c.QueryParam("user_id"); requestUserID != "" {
+		query = query.Where("user_id = ?", requestUserID)
+	}
+
+	var assignments []models.RotationAssignment
+	if err := query.Find(&assignments).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve rotation assignments")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": assignments,
+	})
+}
+
+func (h *RotaHandler) CreateRotationAssignment(c echo.Context) error {
+	actorID := c.Get("user_id").(uint)
+
+	var req RotationAssignmentRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	scope, err := scopeFor(c, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+	if !scope.contains(req.UserID) {
+		return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+	}
+
+	start, err := parseLocalDate(req.StartDate)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid start_date format. Expected YYYY-MM-DD")
+	}
+	assignment := models.RotationAssignment{
+		UserID:     req.UserID,
+		PatternID:  req.PatternID,
+		StartDate:  start,
+		WeekOffset: req.WeekOffset,
+		CreatedBy:  actorID,
+	}
+	if req.EndDate != "" {
+		end, err := parseLocalDate(req.EndDate)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid end_date format. Expected YYYY-MM-DD")
+		}
+		if end.Before(start) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Start date must be before end date")
+		}
+		assignment.EndDate = &end
+	}
+
+	if err := h.db.First(&assignment.Pattern, req.PatternID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Rotation pattern not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve rotation pattern")
+	}
+
+	if err := h.db.Omit("Pattern", "User").Create(&assignment).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create rotation assignment")
+	}
+
+	return c.JSON(http.StatusCreated, assignment)
+}
+
+// DeleteRotationAssignment removes an assignment. Schedules it generated
+// stay until the range is regenerated or deleted.
+func (h *RotaHandler) DeleteRotationAssignment(c echo.Context) error {
+	assignmentID, err := strconv.ParseUint(c.Param("assignmentId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid assignment ID")
+	}
+
+	scope, err := scopeFor(c, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+
+	var assignment models.RotationAssignment
+	if err := h.db.First(&assignment, assignmentID).Error; err != nil || !scope.contains(assignment.UserID) {
+		if err == nil || errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Rotation assignment not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve rotation assignment")
+	}
+
+	if err := h.db.Delete(&assignment).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete rotation assignment")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
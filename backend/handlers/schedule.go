@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/yudai-uk/backend/models"
@@ -22,58 +21,112 @@ func NewScheduleHandler(db *gorm.DB) *ScheduleHandler {
 func (h *ScheduleHandler) GetSchedules(c echo.Context) error {
 	userID := c.Get("user_id").(uint)
 	userRole := c.Get("user_role").(string)
-
 	month := c.QueryParam("month")
-	if month == "" {
-		return echo.NewHTTPError(http.StatusBadRequest, "Month parameter is required (format: YYYY-MM)")
+
+	var schedules []models.Schedule
+	if userRole == "admin" || userRole == "manager" {
+		query, err := h.scheduleQuery(c, month)
+		if err != nil {
+			return err
+		}
+		if err := query.Order("date ASC").Find(&schedules).Error; err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve schedules")
+		}
+	} else {
+		// Employees only see what their team has published.
+		if month == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "Month parameter is required (format: YYYY-MM)")
+		}
+		start, end, err := monthRange(month)
+		if err != nil {
+			return err
+		}
+		if schedules, err = publishedSchedules(h.db, []uint{userID}, start, end); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve schedules")
+		}
 	}
 
-	parsedTime, err := time.Parse("2006-01", month)
+	summary, err := h.calculateScheduleSummary(schedules)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "Invalid month format. Expected YYYY-MM")
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve work rules")
+	}
+
+	response := map[string]interface{}{
+		"data":    schedules,
+		"summary": summary,
+		"month":   month,
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// scheduleQuery selects the schedules of month visible to the caller.
+// Managers and admins may narrow it with user_id or department_id (which
+// includes sub-departments); employees only ever see their own.
+func (h *ScheduleHandler) scheduleQuery(c echo.Context, month string) (*gorm.DB, error) {
+	userID := c.Get("user_id").(uint)
+	userRole := c.Get("user_role").(string)
+
+	if month == "" {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Month parameter is required (format: YYYY-MM)")
 	}
 
-	startOfMonth := time.Date(parsedTime.Year(), parsedTime.Month(), 1, 0, 0, 0, 0, parsedTime.Location())
-	endOfMonth := startOfMonth.AddDate(0, 1, -1)
+	startOfMonth, endOfMonth, err := monthRange(month)
+	if err != nil {
+		return nil, err
+	}
 
 	query := h.db.Model(&models.Schedule{}).Preload("User").Where("date BETWEEN ? AND ?", startOfMonth, endOfMonth)
 
 	if userRole == "admin" || userRole == "manager" {
+		scope, err := resolveUserScope(h.db, userID, userRole)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+		}
+		query = scope.apply(query, "user_id")
+
 		requestUserID := c.QueryParam("user_id")
 		if requestUserID != "" {
 			uid, err := strconv.ParseUint(requestUserID, 10, 32)
 			if err != nil {
-				return echo.NewHTTPError(http.StatusBadRequest, "Invalid user_id parameter")
+				return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid user_id parameter")
+			}
+			if !scope.contains(uint(uid)) {
+				return nil, echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
 			}
 			query = query.Where("user_id = ?", uid)
 		}
+
+		if departmentID := c.QueryParam("department_id"); departmentID != "" {
+			id, err := strconv.ParseUint(departmentID, 10, 32)
+			if err != nil {
+				return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid department_id parameter")
+			}
+			departments, err := departmentSubtree(h.db, []uint{uint(id)})
+			if err != nil {
+				return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve department")
+			}
+			query = query.Where("user_id IN (?)", h.db.Model(&models.User{}).Select("id").Where("department_id IN ?", departments))
+		}
 	} else {
 		query = query.Where("user_id = ?", userID)
 	}
 
-	var schedules []models.Schedule
-	if err := query.Order("date ASC").Find(&schedules).Error; err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve schedules")
-	}
-
-	summary := h.calculateScheduleSummary(schedules)
-
-	response := map[string]interface{}{
-		"data":    schedules,
-		"summary": summary,
-		"month":   month,
-	}
-
-	return c.JSON(http.StatusOK, response)
+	return query, nil
 }
 
-func (h *ScheduleHandler) calculateScheduleSummary(schedules []models.Schedule) map[string]interface{} {
+func (h *ScheduleHandler) calculateScheduleSummary(schedules []models.Schedule) (map[string]interface{}, error) {
 	totalDays := len(schedules)
 	totalPlannedHours := 0.0
 	flexTimeDays := 0
 
+	rules := newWorkRules(h.db)
 	for _, schedule := range schedules {
-		totalPlannedHours += schedule.PlannedHours()
+		rule, err := rules.at(schedule.UserID, schedule.Date)
+		if err != nil {
+			return nil, err
+		}
+		totalPlannedHours += schedule.PlannedHours(rule)
 		if schedule.IsFlexTime {
 			flexTimeDays++
 		}
@@ -89,5 +142,5 @@ func (h *ScheduleHandler) calculateScheduleSummary(schedules []models.Schedule)
 			}
 			return "0.00"
 		}(),
-	}
+	}, nil
 }
\ No newline at end of file
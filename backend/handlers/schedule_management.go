@@ -0,0 +1,417 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+	"gorm.io/gorm"
+)
+
+// maxScheduleRangeDays bounds how many days one create or delete may touch.
+const maxScheduleRangeDays = 92
+
+const defaultBreakMinutes = 60
+
+var errScheduleConflict = errors.New("schedule conflicts with an existing schedule or leave")
+
+type ScheduleRequest struct {
+	UserID        uint   `json:"user_id" validate:"required"`
+	Date          string `json:"date"`       // single day, YYYY-MM-DD
+	StartDate     string `json:"start_date"` // or a range, YYYY-MM-DD
+	EndDate       string `json:"end_date"`
+	Weekdays      []int  `json:"weekdays"`                       // range filter, 0 = Sunday; empty means every day
+	StartTime     string `json:"start_time" validate:"required"` // HH:MM
+	EndTime       string `json:"end_time" validate:"required"`   // HH:MM, at or before start_time for overnight shifts
+	BreakTime     *int   `json:"break_time"`                     // minutes, default 60
+	IsFlexTime    bool   `json:"is_flex_time"`
+	Note          string `json:"note"`
+	SkipConflicts bool   `json:"skip_conflicts"` // skip days that conflict instead of failing
+}
+
+type UpdateScheduleRequest struct {
+	Date       string `json:"date"` // optional move, YYYY-MM-DD
+	StartTime  string `json:"start_time" validate:"required"`
+	EndTime    string `json:"end_time" validate:"required"`
+	BreakTime  *int   `json:"break_time"`
+	IsFlexTime bool   `json:"is_flex_time"`
+	Note       string `json:"note"`
+}
+
+// ScheduleConflict explains why a day could not be scheduled.
+type ScheduleConflict struct {
+	Date   string `json:"date"`
+	Reason string `json:"reason"`
+}
+
+// parseClock parses HH:MM into an offset from midnight.
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// shiftTimes places a shift on day. An end at or before the start means the
+// shift runs past midnight; a shift may not exceed 24 hours.
+func shiftTimes(day time.Time, start, end time.Duration) (time.Time, time.Time) {
+	base := truncateDate(day)
+	if end <= start {
+		end += 24 * time.Hour
+	}
+	return base.Add(start), base.Add(end)
+}
+
+// buildShift validates the clock times and break of a shift on day.
+func buildShift(day time.Time, startClock, endClock string, breakTime *int) (time.Time, time.Time, int, error) {
+	start, err := parseClock(startClock)
+	if err != nil {
+		return time.Time{}, time.Time{}, 0, echo.NewHTTPError(http.StatusBadRequest, "Invalid start_time format. Expected HH:MM")
+	}
+	end, err := parseClock(endClock)
+	if err != nil {
+		return time.Time{}, time.Time{}, 0, echo.NewHTTPError(http.StatusBadRequest, "Invalid end_time format. Expected HH:MM")
+	}
+	if start == end {
+		return time.Time{}, time.Time{}, 0, echo.NewHTTPError(http.StatusBadRequest, "start_time and end_time must differ")
+	}
+	startTime, endTime := shiftTimes(day, start, end)
+
+	breakMinutes := defaultBreakMinutes
+	if breakTime != nil {
+		breakMinutes = *breakTime
+	}
+	if breakMinutes < 0 || float64(breakMinutes) >= endTime.Sub(startTime).Minutes() {
+		return time.Time{}, time.Time{}, 0, echo.NewHTTPError(http.StatusBadRequest, "break_time must be shorter than the shift")
+	}
+	return startTime, endTime, breakMinutes, nil
+}
+
+// scheduleConflict reports why userID cannot be scheduled on day: a
+// schedule already exists, or approved whole-day leave covers it. Partial
+// day leave does not block a schedule.
+func scheduleConflict(db *gorm.DB, userID uint, day time.Time, excludeID uint) (string, error) {
+	day = truncateDate(day)
+	var count int64
+	if err := db.Model(&models.Schedule{}).
+		Where("user_id = ? AND date >= ? AND date < ? AND id != ?", userID, day, day.AddDate(0, 0, 1), excludeID).
+		Count(&count).Error; err != nil {
+		return "", err
+	}
+	if count > 0 {
+		return "duplicate", nil
+	}
+
+	var leaves []models.Leave
+	if err := db.Where("user_id = ? AND status IN ? AND start_date <= ? AND end_date >= ?",
+		userID, models.EffectiveLeaveStatuses, day.AddDate(0, 0, 1).Add(-time.Nanosecond), day).
+		Find(&leaves).Error; err != nil {
+		return "", err
+	}
+	for _, l := range leaves {
+		if !l.IsPartialDay() {
+			return "approved_leave", nil
+		}
+	}
+	return "", nil
+}
+
+func parseLocalDate(s string) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
+
+// localDate keeps the calendar day of t as sent by the client and returns
+// its local midnight, the form every date column is stored and queried in.
+func localDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// scheduleDays expands the single date or range in req into the days to
+// schedule.
+func scheduleDays(req *ScheduleRequest) ([]time.Time, error) {
+	if req.Date != "" {
+		day, err := parseLocalDate(req.Date)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid date format. Expected YYYY-MM-DD")
+		}
+		return []time.Time{day}, nil
+	}
+
+	start, err := parseLocalDate(req.StartDate)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "date or start_date/end_date is required (YYYY-MM-DD)")
+	}
+	end, err := parseLocalDate(req.EndDate)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid end_date format. Expected YYYY-MM-DD")
+	}
+	if end.Before(start) {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Start date must be before end date")
+	}
+	if end.Sub(start) >= maxScheduleRangeDays*24*time.Hour {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Range must not exceed %d days", maxScheduleRangeDays))
+	}
+
+	weekdays := map[time.Weekday]bool{}
+	for _, w := range req.Weekdays {
+		if w < 0 || w > 6 {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "weekdays must be between 0 (Sunday) and 6 (Saturday)")
+		}
+		weekdays[time.Weekday(w)] = true
+	}
+
+	var days []time.Time
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		if len(weekdays) == 0 || weekdays[d.Weekday()] {
+			days = append(days, d)
+		}
+	}
+	return days, nil
+}
+
+// CreateSchedules creates a schedule for one day or every selected day of a
+// range. Either all days are created or none, unless skip_conflicts is set.
+func (h *ScheduleHandler) CreateSchedules(c echo.Context) error {
+	var req ScheduleRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	scope, err := scopeFor(c, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+	if !scope.contains(req.UserID) {
+		return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+	}
+
+	days, err := scheduleDays(&req)
+	if err != nil {
+		return err
+	}
+	if len(days) > 0 {
+		if err := requireOpenPeriod(h.db, days[0], days[len(days)-1]); err != nil {
+			return err
+		}
+	}
+
+	var created []models.Schedule
+	var conflicts []ScheduleConflict
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockUser(tx, req.UserID); err != nil {
+			return err
+		}
+		for _, day := range days {
+			startTime, endTime, breakMinutes, err := buildShift(day, req.StartTime, req.EndTime, req.BreakTime)
+			if err != nil {
+				return err
+			}
+			reason, err := scheduleConflict(tx, req.UserID, day, 0)
+			if err != nil {
+				return err
+			}
+			if reason != "" {
+				conflicts = append(conflicts, ScheduleConflict{Date: dateKey(day), Reason: reason})
+				continue
+			}
+			created = append(created, models.Schedule{
+				UserID:     req.UserID,
+				Date:       day,
+				StartTime:  startTime,
+				EndTime:    endTime,
+				BreakTime:  breakMinutes,
+				IsFlexTime: req.IsFlexTime,
+				Note:       req.Note,
+				Source:     models.ScheduleManual,
+			})
+		}
+		if len(conflicts) > 0 && !req.SkipConflicts {
+			return errScheduleConflict
+		}
+		if len(created) == 0 {
+			return nil
+		}
+		return tx.Create(&created).Error
+	})
+	if err != nil {
+		var httpErr *echo.HTTPError
+		switch {
+		case errors.As(err, &httpErr):
+			return httpErr
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return echo.NewHTTPError(http.StatusBadRequest, "User not found")
+		case errors.Is(err, errScheduleConflict):
+			return c.JSON(http.StatusConflict, map[string]interface{}{
+				"message":   "Some days already have a schedule or approved leave",
+				"conflicts": conflicts,
+			})
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create schedules")
+	}
+
+	if created == nil {
+		created = []models.Schedule{}
+	}
+	if conflicts == nil {
+		conflicts = []ScheduleConflict{}
+	}
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"data":    created,
+		"skipped": conflicts,
+	})
+}
+
+func (h *ScheduleHandler) UpdateSchedule(c echo.Context) error {
+	scheduleID, err := strconv.ParseUint(c.Param("scheduleId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid schedule ID")
+	}
+
+	var req UpdateScheduleRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	scope, err := scopeFor(c, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+
+	var schedule models.Schedule
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&schedule, scheduleID).Error; err != nil {
+			return err
+		}
+		if !scope.contains(schedule.UserID) {
+			return gorm.ErrRecordNotFound
+		}
+		if err := lockUser(tx, schedule.UserID); err != nil {
+			return err
+		}
+
+		day := truncateDate(schedule.Date.In(time.Local))
+		if req.Date != "" {
+			if day, err = parseLocalDate(req.Date); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "Invalid date format. Expected YYYY-MM-DD")
+			}
+		}
+		// Moving a shift touches both the day it leaves and the day it lands on.
+		if err := requireOpenPeriod(tx, schedule.Date.In(time.Local), schedule.Date.In(time.Local)); err != nil {
+			return err
+		}
+		if err := requireOpenPeriod(tx, day, day); err != nil {
+			return err
+		}
+		startTime, endTime, breakMinutes, err := buildShift(day, req.StartTime, req.EndTime, req.BreakTime)
+		if err != nil {
+			return err
+		}
+		reason, err := scheduleConflict(tx, schedule.UserID, day, schedule.ID)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("Cannot schedule %s: %s", dateKey(day), reason))
+		}
+
+		schedule.Date = day
+		schedule.StartTime = startTime
+		schedule.EndTime = endTime
+		schedule.BreakTime = breakMinutes
+		schedule.IsFlexTime = req.IsFlexTime
+		schedule.Note = req.Note
+		// An edited row is an override that rota regeneration must keep.
+		schedule.Source = models.ScheduleManual
+		return tx.Save(&schedule).Error
+	})
+	if err != nil {
+		var httpErr *echo.HTTPError
+		switch {
+		case errors.As(err, &httpErr):
+			return httpErr
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Schedule not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update schedule")
+	}
+
+	return c.JSON(http.StatusOK, schedule)
+}
+
+func (h *ScheduleHandler) DeleteSchedule(c echo.Context) error {
+	scheduleID, err := strconv.ParseUint(c.Param("scheduleId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid schedule ID")
+	}
+
+	scope, err := scopeFor(c, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+
+	var schedule models.Schedule
+	if err := h.db.First(&schedule, scheduleID).Error; err != nil || !scope.contains(schedule.UserID) {
+		if err == nil || errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Schedule not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve schedule")
+	}
+	if err := requireOpenPeriod(h.db, schedule.Date.In(time.Local), schedule.Date.In(time.Local)); err != nil {
+		return err
+	}
+
+	if err := h.db.Delete(&schedule).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete schedule")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// DeleteSchedules removes a user's schedules between start_date and
+// end_date inclusive.
+func (h *ScheduleHandler) DeleteSchedules(c echo.Context) error {
+	userID, err := strconv.ParseUint(c.QueryParam("user_id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "user_id is required")
+	}
+	start, err := parseLocalDate(c.QueryParam("start_date"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid start_date format. Expected YYYY-MM-DD")
+	}
+	end, err := parseLocalDate(c.QueryParam("end_date"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid end_date format. Expected YYYY-MM-DD")
+	}
+	if end.Before(start) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Start date must be before end date")
+	}
+	if end.Sub(start) >= maxScheduleRangeDays*24*time.Hour {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Range must not exceed %d days", maxScheduleRangeDays))
+	}
+
+	scope, err := scopeFor(c, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+	if !scope.contains(uint(userID)) {
+		return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+	}
+	if err := requireOpenPeriod(h.db, start, end); err != nil {
+		return err
+	}
+
+	result := h.db.Where("user_id = ? AND date >= ? AND date < ?", userID, start, end.AddDate(0, 0, 1)).
+		Delete(&models.Schedule{})
+	if result.Error != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete schedules")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"deleted": result.RowsAffected,
+	})
+}
@@ -0,0 +1,561 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errNothingToPublish = errors.New("no changes since the last publish")
+
+type SchedulePublicationHandler struct {
+	db *gorm.DB
+}
+
+func NewSchedulePublicationHandler(db *gorm.DB) *SchedulePublicationHandler {
+	return &SchedulePublicationHandler{db: db}
+}
+
+type PublishSchedulesRequest struct {
+	DepartmentID uint   `json:"department_id" validate:"required"`
+	Month        string `json:"month" validate:"required"` // YYYY-MM
+}
+
+// publishedSchedules returns what employees may see of userIDs' schedules
+// in [start, end]: the latest published snapshot for department members,
+// and the live rows of users outside any department, who have no
+// publishing cycle.
+func publishedSchedules(db *gorm.DB, userIDs []uint, start, end time.Time) ([]models.Schedule, error) {
+	if len(userIDs) == 0 {
+		return []models.Schedule{}, nil
+	}
+	next := end.AddDate(0, 0, 1)
+
+	var snapshots []models.PublishedSchedule
+	if err := db.Where("user_id IN ? AND date >= ? AND date < ?", userIDs, start, next).
+		Where("version = (SELECT version FROM schedule_publications WHERE schedule_publications.id = published_schedules.publication_id)").
+		Find(&snapshots).Error; err != nil {
+		return nil, err
+	}
+	schedules := make([]models.Schedule, 0, len(snapshots))
+	for _, s := range snapshots {
+		schedules = append(schedules, snapshotSchedule(s))
+	}
+
+	unassigned := db.Model(&models.User{}).Select("id").Where("id IN ? AND department_id IS NULL", userIDs)
+	var live []models.Schedule
+	if err := db.Where("user_id IN (?) AND date >= ? AND date < ?", unassigned, start, next).
+		Find(&live).Error; err != nil {
+		return nil, err
+	}
+	schedules = append(schedules, live...)
+
+	var users []models.User
+	if err := db.Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	byID := map[uint]models.User{}
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+	for i := range schedules {
+		schedules[i].User = byID[schedules[i].UserID]
+	}
+
+	sort.SliceStable(schedules, func(i, j int) bool {
+		if !schedules[i].Date.Equal(schedules[j].Date) {
+			return schedules[i].Date.Before(schedules[j].Date)
+		}
+		return schedules[i].StartTime.Before(schedules[j].StartTime)
+	})
+	return schedules, nil
+}
+
+// snapshotSchedule is a published row as employees see it.
+func snapshotSchedule(s models.PublishedSchedule) models.Schedule {
+	return models.Schedule{
+		ID:         s.ScheduleID,
+		UserID:     s.UserID,
+		Date:       s.Date,
+		StartTime:  s.StartTime,
+		EndTime:    s.EndTime,
+		BreakTime:  s.BreakTime,
+		IsFlexTime: s.IsFlexTime,
+		Note:       s.Note,
+		CreatedAt:  s.PublishedAt,
+		UpdatedAt:  s.PublishedAt,
+	}
+}
+
+// publishedSchedulesByID returns what employees may see of the given
+// schedules, keyed by schedule ID, on the same terms as publishedSchedules.
+// Schedules not yet published are missing from the result.
+func publishedSchedulesByID(db *gorm.DB, scheduleIDs []uint) (map[uint]models.Schedule, error) {
+	byID := map[uint]models.Schedule{}
+	if len(scheduleIDs) == 0 {
+		return byID, nil
+	}
+
+	var snapshots []models.PublishedSchedule
+	if err := db.Where("schedule_id IN ?", scheduleIDs).
+		Where("version = (SELECT version FROM schedule_publications WHERE schedule_publications.id = published_schedules.publication_id)").
+		Find(&snapshots).Error; err != nil {
+		return nil, err
+	}
+	for _, s := range snapshots {
+		byID[s.ScheduleID] = snapshotSchedule(s)
+	}
+
+	unassigned := db.Model(&models.User{}).Select("id").Where("department_id IS NULL")
+	var live []models.Schedule
+	if err := db.Where("id IN ? AND user_id IN (?)", scheduleIDs, unassigned).Find(&live).Error; err != nil {
+		return nil, err
+	}
+	for _, s := range live {
+		if _, ok := byID[s.ID]; !ok {
+			byID[s.ID] = s
+		}
+	}
+	return byID, nil
+}
+
+// departmentMonthSchedules loads the live schedules of a department's
+// members for [start, end].
+func departmentMonthSchedules(db *gorm.DB, departmentID uint, start, end time.Time) ([]models.Schedule, error) {
+	members := db.Model(&models.User{}).Select("id").Where("department_id = ?", departmentID)
+	var schedules []models.Schedule
+	err := db.Where("user_id IN (?) AND date >= ? AND date < ?", members, start, end.AddDate(0, 0, 1)).
+		Order("id ASC").Find(&schedules).Error
+	return schedules, err
+}
+
+func publicationSnapshot(db *gorm.DB, publication *models.SchedulePublication) ([]models.PublishedSchedule, error) {
+	var snapshots []models.PublishedSchedule
+	if publication.ID == 0 || publication.Version == 0 {
+		return snapshots, nil
+	}
+	err := db.Where("publication_id = ? AND version = ?", publication.ID, publication.Version).
+		Order("schedule_id ASC").Find(&snapshots).Error
+	return snapshots, err
+}
+
+func shiftLabel(date, start, end time.Time) string {
+	return fmt.Sprintf("%s %s-%s", dateKey(date.In(time.Local)),
+		start.In(time.Local).Format("15:04"), end.In(time.Local).Format("15:04"))
+}
+
+// diffSchedules compares the published snapshot with the live schedules. A
+// schedule that moved to another employee is removed for one and added for
+// the other.
+func diffSchedules(published []models.PublishedSchedule, live []models.Schedule) []models.ScheduleChange {
+	old := map[uint]*models.PublishedSchedule{}
+	for i := range published {
+		old[published[i].ScheduleID] = &published[i]
+	}
+
+	var changes []models.ScheduleChange
+	seen := map[uint]bool{}
+	for _, s := range live {
+		seen[s.ID] = true
+		after := shiftLabel(s.Date, s.StartTime, s.EndTime)
+		p, ok := old[s.ID]
+		if !ok {
+			changes = append(changes, models.ScheduleChange{UserID: s.UserID, ScheduleID: s.ID, Date: s.Date,
+				Kind: models.ScheduleChangeAdded, After: after})
+			continue
+		}
+		before := shiftLabel(p.Date, p.StartTime, p.EndTime)
+		if p.UserID != s.UserID {
+			changes = append(changes,
+				models.ScheduleChange{UserID: p.UserID, ScheduleID: s.ID, Date: p.Date, Kind: models.ScheduleChangeRemoved, Before: before},
+				models.ScheduleChange{UserID: s.UserID, ScheduleID: s.ID, Date: s.Date, Kind: models.ScheduleChangeAdded, After: after})
+			continue
+		}
+		if !p.Date.Equal(s.Date) || !p.StartTime.Equal(s.StartTime) || !p.EndTime.Equal(s.EndTime) ||
+			p.BreakTime != s.BreakTime || p.IsFlexTime != s.IsFlexTime || p.Note != s.Note {
+			changes = append(changes, models.ScheduleChange{UserID: s.UserID, ScheduleID: s.ID, Date: s.Date,
+				Kind: models.ScheduleChangeUpdated, Before: before, After: after})
+		}
+	}
+	for _, p := range published {
+		if !seen[p.ScheduleID] {
+			changes = append(changes, models.ScheduleChange{UserID: p.UserID, ScheduleID: p.ScheduleID, Date: p.Date,
+				Kind: models.ScheduleChangeRemoved, Before: shiftLabel(p.Date, p.StartTime, p.EndTime)})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].UserID != changes[j].UserID {
+			return changes[i].UserID < changes[j].UserID
+		}
+		return changes[i].Date.Before(changes[j].Date)
+	})
+	return changes
+}
+
+// changeNotifications builds one notification per employee listing what
+// changed in their schedule.
+func changeNotifications(month string, changes []models.ScheduleChange) []models.Notification {
+	var notifications []models.Notification
+	var lines []string
+	for i, change := range changes {
+		switch change.Kind {
+		case models.ScheduleChangeAdded:
+			lines = append(lines, "added: "+change.After)
+		case models.ScheduleChangeRemoved:
+			lines = append(lines, "removed: "+change.Before)
+		case models.ScheduleChangeUpdated:
+			lines = append(lines, fmt.Sprintf("changed: %s -> %s", change.Before, change.After))
+		}
+		if i == len(changes)-1 || changes[i+1].UserID != change.UserID {
+			notifications = append(notifications, models.Notification{
+				UserID: change.UserID,
+				Kind:   models.NotificationScheduleChanged,
+				Title:  fmt.Sprintf("Your schedule for %s has changed", month),
+				Body:   strings.Join(lines, "\n"),
+			})
+			lines = nil
+		}
+	}
+	return notifications
+}
+
+func (h *SchedulePublicationHandler) requireDepartment(c echo.Context, departmentID uint) error {
+	allowed, err := canManageDepartment(h.db, c.Get("user_id").(uint), c.Get("user_role").(string), departmentID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+	if !allowed {
+		return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+	}
+	return nil
+}
+
+// publicationTarget parses and authorizes the department and month of a
+// request.
+func (h *SchedulePublicationHandler) publicationTarget(c echo.Context, departmentID uint, month string) (time.Time, time.Time, error) {
+	if departmentID == 0 {
+		return time.Time{}, time.Time{}, echo.NewHTTPError(http.StatusBadRequest, "department_id is required")
+	}
+	start, end, err := monthRange(month)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if err := h.requireDepartment(c, departmentID); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return start, end, nil
+}
+
+// GetPublications lists publication states, optionally for one month or
+// department.
+func (h *SchedulePublicationHandler) GetPublications(c echo.Context) error {
+	query := h.db.Preload("Department")
+	if c.Get("user_role").(string) != "admin" {
+		managed, err := managedDepartmentIDs(h.db, c.Get("user_id").(uint))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+		}
+		if len(managed) == 0 {
+			return c.JSON(http.StatusOK, map[string]interface{}{"data": []models.SchedulePublication{}})
+		}
+		query = query.Where("department_id IN ?", managed)
+	}
+	if month := c.QueryParam("month"); month != "" {
+		query = query.Where("month = ?", month)
+	}
+	if departmentID := c.QueryParam("department_id"); departmentID != "" {
+		query = query.Where("department_id = ?", departmentID)
+	}
+
+	var publications []models.SchedulePublication
+	if err := query.Order("month DESC, department_id ASC").Find(&publications).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve publications")
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": publications,
+	})
+}
+
+// GetPendingChanges previews what publishing a department's month would
+// change for employees.
+func (h *SchedulePublicationHandler) GetPendingChanges(c echo.Context) error {
+	departmentID, err := strconv.ParseUint(c.QueryParam("department_id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "department_id is required")
+	}
+	month := c.QueryParam("month")
+	start, end, err := h.publicationTarget(c, uint(departmentID), month)
+	if err != nil {
+		return err
+	}
+
+	var publication models.SchedulePublication
+	if err := h.db.Where("department_id = ? AND month = ?", departmentID, month).
+		Limit(1).Find(&publication).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve publication")
+	}
+	published, err := publicationSnapshot(h.db, &publication)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve published schedules")
+	}
+	live, err := departmentMonthSchedules(h.db, uint(departmentID), start, end)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve schedules")
+	}
+
+	changes := diffSchedules(published, live)
+	if changes == nil {
+		changes = []models.ScheduleChange{}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"department_id": departmentID,
+		"month":         month,
+		"version":       publication.Version,
+		"changes":       changes,
+	})
+}
+
+// GetPublicationChanges lists the recorded changes of every version after
+// the first.
+func (h *SchedulePublicationHandler) GetPublicationChanges(c echo.Context) error {
+	publicationID, err := strconv.ParseUint(c.Param("publicationId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid publication ID")
+	}
+
+	var publication models.SchedulePublication
+	if err := h.db.First(&publication, publicationID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Publication not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve publication")
+	}
+	if err := h.requireDepartment(c, publication.DepartmentID); err != nil {
+		return err
+	}
+
+	var changes []models.ScheduleChange
+	if err := h.db.Where("publication_id = ?", publication.ID).
+		Order("version DESC, user_id ASC, date ASC").Find(&changes).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve changes")
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"publication": publication,
+		"changes":     changes,
+	})
+}
+
+// PublishSchedules snapshots a department's month as the next version.
+// The first publish tells every scheduled employee; later ones record the
+// differences and tell only the employees affected.
+func (h *SchedulePublicationHandler) PublishSchedules(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+
+	var req PublishSchedulesRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	start, end, err := h.publicationTarget(c, req.DepartmentID, req.Month)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var publication models.SchedulePublication
+	var changes []models.ScheduleChange
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		publication = models.SchedulePublication{DepartmentID: req.DepartmentID, Month: req.Month}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&publication).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("department_id = ? AND month = ?", req.DepartmentID, req.Month).First(&publication).Error; err != nil {
+			return err
+		}
+
+		published, err := publicationSnapshot(tx, &publication)
+		if err != nil {
+			return err
+		}
+		live, err := departmentMonthSchedules(tx, req.DepartmentID, start, end)
+		if err != nil {
+			return err
+		}
+		changes = diffSchedules(published, live)
+		if publication.Version > 0 && len(changes) == 0 {
+			return errNothingToPublish
+		}
+
+		publication.Version++
+		publication.PublishedAt = &now
+		publication.PublishedBy = &userID
+		if err := tx.Save(&publication).Error; err != nil {
+			return err
+		}
+
+		snapshots := make([]models.PublishedSchedule, 0, len(live))
+		for _, s := range live {
+			snapshots = append(snapshots, models.PublishedSchedule{
+				PublicationID: publication.ID,
+				Version:       publication.Version,
+				ScheduleID:    s.ID,
+				UserID:        s.UserID,
+				Date:          s.Date,
+				StartTime:     s.StartTime,
+				EndTime:       s.EndTime,
+				BreakTime:     s.BreakTime,
+				IsFlexTime:    s.IsFlexTime,
+				Note:          s.Note,
+				PublishedAt:   now,
+			})
+		}
+		if len(snapshots) > 0 {
+			if err := tx.CreateInBatches(&snapshots, 500).Error; err != nil {
+				return err
+			}
+		}
+
+		var notifications []models.Notification
+		if publication.Version == 1 {
+			shifts := map[uint]int{}
+			var users []uint
+			for _, s := range live {
+				if shifts[s.UserID] == 0 {
+					users = append(users, s.UserID)
+				}
+				shifts[s.UserID]++
+			}
+			for _, id := range users {
+				notifications = append(notifications, models.Notification{
+					UserID: id,
+					Kind:   models.NotificationSchedulePublished,
+					Title:  fmt.Sprintf("Your schedule for %s is published", req.Month),
+					Body:   fmt.Sprintf("%d shifts", shifts[id]),
+				})
+			}
+		} else {
+			for i := range changes {
+				changes[i].PublicationID = publication.ID
+				changes[i].Version = publication.Version
+			}
+			if err := tx.CreateInBatches(&changes, 500).Error; err != nil {
+				return err
+			}
+			notifications = changeNotifications(req.Month, changes)
+		}
+		if len(notifications) == 0 {
+			return nil
+		}
+		return tx.Create(&notifications).Error
+	})
+	if err != nil {
+		if errors.Is(err, errNothingToPublish) {
+			return echo.NewHTTPError(http.StatusConflict, "No changes since the last publish")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to publish schedules")
+	}
+
+	if changes == nil {
+		changes = []models.ScheduleChange{}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"publication": publication,
+		"changes":     changes,
+	})
+}
+
+// republishReassigned moves reassigned schedules to their new owner in the
+// published snapshots that contain them. Each affected publication gets a
+// new version identical to the last apart from these rows, so both
+// employees see the change at once without publishing the manager's other
+// pending edits.
+func republishReassigned(tx *gorm.DB, schedules []models.Schedule, publishedBy *uint, now time.Time) error {
+	byID := map[uint]models.Schedule{}
+	ids := make([]uint, 0, len(schedules))
+	for _, s := range schedules {
+		byID[s.ID] = s
+		ids = append(ids, s.ID)
+	}
+
+	var publicationIDs []uint
+	if err := tx.Model(&models.PublishedSchedule{}).Distinct("publication_id").
+		Where("schedule_id IN ?", ids).
+		Where("version = (SELECT version FROM schedule_publications WHERE schedule_publications.id = published_schedules.publication_id)").
+		Order("publication_id ASC").Pluck("publication_id", &publicationIDs).Error; err != nil {
+		return err
+	}
+
+	for _, publicationID := range publicationIDs {
+		var publication models.SchedulePublication
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&publication, publicationID).Error; err != nil {
+			return err
+		}
+		published, err := publicationSnapshot(tx, &publication)
+		if err != nil {
+			return err
+		}
+
+		// Only the owner changes; other unpublished edits to these rows wait
+		// for the manager's next publish.
+		next := make([]models.Schedule, 0, len(published))
+		for _, p := range published {
+			userID := p.UserID
+			if s, ok := byID[p.ScheduleID]; ok {
+				userID = s.UserID
+			}
+			next = append(next, models.Schedule{ID: p.ScheduleID, UserID: userID, Date: p.Date, StartTime: p.StartTime,
+				EndTime: p.EndTime, BreakTime: p.BreakTime, IsFlexTime: p.IsFlexTime, Note: p.Note})
+		}
+		changes := diffSchedules(published, next)
+		if len(changes) == 0 {
+			continue
+		}
+
+		publication.Version++
+		publication.PublishedAt = &now
+		publication.PublishedBy = publishedBy
+		if err := tx.Save(&publication).Error; err != nil {
+			return err
+		}
+		snapshots := make([]models.PublishedSchedule, 0, len(next))
+		for _, s := range next {
+			snapshots = append(snapshots, models.PublishedSchedule{
+				PublicationID: publication.ID,
+				Version:       publication.Version,
+				ScheduleID:    s.ID,
+				UserID:        s.UserID,
+				Date:          s.Date,
+				StartTime:     s.StartTime,
+				EndTime:       s.EndTime,
+				BreakTime:     s.BreakTime,
+				IsFlexTime:    s.IsFlexTime,
+				Note:          s.Note,
+				PublishedAt:   now,
+			})
+		}
+		if err := tx.CreateInBatches(&snapshots, 500).Error; err != nil {
+			return err
+		}
+		for i := range changes {
+			changes[i].PublicationID = publication.ID
+			changes[i].Version = publication.Version
+		}
+		if err := tx.Create(&changes).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(changeNotifications(publication.Month, changes)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
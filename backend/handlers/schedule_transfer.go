@@ -0,0 +1,471 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+	"github.com/yudai-uk/backend/xlsx"
+	"gorm.io/gorm"
+)
+
+const (
+	maxImportBytes   = 5 << 20
+	maxImportRows    = 5000
+	maxImportColumns = 64 // room for notes beside the import columns
+)
+
+var errImportInvalid = errors.New("import has invalid rows")
+
+// scheduleColumns is the column order shared by import and export.
+var scheduleColumns = []string{"user_code", "date", "start_time", "end_time", "break_time", "is_flex_time", "note"}
+
+const utf8BOM = "\ufeff"
+
+// ScheduleImportError points at the row, and column where known, that
+// failed validation. Rows are numbered as the spreadsheet shows them.
+type ScheduleImportError struct {
+	Row     int    `json:"row"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// importedSchedule is one parsed row, before it is checked against the
+// database.
+type importedSchedule struct {
+	row        int
+	code       string
+	day        time.Time
+	startClock string
+	endClock   string
+	breakTime  *int
+	isFlexTime bool
+	note       string
+}
+
+// readSpreadsheet returns the rows of an uploaded CSV or XLSX file.
+func readSpreadsheet(fileName string, data []byte) ([][]string, error) {
+	if strings.EqualFold(filepath.Ext(fileName), ".xlsx") || bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		// One extra row for the header.
+		return xlsx.ReadRows(bytes.NewReader(data), int64(len(data)), maxImportRows+1, maxImportColumns)
+	}
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte(utf8BOM))))
+	r.FieldsPerRecord = -1
+	return r.ReadAll()
+}
+
+// parseCellDate accepts ISO dates, the slash form Excel displays, and Excel
+// date serials from cells formatted as dates.
+func parseCellDate(s string) (time.Time, error) {
+	if day, err := parseLocalDate(s); err == nil {
+		return day, nil
+	}
+	if day, err := time.ParseInLocation("2006/1/2", s, time.Local); err == nil {
+		return day, nil
+	}
+	if serial, err := strconv.ParseFloat(s, 64); err == nil && serial >= 1 && serial < 100000 {
+		return time.Date(1899, 12, 30, 0, 0, 0, 0, time.Local).AddDate(0, 0, int(serial)), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", s)
+}
+
+// parseCellClock normalizes H:MM, HH:MM:SS and Excel time fractions to HH:MM.
+func parseCellClock(s string) (string, error) {
+	if fraction, err := strconv.ParseFloat(s, 64); err == nil && fraction >= 0 && fraction < 1 {
+		minutes := int(math.Round(fraction * 24 * 60))
+		return fmt.Sprintf("%02d:%02d", minutes/60%24, minutes%60), nil
+	}
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("15:04"), nil
+		}
+	}
+	return "", fmt.Errorf("invalid time %q, expected HH:MM", s)
+}
+
+func parseCellBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "", "0", "false", "no", "n":
+		return false, nil
+	case "1", "true", "yes", "y":
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid flag %q, expected true or false", s)
+}
+
+// parseScheduleRows turns spreadsheet rows into schedules, skipping a header
+// row and blank lines. Cell errors are returned per row rather than failing
+// the whole file.
+func parseScheduleRows(rows [][]string) ([]importedSchedule, []ScheduleImportError) {
+	var parsed []importedSchedule
+	var rowErrors []ScheduleImportError
+	for i, cells := range rows {
+		row := i + 1
+		for j := range cells {
+			cells[j] = strings.TrimSpace(cells[j])
+		}
+		if i == 0 && len(cells) > 0 && strings.EqualFold(cells[0], scheduleColumns[0]) {
+			continue
+		}
+		if strings.Join(cells, "") == "" {
+			continue
+		}
+		for len(cells) < len(scheduleColumns) {
+			cells = append(cells, "")
+		}
+
+		s := importedSchedule{row: row, code: cells[0], note: cells[6]}
+		fail := func(column string, err error) {
+			rowErrors = append(rowErrors, ScheduleImportError{Row: row, Column: column, Message: err.Error()})
+		}
+		ok := true
+		if s.code == "" {
+			fail("user_code", errors.New("user_code is required"))
+			ok = false
+		}
+		var err error
+		if s.day, err = parseCellDate(cells[1]); err != nil {
+			fail("date", err)
+			ok = false
+		}
+		if s.startClock, err = parseCellClock(cells[2]); err != nil {
+			fail("start_time", err)
+			ok = false
+		}
+		if s.endClock, err = parseCellClock(cells[3]); err != nil {
+			fail("end_time", err)
+			ok = false
+		}
+		if cells[4] != "" {
+			minutes, err := strconv.Atoi(cells[4])
+			if err != nil {
+				fail("break_time", fmt.Errorf("invalid break_time %q, expected minutes", cells[4]))
+				ok = false
+			}
+			s.breakTime = &minutes
+		}
+		if s.isFlexTime, err = parseCellBool(cells[5]); err != nil {
+			fail("is_flex_time", err)
+			ok = false
+		}
+		if ok {
+			parsed = append(parsed, s)
+		}
+	}
+	return parsed, rowErrors
+}
+
+// resolveUserCodes maps each code to a user, matching the employee code
+// first and the email address second.
+func resolveUserCodes(db *gorm.DB, codes []string) (map[string]uint, error) {
+	var users []models.User
+	if err := db.Select("id", "email", "employee_code").
+		Where("employee_code IN ? OR email IN ?", codes, codes).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	byCode := map[string]uint{}
+	for _, u := range users {
+		if _, ok := byCode[u.Email]; !ok {
+			byCode[u.Email] = u.ID
+		}
+	}
+	for _, u := range users {
+		if u.EmployeeCode != nil {
+			byCode[*u.EmployeeCode] = u.ID
+		}
+	}
+	return byCode, nil
+}
+
+// ImportSchedules loads schedules from a CSV or XLSX upload. Every row is
+// validated first and errors are reported per row; the rows are then
+// written in a single transaction, or not at all. With dry_run nothing is
+// written. With replace, existing schedules on an imported day are
+// overwritten instead of reported as duplicates.
+func (h *ScheduleHandler) ImportSchedules(c echo.Context) error {
+	dryRun, _ := strconv.ParseBool(c.FormValue("dry_run"))
+	replace, _ := strconv.ParseBool(c.FormValue("replace"))
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "file is required")
+	}
+	if fileHeader.Size > maxImportBytes {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("File exceeds %d bytes", maxImportBytes))
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Failed to read file")
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxImportBytes+1))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Failed to read file")
+	}
+	if len(data) > maxImportBytes {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("File exceeds %d bytes", maxImportBytes))
+	}
+
+	rows, err := readSpreadsheet(fileHeader.Filename, data)
+	if errors.Is(err, xlsx.ErrTooLarge) {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("File must not exceed %d rows or %d columns", maxImportRows, maxImportColumns))
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "File is not a readable CSV or XLSX spreadsheet")
+	}
+	if len(rows) > maxImportRows+1 {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("File must not exceed %d rows", maxImportRows))
+	}
+
+	parsed, rowErrors := parseScheduleRows(rows)
+
+	scope, err := scopeFor(c, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+
+	var codes []string
+	for _, s := range parsed {
+		codes = append(codes, s.code)
+	}
+	byCode := map[string]uint{}
+	if len(codes) > 0 {
+		if byCode, err = resolveUserCodes(h.db, codes); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve users")
+		}
+	}
+
+	// Drop rows whose user cannot be resolved or appears twice on one day,
+	// so the remaining rows can still be checked against the database.
+	type userDay struct {
+		userID uint
+		day    string
+	}
+	firstRow := map[userDay]int{}
+	userIDs := map[uint]bool{}
+	var valid []importedSchedule
+	var validUsers []uint
+	for _, s := range parsed {
+		userID, ok := byCode[s.code]
+		if !ok || !scope.contains(userID) {
+			rowErrors = append(rowErrors, ScheduleImportError{Row: s.row, Column: "user_code",
+				Message: fmt.Sprintf("unknown user_code %q", s.code)})
+			continue
+		}
+		key := userDay{userID, dateKey(s.day)}
+		if first, seen := firstRow[key]; seen {
+			rowErrors = append(rowErrors, ScheduleImportError{Row: s.row, Column: "date",
+				Message: fmt.Sprintf("duplicates row %d", first)})
+			continue
+		}
+		firstRow[key] = s.row
+		userIDs[userID] = true
+		valid = append(valid, s)
+		validUsers = append(validUsers, userID)
+	}
+
+	closed := map[string]bool{}
+	if len(valid) > 0 {
+		first, last := valid[0].day, valid[0].day
+		for _, s := range valid {
+			if s.day.Before(first) {
+				first = s.day
+			}
+			if s.day.After(last) {
+				last = s.day
+			}
+		}
+		months, err := models.ClosedMonths(h.db, first, last)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to check the closing period")
+		}
+		for _, m := range months {
+			closed[m] = true
+		}
+	}
+
+	var created []models.Schedule
+	replaced := 0
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		locked := make([]uint, 0, len(userIDs))
+		for id := range userIDs {
+			locked = append(locked, id)
+		}
+		sort.Slice(locked, func(i, j int) bool { return locked[i] < locked[j] })
+		for _, id := range locked {
+			if err := lockUser(tx, id); err != nil {
+				return err
+			}
+		}
+
+		for i, s := range valid {
+			userID := validUsers[i]
+			if month := s.day.Format("2006-01"); closed[month] {
+				rowErrors = append(rowErrors, ScheduleImportError{Row: s.row, Column: "date",
+					Message: fmt.Sprintf("the period %s is closed", month)})
+				continue
+			}
+			startTime, endTime, breakMinutes, err := buildShift(s.day, s.startClock, s.endClock, s.breakTime)
+			if err != nil {
+				var httpErr *echo.HTTPError
+				if !errors.As(err, &httpErr) {
+					return err
+				}
+				rowErrors = append(rowErrors, ScheduleImportError{Row: s.row, Message: fmt.Sprint(httpErr.Message)})
+				continue
+			}
+			if replace {
+				result := tx.Where("user_id = ? AND date >= ? AND date < ?", userID, s.day, s.day.AddDate(0, 0, 1)).
+					Delete(&models.Schedule{})
+				if result.Error != nil {
+					return result.Error
+				}
+				replaced += int(result.RowsAffected)
+			}
+			reason, err := scheduleConflict(tx, userID, s.day, 0)
+			if err != nil {
+				return err
+			}
+			if reason != "" {
+				rowErrors = append(rowErrors, ScheduleImportError{Row: s.row, Column: "date",
+					Message: fmt.Sprintf("cannot schedule %s: %s", dateKey(s.day), reason)})
+				continue
+			}
+			created = append(created, models.Schedule{
+				UserID:     userID,
+				Date:       s.day,
+				StartTime:  startTime,
+				EndTime:    endTime,
+				BreakTime:  breakMinutes,
+				IsFlexTime: s.isFlexTime,
+				Note:       s.note,
+				Source:     models.ScheduleManual,
+			})
+		}
+
+		if len(rowErrors) > 0 {
+			return errImportInvalid
+		}
+		if dryRun {
+			return errDryRun
+		}
+		if len(created) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&created, 500).Error
+	})
+
+	sort.SliceStable(rowErrors, func(i, j int) bool { return rowErrors[i].Row < rowErrors[j].Row })
+	response := map[string]interface{}{
+		"dry_run":  dryRun,
+		"rows":     len(parsed),
+		"created":  len(created),
+		"replaced": replaced,
+		"errors":   rowErrors,
+	}
+	switch {
+	case errors.Is(err, errImportInvalid):
+		response["created"] = 0
+		response["replaced"] = 0
+		return c.JSON(http.StatusUnprocessableEntity, response)
+	case errors.Is(err, errDryRun):
+		response["errors"] = []ScheduleImportError{}
+		return c.JSON(http.StatusOK, response)
+	case err != nil:
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to import schedules")
+	}
+
+	response["errors"] = []ScheduleImportError{}
+	return c.JSON(http.StatusCreated, response)
+}
+
+// ExportSchedules writes a month of schedules in the import format, as CSV
+// (default) or XLSX. It accepts the same filters as GetSchedules.
+func (h *ScheduleHandler) ExportSchedules(c echo.Context) error {
+	month := c.QueryParam("month")
+	format := c.QueryParam("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "xlsx" {
+		return echo.NewHTTPError(http.StatusBadRequest, "format must be csv or xlsx")
+	}
+
+	query, err := h.scheduleQuery(c, month)
+	if err != nil {
+		return err
+	}
+	var schedules []models.Schedule
+	if err := query.Order("date ASC, user_id ASC").Find(&schedules).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve schedules")
+	}
+
+	res := c.Response()
+	fileName := fmt.Sprintf("schedules-%s.%s", month, format)
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, fileName))
+
+	if format == "xlsx" {
+		res.Header().Set(echo.HeaderContentType, xlsx.ContentType)
+		res.WriteHeader(http.StatusOK)
+		w, err := xlsx.NewWriter(res, "schedules")
+		if err != nil {
+			return err
+		}
+		if err := w.WriteRow(scheduleColumns); err != nil {
+			return err
+		}
+		for i := range schedules {
+			if err := w.WriteRow(scheduleRow(&schedules[i])); err != nil {
+				return err
+			}
+		}
+		return w.Close()
+	}
+
+	// The byte order mark lets Excel detect UTF-8 in Japanese notes.
+	res.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	res.WriteHeader(http.StatusOK)
+	if _, err := io.WriteString(res, utf8BOM); err != nil {
+		return err
+	}
+	w := csv.NewWriter(res)
+	if err := w.Write(scheduleColumns); err != nil {
+		return err
+	}
+	for i := range schedules {
+		if err := w.Write(scheduleRow(&schedules[i])); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// scheduleRow formats a schedule in scheduleColumns order.
+func scheduleRow(s *models.Schedule) []string {
+	code := s.User.Email
+	if s.User.EmployeeCode != nil {
+		code = *s.User.EmployeeCode
+	}
+	return []string{
+		code,
+		dateKey(s.Date.In(time.Local)),
+		s.StartTime.In(time.Local).Format("15:04"),
+		s.EndTime.In(time.Local).Format("15:04"),
+		strconv.Itoa(s.BreakTime),
+		strconv.FormatBool(s.IsFlexTime),
+		s.Note,
+	}
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+	"gorm.io/gorm"
+)
+
+// userScope is the set of users whose data the caller may see and act on.
+// Admins see everyone; managers see their own subtree of the organization;
+// everyone else sees only themselves.
+type userScope struct {
+	all     bool
+	userIDs map[uint]bool
+}
+
+func (s userScope) contains(userID uint) bool {
+	return s.all || s.userIDs[userID]
+}
+
+func (s userScope) ids() []uint {
+	ids := make([]uint, 0, len(s.userIDs))
+	for id := range s.userIDs {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// apply restricts query to rows whose column is a user in scope.
+func (s userScope) apply(query *gorm.DB, column string) *gorm.DB {
+	if s.all {
+		return query
+	}
+	ids := s.ids()
+	if len(ids) == 0 {
+		return query.Where("1 = 0")
+	}
+	return query.Where(column+" IN ?", ids)
+}
+
+func scopeFor(c echo.Context, db *gorm.DB) (userScope, error) {
+	return resolveUserScope(db, c.Get("user_id").(uint), c.Get("user_role").(string))
+}
+
+func resolveUserScope(db *gorm.DB, actorID uint, role string) (userScope, error) {
+	if role == "admin" {
+		return userScope{all: true}, nil
+	}
+	scope := userScope{userIDs: map[uint]bool{actorID: true}}
+	if role != "manager" {
+		return scope, nil
+	}
+
+	subordinates, err := managedUserIDs(db, actorID)
+	if err != nil {
+		return userScope{}, err
+	}
+	for _, id := range subordinates {
+		scope.userIDs[id] = true
+	}
+	return scope, nil
+}
+
+// managedUserIDs returns everyone below managerID: members of the
+// departments they manage (and all descendant departments), plus everyone
+// whose reporting line leads up to them.
+func managedUserIDs(db *gorm.DB, managerID uint) ([]uint, error) {
+	departmentIDs, err := managedDepartmentIDs(db, managerID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[uint]bool{}
+	var result []uint
+	if len(departmentIDs) > 0 {
+		var members []uint
+		if err := db.Model(&models.User{}).Where("department_id IN ?", departmentIDs).
+			Pluck("id", &members).Error; err != nil {
+			return nil, err
+		}
+		for _, id := range members {
+			if id != managerID && !seen[id] {
+				seen[id] = true
+				result = append(result, id)
+			}
+		}
+	}
+
+	frontier := []uint{managerID}
+	for len(frontier) > 0 {
+		var reports []uint
+		if err := db.Model(&models.User{}).Where("manager_id IN ?", frontier).
+			Pluck("id", &reports).Error; err != nil {
+			return nil, err
+		}
+		frontier = frontier[:0]
+		for _, id := range reports {
+			if id != managerID && !seen[id] {
+				seen[id] = true
+				result = append(result, id)
+				frontier = append(frontier, id)
+			}
+		}
+	}
+	return result, nil
+}
+
+// managedDepartmentIDs returns the departments headed by managerID and all
+// of their descendants.
+func managedDepartmentIDs(db *gorm.DB, managerID uint) ([]uint, error) {
+	var roots []uint
+	if err := db.Model(&models.Department{}).Where("manager_id = ?", managerID).
+		Pluck("id", &roots).Error; err != nil {
+		return nil, err
+	}
+	return departmentSubtree(db, roots)
+}
+
+// canManageDepartment reports whether the actor may plan for departmentID:
+// admins always, managers for the departments they head and below.
+func canManageDepartment(db *gorm.DB, actorID uint, role string, departmentID uint) (bool, error) {
+	if role == "admin" {
+		return true, nil
+	}
+	if role != "manager" {
+		return false, nil
+	}
+	managed, err := managedDepartmentIDs(db, actorID)
+	if err != nil {
+		return false, err
+	}
+	for _, id := range managed {
+		if id == departmentID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func departmentSubtree(db *gorm.DB, roots []uint) ([]uint, error) {
+	seen := map[uint]bool{}
+	var result []uint
+	frontier := roots
+	for len(frontier) > 0 {
+		var next []uint
+		for _, id := range frontier {
+			if !seen[id] {
+				seen[id] = true
+				result = append(result, id)
+				next = append(next, id)
+			}
+		}
+		if len(next) == 0 {
+			break
+		}
+		var children []uint
+		if err := db.Model(&models.Department{}).Where("parent_id IN ?", next).
+			Pluck("id", &children).Error; err != nil {
+			return nil, err
+		}
+		frontier = children
+	}
+	return result, nil
+}
+
+// departmentChain returns departmentID followed by its ancestors up to the root.
+func departmentChain(db *gorm.DB, departmentID uint) ([]models.Department, error) {
+	var chain []models.Department
+	seen := map[uint]bool{}
+	id := &departmentID
+	for id != nil && !seen[*id] {
+		seen[*id] = true
+		var dept models.Department
+		if err := db.First(&dept, *id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				break
+			}
+			return nil, err
+		}
+		chain = append(chain, dept)
+		id = dept.ParentID
+	}
+	return chain, nil
+}
+
+// lineManagerOf resolves who a user reports to: their explicit manager, or
+// else the nearest department head above them other than themselves.
+func lineManagerOf(db *gorm.DB, user *models.User) (*uint, error) {
+	if user.ManagerID != nil {
+		return user.ManagerID, nil
+	}
+	if user.DepartmentID == nil {
+		return nil, nil
+	}
+	chain, err := departmentChain(db, *user.DepartmentID)
+	if err != nil {
+		return nil, err
+	}
+	for _, dept := range chain {
+		if dept.ManagerID != nil && *dept.ManagerID != user.ID {
+			return dept.ManagerID, nil
+		}
+	}
+	return nil, nil
+}
+
+// departmentHeadOf resolves the head of the top-level department the user
+// belongs to.
+func departmentHeadOf(db *gorm.DB, user *models.User) (*uint, error) {
+	if user.DepartmentID == nil {
+		return nil, nil
+	}
+	chain, err := departmentChain(db, *user.DepartmentID)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		if chain[i].ManagerID != nil && *chain[i].ManagerID != user.ID {
+			return chain[i].ManagerID, nil
+		}
+	}
+	return nil, nil
+}
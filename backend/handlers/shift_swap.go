@@ -0,0 +1,661 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errSwapNotActionable = errors.New("shift swap request is not in an actionable state")
+	errSwapStale         = errors.New("schedule changed since the request was made")
+	errShiftStarted      = errors.New("shift has already started")
+)
+
+type ShiftSwapHandler struct {
+	db *gorm.DB
+}
+
+func NewShiftSwapHandler(db *gorm.DB) *ShiftSwapHandler {
+	return &ShiftSwapHandler{db: db}
+}
+
+type CreateShiftSwapRequest struct {
+	ScheduleID        uint                 `json:"schedule_id" validate:"required"`
+	Kind              models.ShiftSwapKind `json:"kind" validate:"required"` // swap or cover
+	TargetUserID      *uint                `json:"target_user_id"`           // omit to post on the cover board
+	CounterScheduleID *uint                `json:"counter_schedule_id"`      // swap with a named colleague
+	Reason            string               `json:"reason"`
+}
+
+type AcceptShiftSwapRequest struct {
+	CounterScheduleID *uint `json:"counter_schedule_id"` // required for swaps not already naming one
+}
+
+type UpdateShiftSwapStatusRequest struct {
+	Status models.ApprovalDecision `json:"status" validate:"required"` // approved or rejected
+	Note   string                  `json:"note"`
+}
+
+// swapRequiresApproval reports whether accepted swaps wait for a manager.
+func swapRequiresApproval() bool {
+	return envInt("SHIFT_SWAP_REQUIRES_APPROVAL", 1) != 0
+}
+
+// minRestHours is the minimum gap between the end of one shift and the
+// start of the next (勤務間インターバル).
+func minRestHours() int {
+	return envInt("MIN_REST_HOURS", 11)
+}
+
+// restIntervalConflict reports whether giving userID a shift from start to
+// end would overlap another of their shifts or leave less than the minimum
+// rest either side. excludeID is a schedule the user is giving up.
+func restIntervalConflict(db *gorm.DB, userID uint, start, end time.Time, excludeID uint) (string, error) {
+	rest := time.Duration(minRestHours()) * time.Hour
+
+	var prev models.Schedule
+	err := db.Where("user_id = ? AND id != ? AND start_time < ?", userID, excludeID, start).
+		Order("start_time DESC").Take(&prev).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+	if err == nil {
+		if prev.EndTime.After(start) {
+			return "overlap", nil
+		}
+		if start.Sub(prev.EndTime) < rest {
+			return "rest_interval", nil
+		}
+	}
+
+	var next models.Schedule
+	err = db.Where("user_id = ? AND id != ? AND start_time >= ?", userID, excludeID, start).
+		Order("start_time ASC").Take(&next).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+	if err == nil {
+		if end.After(next.StartTime) {
+			return "overlap", nil
+		}
+		if next.StartTime.Sub(end) < rest {
+			return "rest_interval", nil
+		}
+	}
+	return "", nil
+}
+
+// checkShiftTransfer validates that userID can take schedule, giving up
+// excludeID in return, against their schedules, leave and rest interval.
+func checkShiftTransfer(db *gorm.DB, userID uint, schedule *models.Schedule, excludeID uint) error {
+	reason, err := scheduleConflict(db, userID, schedule.Date.In(time.Local), excludeID)
+	if err != nil {
+		return err
+	}
+	if reason == "" {
+		reason, err = restIntervalConflict(db, userID, schedule.StartTime, schedule.EndTime, excludeID)
+		if err != nil {
+			return err
+		}
+	}
+	if reason != "" {
+		return echo.NewHTTPError(http.StatusConflict,
+			fmt.Sprintf("User %d cannot take the shift on %s: %s", userID, dateKey(schedule.Date.In(time.Local)), reason))
+	}
+	return nil
+}
+
+// loadSwapSchedule locks a schedule and checks it still belongs to ownerID,
+// has not started and is published to ownerID. Drafts are not yet anyone's
+// shift to give away or take in exchange.
+func loadSwapSchedule(tx *gorm.DB, scheduleID, ownerID uint, now time.Time) (*models.Schedule, error) {
+	var schedule models.Schedule
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&schedule, scheduleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errSwapStale
+		}
+		return nil, err
+	}
+	if schedule.UserID != ownerID {
+		return nil, errSwapStale
+	}
+	if !schedule.StartTime.After(now) {
+		return nil, errShiftStarted
+	}
+	published, err := publishedSchedulesByID(tx, []uint{schedule.ID})
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := published[schedule.ID]; !ok || p.UserID != ownerID {
+		return nil, errSwapStale
+	}
+	return &schedule, nil
+}
+
+// executeShiftSwap reassigns the schedules of an accepted request: the
+// offered shift goes to the accepter and, for swaps, the counter shift to
+// the requester. Both sides are validated again under lock.
+func executeShiftSwap(tx *gorm.DB, swap *models.ShiftSwapRequest, now time.Time) error {
+	accepterID := *swap.AccepterID
+	users := []uint{swap.RequesterID, accepterID}
+	sort.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+	for _, id := range users {
+		if err := lockUser(tx, id); err != nil {
+			return err
+		}
+	}
+
+	offered, err := loadSwapSchedule(tx, swap.ScheduleID, swap.RequesterID, now)
+	if err != nil {
+		return err
+	}
+	var counter *models.Schedule
+	var counterID uint
+	if swap.Kind == models.ShiftSwapExchange {
+		if counter, err = loadSwapSchedule(tx, *swap.CounterScheduleID, accepterID, now); err != nil {
+			return err
+		}
+		counterID = counter.ID
+	}
+
+	if err := checkShiftTransfer(tx, accepterID, offered, counterID); err != nil {
+		return err
+	}
+	if counter != nil {
+		if err := checkShiftTransfer(tx, swap.RequesterID, counter, offered.ID); err != nil {
+			return err
+		}
+	}
+
+	// Reassigned rows are overrides that rota regeneration must keep.
+	if err := tx.Model(offered).Updates(map[string]interface{}{
+		"user_id": accepterID,
+		"source":  models.ScheduleManual,
+	}).Error; err != nil {
+		return err
+	}
+	offered.UserID = accepterID
+	reassigned := []models.Schedule{*offered}
+	scheduleIDs := []uint{offered.ID}
+	if counter != nil {
+		if err := tx.Model(counter).Updates(map[string]interface{}{
+			"user_id": swap.RequesterID,
+			"source":  models.ScheduleManual,
+		}).Error; err != nil {
+			return err
+		}
+		counter.UserID = swap.RequesterID
+		reassigned = append(reassigned, *counter)
+		scheduleIDs = append(scheduleIDs, counter.ID)
+	}
+	// Employees read the published snapshot, which would otherwise show the
+	// old assignment until the next publish.
+	if err := republishReassigned(tx, reassigned, swap.DecidedBy, now); err != nil {
+		return err
+	}
+
+	swap.Status = models.ShiftSwapCompleted
+	if err := tx.Save(swap).Error; err != nil {
+		return err
+	}
+
+	// Other requests offering these shifts no longer make sense.
+	return tx.Model(&models.ShiftSwapRequest{}).
+		Where("id != ? AND status IN ?", swap.ID, models.ActiveShiftSwapStatuses).
+		Where("(schedule_id IN ? OR counter_schedule_id IN ?)", scheduleIDs, scheduleIDs).
+		Updates(map[string]interface{}{"status": models.ShiftSwapCancelled, "decision_note": "shift reassigned by another request"}).Error
+}
+
+// scheduleOffered reports whether a schedule is already part of an active
+// request.
+func scheduleOffered(db *gorm.DB, scheduleID uint) (bool, error) {
+	var count int64
+	err := db.Model(&models.ShiftSwapRequest{}).
+		Where("status IN ? AND (schedule_id = ? OR counter_schedule_id = ?)", models.ActiveShiftSwapStatuses, scheduleID, scheduleID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func shiftSwapError(err error, fallback string) error {
+	var httpErr *echo.HTTPError
+	switch {
+	case errors.As(err, &httpErr):
+		return httpErr
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "Shift swap request not found")
+	case errors.Is(err, errSwapNotActionable):
+		return echo.NewHTTPError(http.StatusConflict, "Shift swap request can no longer be changed")
+	case errors.Is(err, errSwapStale):
+		return echo.NewHTTPError(http.StatusConflict, "Schedule changed since the request was made")
+	case errors.Is(err, errShiftStarted):
+		return echo.NewHTTPError(http.StatusConflict, "Shift has already started")
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, fallback)
+}
+
+func preloadShiftSwap(db *gorm.DB) *gorm.DB {
+	return db.Preload("Requester").Preload("TargetUser").Preload("Accepter")
+}
+
+// publishedSwapSchedules fills in the schedules of swaps as employees see
+// them, so that colleagues never learn unpublished times through a request.
+func publishedSwapSchedules(db *gorm.DB, swaps []models.ShiftSwapRequest) error {
+	ids := []uint{}
+	for _, swap := range swaps {
+		ids = append(ids, swap.ScheduleID)
+		if swap.CounterScheduleID != nil {
+			ids = append(ids, *swap.CounterScheduleID)
+		}
+	}
+	published, err := publishedSchedulesByID(db, ids)
+	if err != nil {
+		return err
+	}
+	for i := range swaps {
+		swaps[i].Schedule = published[swaps[i].ScheduleID]
+		swaps[i].CounterSchedule = nil
+		if id := swaps[i].CounterScheduleID; id != nil {
+			if counter, ok := published[*id]; ok {
+				swaps[i].CounterSchedule = &counter
+			}
+		}
+	}
+	return nil
+}
+
+// reloadShiftSwap reads swap back with its people and published schedules.
+func (h *ShiftSwapHandler) reloadShiftSwap(swap *models.ShiftSwapRequest) error {
+	if err := preloadShiftSwap(h.db).First(swap, swap.ID).Error; err != nil {
+		return err
+	}
+	swaps := []models.ShiftSwapRequest{*swap}
+	if err := publishedSwapSchedules(h.db, swaps); err != nil {
+		return err
+	}
+	*swap = swaps[0]
+	return nil
+}
+
+// GetShiftSwaps lists requests the caller made, was asked, or accepted.
+func (h *ShiftSwapHandler) GetShiftSwaps(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+
+	query := preloadShiftSwap(h.db).
+		Where("(requester_id = ? OR target_user_id = ? OR accepter_id = ?)", userID, userID, userID)
+	if status := c.QueryParam("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var swaps []models.ShiftSwapRequest
+	if err := query.Order("created_at DESC").Find(&swaps).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve shift swap requests")
+	}
+	if err := publishedSwapSchedules(h.db, swaps); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve schedules")
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": swaps,
+	})
+}
+
+// GetShiftSwapBoard lists open requests without a named colleague from the
+// caller's department whose shifts have not started.
+func (h *ShiftSwapHandler) GetShiftSwapBoard(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+
+	var caller models.User
+	if err := h.db.First(&caller, userID).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve user")
+	}
+	swaps := []models.ShiftSwapRequest{}
+	if caller.DepartmentID == nil {
+		return c.JSON(http.StatusOK, map[string]interface{}{"data": swaps})
+	}
+
+	colleagues := h.db.Model(&models.User{}).Select("id").Where("department_id = ?", *caller.DepartmentID)
+	upcoming := h.db.Model(&models.Schedule{}).Select("id").Where("start_time > ?", time.Now())
+	if err := preloadShiftSwap(h.db).
+		Where("status = ? AND target_user_id IS NULL AND requester_id != ?", models.ShiftSwapOpen, userID).
+		Where("requester_id IN (?) AND schedule_id IN (?)", colleagues, upcoming).
+		Order("created_at ASC").Find(&swaps).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve shift swap requests")
+	}
+	if err := publishedSwapSchedules(h.db, swaps); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve schedules")
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": swaps,
+	})
+}
+
+// GetPendingShiftSwaps lists accepted requests waiting for the caller's
+// approval, with the live schedules that approval would reassign.
+func (h *ShiftSwapHandler) GetPendingShiftSwaps(c echo.Context) error {
+	userRole := c.Get("user_role").(string)
+	if userRole != "admin" && userRole != "manager" {
+		return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+	}
+	scope, err := scopeFor(c, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+
+	query := preloadShiftSwap(h.db).Preload("Schedule").Preload("CounterSchedule").
+		Where("status = ?", models.ShiftSwapAccepted)
+	query = scope.apply(scope.apply(query, "requester_id"), "accepter_id")
+	if userRole != "admin" {
+		userID := c.Get("user_id").(uint)
+		query = query.Where("requester_id != ? AND accepter_id != ?", userID, userID)
+	}
+	var swaps []models.ShiftSwapRequest
+	if err := query.Order("accepted_at ASC").Find(&swaps).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve shift swap requests")
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": swaps,
+	})
+}
+
+// CreateShiftSwap offers one of the caller's upcoming schedules. A swap
+// naming a colleague may also name the schedule wanted in return.
+func (h *ShiftSwapHandler) CreateShiftSwap(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+
+	var req CreateShiftSwapRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.Kind != models.ShiftSwapExchange && req.Kind != models.ShiftSwapCover {
+		return echo.NewHTTPError(http.StatusBadRequest, "kind must be swap or cover")
+	}
+	if req.TargetUserID != nil && *req.TargetUserID == userID {
+		return echo.NewHTTPError(http.StatusBadRequest, "Cannot offer a shift to yourself")
+	}
+	if req.CounterScheduleID != nil && (req.Kind != models.ShiftSwapExchange || req.TargetUserID == nil) {
+		return echo.NewHTTPError(http.StatusBadRequest, "counter_schedule_id requires a swap with target_user_id")
+	}
+
+	now := time.Now()
+	swap := models.ShiftSwapRequest{
+		Kind:              req.Kind,
+		Status:            models.ShiftSwapOpen,
+		RequesterID:       userID,
+		ScheduleID:        req.ScheduleID,
+		TargetUserID:      req.TargetUserID,
+		CounterScheduleID: req.CounterScheduleID,
+		RequiresApproval:  swapRequiresApproval(),
+		Reason:            req.Reason,
+	}
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockUser(tx, userID); err != nil {
+			return err
+		}
+		if _, err := loadSwapSchedule(tx, req.ScheduleID, userID, now); err != nil {
+			if errors.Is(err, errSwapStale) {
+				return echo.NewHTTPError(http.StatusNotFound, "Schedule not found")
+			}
+			return err
+		}
+		if req.TargetUserID != nil {
+			var target models.User
+			if err := tx.First(&target, *req.TargetUserID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return echo.NewHTTPError(http.StatusBadRequest, "Target user not found")
+				}
+				return err
+			}
+		}
+		if req.CounterScheduleID != nil {
+			if _, err := loadSwapSchedule(tx, *req.CounterScheduleID, *req.TargetUserID, now); err != nil {
+				if errors.Is(err, errSwapStale) {
+					return echo.NewHTTPError(http.StatusBadRequest, "counter_schedule_id must be an upcoming schedule of the target user")
+				}
+				return err
+			}
+		}
+		for _, id := range []*uint{&req.ScheduleID, req.CounterScheduleID} {
+			if id == nil {
+				continue
+			}
+			offered, err := scheduleOffered(tx, *id)
+			if err != nil {
+				return err
+			}
+			if offered {
+				return echo.NewHTTPError(http.StatusConflict, "Schedule is already part of an open request")
+			}
+		}
+		return tx.Create(&swap).Error
+	})
+	if err != nil {
+		return shiftSwapError(err, "Failed to create shift swap request")
+	}
+
+	if err := h.reloadShiftSwap(&swap); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve shift swap request")
+	}
+	return c.JSON(http.StatusCreated, swap)
+}
+
+// AcceptShiftSwap takes an open request. Without manager approval the
+// schedules are reassigned immediately.
+func (h *ShiftSwapHandler) AcceptShiftSwap(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+
+	swapID, err := strconv.ParseUint(c.Param("swapId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid shift swap ID")
+	}
+	var req AcceptShiftSwapRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	now := time.Now()
+	var swap models.ShiftSwapRequest
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&swap, swapID).Error; err != nil {
+			return err
+		}
+		if swap.RequesterID == userID || swap.TargetUserID != nil && *swap.TargetUserID != userID {
+			return gorm.ErrRecordNotFound
+		}
+		if swap.TargetUserID == nil {
+			// An open request is only on the requester's department board.
+			var users []models.User
+			if err := tx.Where("id IN ?", []uint{swap.RequesterID, userID}).Find(&users).Error; err != nil {
+				return err
+			}
+			if len(users) != 2 || users[0].DepartmentID == nil || users[1].DepartmentID == nil ||
+				*users[0].DepartmentID != *users[1].DepartmentID {
+				return gorm.ErrRecordNotFound
+			}
+		}
+		if swap.Status != models.ShiftSwapOpen {
+			return errSwapNotActionable
+		}
+
+		if swap.Kind == models.ShiftSwapExchange {
+			if swap.CounterScheduleID == nil {
+				if req.CounterScheduleID == nil {
+					return echo.NewHTTPError(http.StatusBadRequest, "counter_schedule_id is required to accept a swap")
+				}
+				offered, err := scheduleOffered(tx, *req.CounterScheduleID)
+				if err != nil {
+					return err
+				}
+				if offered {
+					return echo.NewHTTPError(http.StatusConflict, "Schedule is already part of an open request")
+				}
+				swap.CounterScheduleID = req.CounterScheduleID
+			}
+			if _, err := loadSwapSchedule(tx, *swap.CounterScheduleID, userID, now); err != nil {
+				if errors.Is(err, errSwapStale) {
+					return echo.NewHTTPError(http.StatusBadRequest, "counter_schedule_id must be one of your upcoming schedules")
+				}
+				return err
+			}
+		}
+
+		swap.AccepterID = &userID
+		swap.AcceptedAt = &now
+		if !swap.RequiresApproval {
+			return executeShiftSwap(tx, &swap, now)
+		}
+
+		// Validate now so the colleague hears about problems before a
+		// manager does; approval checks again.
+		offered, err := loadSwapSchedule(tx, swap.ScheduleID, swap.RequesterID, now)
+		if err != nil {
+			return err
+		}
+		var counterID uint
+		if swap.CounterScheduleID != nil {
+			counterID = *swap.CounterScheduleID
+		}
+		if err := checkShiftTransfer(tx, userID, offered, counterID); err != nil {
+			return err
+		}
+		if swap.CounterScheduleID != nil {
+			var counter models.Schedule
+			if err := tx.First(&counter, *swap.CounterScheduleID).Error; err != nil {
+				return err
+			}
+			if err := checkShiftTransfer(tx, swap.RequesterID, &counter, offered.ID); err != nil {
+				return err
+			}
+		}
+		swap.Status = models.ShiftSwapAccepted
+		return tx.Save(&swap).Error
+	})
+	if err != nil {
+		return shiftSwapError(err, "Failed to accept shift swap request")
+	}
+
+	if err := h.reloadShiftSwap(&swap); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve shift swap request")
+	}
+	return c.JSON(http.StatusOK, swap)
+}
+
+// DeclineShiftSwap lets the named colleague turn a request down.
+func (h *ShiftSwapHandler) DeclineShiftSwap(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+	return h.closeShiftSwap(c, models.ShiftSwapDeclined, func(swap *models.ShiftSwapRequest) bool {
+		return swap.TargetUserID != nil && *swap.TargetUserID == userID
+	}, models.ShiftSwapOpen)
+}
+
+// CancelShiftSwap withdraws the caller's own request before it completes.
+func (h *ShiftSwapHandler) CancelShiftSwap(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+	return h.closeShiftSwap(c, models.ShiftSwapCancelled, func(swap *models.ShiftSwapRequest) bool {
+		return swap.RequesterID == userID
+	}, models.ActiveShiftSwapStatuses...)
+}
+
+func (h *ShiftSwapHandler) closeShiftSwap(c echo.Context, status models.ShiftSwapStatus, allowed func(*models.ShiftSwapRequest) bool, from ...models.ShiftSwapStatus) error {
+	userID := c.Get("user_id").(uint)
+
+	swapID, err := strconv.ParseUint(c.Param("swapId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid shift swap ID")
+	}
+
+	now := time.Now()
+	var swap models.ShiftSwapRequest
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&swap, swapID).Error; err != nil {
+			return err
+		}
+		if !allowed(&swap) {
+			return gorm.ErrRecordNotFound
+		}
+		actionable := false
+		for _, s := range from {
+			if swap.Status == s {
+				actionable = true
+			}
+		}
+		if !actionable {
+			return errSwapNotActionable
+		}
+		swap.Status = status
+		swap.DecidedBy = &userID
+		swap.DecidedAt = &now
+		return tx.Save(&swap).Error
+	})
+	if err != nil {
+		return shiftSwapError(err, "Failed to update shift swap request")
+	}
+
+	return c.JSON(http.StatusOK, swap)
+}
+
+// UpdateShiftSwapStatus approves or rejects an accepted request. Approval
+// reassigns the schedules; the manager must have both employees in scope.
+func (h *ShiftSwapHandler) UpdateShiftSwapStatus(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+	userRole := c.Get("user_role").(string)
+	if userRole != "admin" && userRole != "manager" {
+		return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+	}
+
+	swapID, err := strconv.ParseUint(c.Param("swapId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid shift swap ID")
+	}
+	var req UpdateShiftSwapStatusRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.Status != models.ApprovalApproved && req.Status != models.ApprovalRejected {
+		return echo.NewHTTPError(http.StatusBadRequest, "status must be approved or rejected")
+	}
+
+	scope, err := scopeFor(c, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+
+	now := time.Now()
+	var swap models.ShiftSwapRequest
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&swap, swapID).Error; err != nil {
+			return err
+		}
+		if swap.AccepterID == nil || !scope.contains(swap.RequesterID) || !scope.contains(*swap.AccepterID) {
+			return gorm.ErrRecordNotFound
+		}
+		if userRole != "admin" && (swap.RequesterID == userID || *swap.AccepterID == userID) {
+			return echo.NewHTTPError(http.StatusForbidden, "Cannot decide a swap you are part of")
+		}
+		if swap.Status != models.ShiftSwapAccepted {
+			return errSwapNotActionable
+		}
+
+		swap.DecidedBy = &userID
+		swap.DecidedAt = &now
+		swap.DecisionNote = req.Note
+		if req.Status == models.ApprovalRejected {
+			swap.Status = models.ShiftSwapRejected
+			return tx.Save(&swap).Error
+		}
+		return executeShiftSwap(tx, &swap, now)
+	})
+	if err != nil {
+		return shiftSwapError(err, "Failed to update shift swap request")
+	}
+
+	preloadShiftSwap(h.db).Preload("Schedule").Preload("CounterSchedule").First(&swap, swap.ID)
+	return c.JSON(http.StatusOK, swap)
+}
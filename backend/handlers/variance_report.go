@@ -0,0 +1,365 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+)
+
+// maxVarianceDays bounds the range of one variance report.
+const maxVarianceDays = 93
+
+// How a day's punches compare with its schedule. A row can be late, leave
+// early and run over at once; on_time, absent, on_leave and
+// unscheduled_work stand alone.
+const (
+	varianceOnTime      = "on_time"
+	varianceLate        = "late"
+	varianceEarlyLeave  = "early_leave"
+	varianceOvertime    = "overtime"
+	varianceAbsent      = "absent"
+	varianceOnLeave     = "on_leave"
+	varianceUnscheduled = "unscheduled_work"
+)
+
+// lateGraceMinutes is how far past the planned start a clock-in, or before
+// the planned end a clock-out, still counts as on time.
+func lateGraceMinutes() int {
+	return envInt("LATE_GRACE_MINUTES", 0)
+}
+
+// VarianceRow compares one user's schedule with their attendance on one
+// day. Actual times are rounded by the user's work rule.
+type VarianceRow struct {
+	Date              string      `json:"date"`
+	User              models.User `json:"user"`
+	PlannedStart      *time.Time  `json:"planned_start"`
+	PlannedEnd        *time.Time  `json:"planned_end"`
+	ActualStart       *time.Time  `json:"actual_start"`
+	ActualEnd         *time.Time  `json:"actual_end"`
+	PlannedHours      string      `json:"planned_hours"`
+	ActualHours       string      `json:"actual_hours"`
+	VarianceHours     string      `json:"variance_hours"`
+	LateMinutes       int         `json:"late_minutes"`
+	EarlyLeaveMinutes int         `json:"early_leave_minutes"`
+	Classifications   []string    `json:"classifications"`
+}
+
+func (r *VarianceRow) is(classification string) bool {
+	for _, c := range r.Classifications {
+		if c == classification {
+			return true
+		}
+	}
+	return false
+}
+
+var varianceColumns = []string{
+	"date", "employee_code", "name", "planned_start", "planned_end", "actual_start", "actual_end",
+	"planned_hours", "actual_hours", "variance_hours", "late_minutes", "early_leave_minutes", "classification",
+}
+
+// reportRange reads month=YYYY-MM, or start_date and end_date, into the
+// first and last day of a report.
+func reportRange(c echo.Context, maxDays int) (time.Time, time.Time, error) {
+	if month := c.QueryParam("month"); month != "" {
+		return monthRange(month)
+	}
+	start, err := parseLocalDate(c.QueryParam("start_date"))
+	if err != nil {
+		return time.Time{}, time.Time{}, echo.NewHTTPError(http.StatusBadRequest, "month or start_date and end_date (YYYY-MM-DD) are required")
+	}
+	end, err := parseLocalDate(c.QueryParam("end_date"))
+	if err != nil {
+		return time.Time{}, time.Time{}, echo.NewHTTPError(http.StatusBadRequest, "month or start_date and end_date (YYYY-MM-DD) are required")
+	}
+	if end.Before(start) {
+		return time.Time{}, time.Time{}, echo.NewHTTPError(http.StatusBadRequest, "Start date must be before end date")
+	}
+	if end.Sub(start) >= time.Duration(maxDays)*24*time.Hour {
+		return time.Time{}, time.Time{}, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("The range may span at most %d days", maxDays))
+	}
+	return start, end, nil
+}
+
+// GetVarianceReport compares schedules with attendance per user and day.
+// Filters: user_id, department_id (with sub-departments) and
+// classification. format=csv downloads the rows.
+func (h *AdminHandler) GetVarianceReport(c echo.Context) error {
+	userRole := c.Get("user_role").(string)
+	if userRole != "admin" && userRole != "manager" {
+		return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+	}
+
+	start, end, err := reportRange(c, maxVarianceDays)
+	if err != nil {
+		return err
+	}
+	format := c.QueryParam("format")
+	if format != "" && format != "json" && format != "csv" {
+		return echo.NewHTTPError(http.StatusBadRequest, "format must be json or csv")
+	}
+	classification := c.QueryParam("classification")
+	switch classification {
+	case "", varianceOnTime, varianceLate, varianceEarlyLeave, varianceOvertime, varianceAbsent, varianceOnLeave, varianceUnscheduled:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "Unknown classification")
+	}
+
+	scope, err := scopeFor(c, h.db)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+	query := scope.apply(h.db, "id").Where("role != ?", "admin")
+	if requested := c.QueryParam("user_id"); requested != "" {
+		id, err := strconv.ParseUint(requested, 10, 32)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid user_id parameter")
+		}
+		if !scope.contains(uint(id)) {
+			return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+		}
+		query = query.Where("id = ?", id)
+	}
+	if departmentID := c.QueryParam("department_id"); departmentID != "" {
+		id, err := strconv.ParseUint(departmentID, 10, 32)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid department_id parameter")
+		}
+		departments, err := departmentSubtree(h.db, []uint{uint(id)})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve department")
+		}
+		query = query.Where("department_id IN ?", departments)
+	}
+	var users []models.User
+	if err := query.Order("id ASC").Find(&users).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve users")
+	}
+
+	rows, err := h.varianceRows(users, start, end)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to build variance report")
+	}
+	summary := map[string]int{}
+	filtered := rows[:0]
+	for _, row := range rows {
+		if classification != "" && !row.is(classification) {
+			continue
+		}
+		for _, name := range row.Classifications {
+			summary[name]++
+		}
+		filtered = append(filtered, row)
+	}
+	rows = filtered
+
+	if format == "csv" {
+		res := c.Response()
+		fileName := fmt.Sprintf("variance-%s-%s.csv", dateKey(start), dateKey(end))
+		res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, fileName))
+		res.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+		res.WriteHeader(http.StatusOK)
+		if _, err := io.WriteString(res, utf8BOM); err != nil {
+			return err
+		}
+		w := csv.NewWriter(res)
+		if err := w.Write(varianceColumns); err != nil {
+			return err
+		}
+		for i := range rows {
+			if err := w.Write(varianceCSVRow(&rows[i])); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"start_date": dateKey(start),
+		"end_date":   dateKey(end),
+		"summary":    summary,
+		"data":       rows,
+	})
+}
+
+// varianceRows builds a row for every user and day with a schedule or a
+// clock-in. Days still to come are left out, as is a schedule whose end has
+// not passed without a clock-in.
+func (h *AdminHandler) varianceRows(users []models.User, start, end time.Time) ([]VarianceRow, error) {
+	now := time.Now()
+	if today := truncateDate(now); end.After(today) {
+		end = today
+	}
+	rows := []VarianceRow{}
+	if len(users) == 0 || end.Before(start) {
+		return rows, nil
+	}
+
+	ids := make([]uint, 0, len(users))
+	byID := map[uint]models.User{}
+	for _, u := range users {
+		ids = append(ids, u.ID)
+		byID[u.ID] = u
+	}
+	next := end.AddDate(0, 0, 1)
+
+	var schedules []models.Schedule
+	if err := h.db.Where("user_id IN ? AND date >= ? AND date < ?", ids, start, next).Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	var attendances []models.Attendance
+	if err := h.db.Where("user_id IN ? AND date >= ? AND date < ? AND clock_in IS NOT NULL", ids, start, next).
+		Find(&attendances).Error; err != nil {
+		return nil, err
+	}
+	var leaves []models.Leave
+	if err := h.db.Where("user_id IN ? AND status IN ? AND start_date < ? AND end_date >= ?",
+		ids, models.EffectiveLeaveStatuses, next, start).Find(&leaves).Error; err != nil {
+		return nil, err
+	}
+
+	type userDay struct {
+		userID uint
+		day    string
+	}
+	scheduled := map[userDay]*models.Schedule{}
+	worked := map[userDay]*models.Attendance{}
+	var keys []userDay
+	for i := range schedules {
+		key := userDay{schedules[i].UserID, dateKey(schedules[i].Date.In(time.Local))}
+		if scheduled[key] == nil && worked[key] == nil {
+			keys = append(keys, key)
+		}
+		scheduled[key] = &schedules[i]
+	}
+	for i := range attendances {
+		key := userDay{attendances[i].UserID, dateKey(attendances[i].Date.In(time.Local))}
+		if scheduled[key] == nil && worked[key] == nil {
+			keys = append(keys, key)
+		}
+		worked[key] = &attendances[i]
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].day != keys[j].day {
+			return keys[i].day < keys[j].day
+		}
+		return keys[i].userID < keys[j].userID
+	})
+
+	rules := newWorkRules(h.db)
+	grace := time.Duration(lateGraceMinutes()) * time.Minute
+	for _, key := range keys {
+		schedule, attendance := scheduled[key], worked[key]
+		day, _ := parseLocalDate(key.day)
+		rule, err := rules.at(key.userID, day)
+		if err != nil {
+			return nil, err
+		}
+		row := VarianceRow{Date: key.day, User: byID[key.userID]}
+
+		// Leave explains an absence, and partial leave a late start or
+		// early finish.
+		wholeDayLeave, partialLeave := false, false
+		for i := range leaves {
+			if leaves[i].UserID != key.userID || leaves[i].CoveredHours(day, 1) == 0 {
+				continue
+			}
+			if leaves[i].IsPartialDay() {
+				partialLeave = true
+			} else {
+				wholeDayLeave = true
+			}
+		}
+
+		planned, actual := 0.0, 0.0
+		if schedule != nil {
+			row.PlannedStart, row.PlannedEnd = &schedule.StartTime, &schedule.EndTime
+			planned = schedule.PlannedHours(rule)
+		}
+		if attendance != nil {
+			clockIn := rule.RoundClockIn(*attendance.ClockIn)
+			row.ActualStart = &clockIn
+			if attendance.ClockOut != nil {
+				clockOut := rule.RoundClockOut(*attendance.ClockOut)
+				row.ActualEnd = &clockOut
+			}
+			actual = attendance.WorkingHours(rule)
+		}
+
+		switch {
+		case schedule == nil:
+			row.Classifications = []string{varianceUnscheduled}
+		case attendance == nil && wholeDayLeave:
+			row.Classifications = []string{varianceOnLeave}
+		case attendance == nil:
+			if !now.After(schedule.EndTime) {
+				continue
+			}
+			row.Classifications = []string{varianceAbsent}
+		default:
+			if !schedule.IsFlexTime && !partialLeave {
+				if late := row.ActualStart.Sub(schedule.StartTime); late > grace {
+					row.LateMinutes = int(late.Minutes())
+					row.Classifications = append(row.Classifications, varianceLate)
+				}
+				if row.ActualEnd != nil {
+					if early := schedule.EndTime.Sub(*row.ActualEnd); early > grace {
+						row.EarlyLeaveMinutes = int(early.Minutes())
+						row.Classifications = append(row.Classifications, varianceEarlyLeave)
+					}
+				}
+			}
+			if row.ActualEnd != nil && actual-planned > grace.Hours() {
+				row.Classifications = append(row.Classifications, varianceOvertime)
+			}
+			if len(row.Classifications) == 0 {
+				row.Classifications = []string{varianceOnTime}
+			}
+		}
+
+		row.PlannedHours = fmt.Sprintf("%.2f", planned)
+		row.ActualHours = fmt.Sprintf("%.2f", actual)
+		row.VarianceHours = fmt.Sprintf("%.2f", actual-planned)
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// varianceCSVRow formats a row in varianceColumns order.
+func varianceCSVRow(r *VarianceRow) []string {
+	clock := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.In(time.Local).Format("15:04")
+	}
+	code := r.User.Email
+	if r.User.EmployeeCode != nil {
+		code = *r.User.EmployeeCode
+	}
+	return []string{
+		r.Date,
+		code,
+		r.User.Name,
+		clock(r.PlannedStart),
+		clock(r.PlannedEnd),
+		clock(r.ActualStart),
+		clock(r.ActualEnd),
+		r.PlannedHours,
+		r.ActualHours,
+		r.VarianceHours,
+		strconv.Itoa(r.LateMinutes),
+		strconv.Itoa(r.EarlyLeaveMinutes),
+		strings.Join(r.Classifications, ";"),
+	}
+}
@@ -0,0 +1,426 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// builtinWorkRule applies when no work rule is configured: an eight-hour
+// day and forty-hour week, the statutory breaks, and no rounding.
+var builtinWorkRule = models.WorkRule{
+	Name:                  "builtin",
+	StandardDailyMinutes:  480,
+	BreakRules:            []models.BreakRule{{AfterMinutes: 360, BreakMinutes: 45}, {AfterMinutes: 480, BreakMinutes: 60}},
+	DailyOvertimeMinutes:  480,
+	WeeklyOvertimeMinutes: 2400,
+	ClockInRounding:       models.RoundingNone,
+	ClockOutRounding:      models.RoundingNone,
+}
+
+// workRulePeriod is a work rule in effect from a date.
+type workRulePeriod struct {
+	from time.Time
+	rule *models.WorkRule
+}
+
+// workRules resolves the work rule in effect for a user on a day, loading
+// each user's assignments once.
+type workRules struct {
+	db       *gorm.DB
+	fallback *models.WorkRule
+	periods  map[uint][]workRulePeriod
+}
+
+func newWorkRules(db *gorm.DB) *workRules {
+	return &workRules{db: db, periods: map[uint][]workRulePeriod{}}
+}
+
+// defaultRule is the rule flagged as default, or the built-in one.
+func (w *workRules) defaultRule() (*models.WorkRule, error) {
+	if w.fallback == nil {
+		var rules []models.WorkRule
+		if err := w.db.Where("is_default = ?", true).Order("id ASC").Limit(1).Find(&rules).Error; err != nil {
+			return nil, err
+		}
+		if len(rules) == 1 {
+			w.fallback = &rules[0]
+		} else {
+			rule := builtinWorkRule
+			w.fallback = &rule
+		}
+	}
+	return w.fallback, nil
+}
+
+// forUser lists userID's rule periods, newest first. The last period starts
+// at the zero time and holds the default rule.
+func (w *workRules) forUser(userID uint) ([]workRulePeriod, error) {
+	if periods, ok := w.periods[userID]; ok {
+		return periods, nil
+	}
+	var assignments []models.WorkRuleAssignment
+	if err := w.db.Preload("WorkRule").Where("user_id = ?", userID).
+		Order("effective_from DESC").Find(&assignments).Error; err != nil {
+		return nil, err
+	}
+
+	var periods []workRulePeriod
+	for i := range assignments {
+		// A deleted rule does not preload; the user falls through to
+		// the assignment before it.
+		if assignments[i].WorkRule.ID == 0 {
+			continue
+		}
+		periods = append(periods, workRulePeriod{from: assignments[i].EffectiveFrom, rule: &assignments[i].WorkRule})
+	}
+	fallback, err := w.defaultRule()
+	if err != nil {
+		return nil, err
+	}
+	periods = append(periods, workRulePeriod{rule: fallback})
+	w.periods[userID] = periods
+	return periods, nil
+}
+
+// at returns the rule in effect for userID on day.
+func (w *workRules) at(userID uint, day time.Time) (*models.WorkRule, error) {
+	day = truncateDate(day)
+	periods, err := w.forUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range periods {
+		if !p.from.After(day) {
+			return p.rule, nil
+		}
+	}
+	return w.defaultRule()
+}
+
+type WorkRuleHandler struct {
+	db *gorm.DB
+}
+
+func NewWorkRuleHandler(db *gorm.DB) *WorkRuleHandler {
+	return &WorkRuleHandler{db: db}
+}
+
+type WorkRuleRequest struct {
+	Name                  string              `json:"name" validate:"required"`
+	StandardDailyMinutes  int                 `json:"standard_daily_minutes" validate:"required"`
+	BreakRules            []models.BreakRule  `json:"break_rules"`
+	DailyOvertimeMinutes  int                 `json:"daily_overtime_minutes" validate:"required"`
+	WeeklyOvertimeMinutes int                 `json:"weekly_overtime_minutes" validate:"required"`
+	RoundingMinutes       int                 `json:"rounding_minutes"`
+	ClockInRounding       models.RoundingMode `json:"clock_in_rounding"`  // none, up, down or nearest; default none
+	ClockOutRounding      models.RoundingMode `json:"clock_out_rounding"` // none, up, down or nearest; default none
+	CalendarID            *uint               `json:"calendar_id"`
+	IsDefault             bool                `json:"is_default"`
+}
+
+type WorkRuleAssignmentRequest struct {
+	WorkRuleID    uint   `json:"work_rule_id" validate:"required"`
+	EffectiveFrom string `json:"effective_from" validate:"required"` // YYYY-MM-DD
+}
+
+func (h *WorkRuleHandler) GetWorkRules(c echo.Context) error {
+	var rules []models.WorkRule
+	if err := h.db.Preload("Calendar").Order("id ASC").Find(&rules).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve work rules")
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": rules,
+	})
+}
+
+// GetMyWorkRule returns the rule in effect for the caller on date (default:
+// today).
+func (h *WorkRuleHandler) GetMyWorkRule(c echo.Context) error {
+	userID := c.Get("user_id").(uint)
+
+	day := truncateDate(time.Now())
+	if date := c.QueryParam("date"); date != "" {
+		parsed, err := parseLocalDate(date)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid date format. Expected YYYY-MM-DD")
+		}
+		day = parsed
+	}
+	rule, err := newWorkRules(h.db).at(userID, day)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve work rule")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"date":      dateKey(day),
+		"work_rule": rule,
+	})
+}
+
+func (h *WorkRuleHandler) CreateWorkRule(c echo.Context) error {
+	var req WorkRuleRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	var rule models.WorkRule
+	if err := h.applyWorkRule(&rule, &req); err != nil {
+		return err
+	}
+	if err := h.saveWorkRule(&rule); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create work rule")
+	}
+
+	return c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateWorkRule edits a rule nobody has been assigned yet. Changing an
+// assigned rule in place would rewrite past figures, so a change of rules
+// is made as a new rule assigned from its start date.
+func (h *WorkRuleHandler) UpdateWorkRule(c echo.Context) error {
+	ruleID, err := strconv.ParseUint(c.Param("ruleId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid work rule ID")
+	}
+	var req WorkRuleRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	var rule models.WorkRule
+	if err := h.db.First(&rule, ruleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Work rule not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve work rule")
+	}
+	var count int64
+	if err := h.db.Model(&models.WorkRuleAssignment{}).Where("work_rule_id = ?", rule.ID).Count(&count).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve work rule assignments")
+	}
+	if count > 0 {
+		return echo.NewHTTPError(http.StatusConflict, "Work rule is assigned to users; create a new rule and assign it from its start date")
+	}
+	if err := h.applyWorkRule(&rule, &req); err != nil {
+		return err
+	}
+	if err := h.saveWorkRule(&rule); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update work rule")
+	}
+
+	return c.JSON(http.StatusOK, rule)
+}
+
+func (h *WorkRuleHandler) applyWorkRule(rule *models.WorkRule, req *WorkRuleRequest) error {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Name is required")
+	}
+	var count int64
+	h.db.Model(&models.WorkRule{}).Where("name = ? AND id != ?", name, rule.ID).Count(&count)
+	if count > 0 {
+		return echo.NewHTTPError(http.StatusConflict, "A work rule with this name already exists")
+	}
+
+	if req.StandardDailyMinutes <= 0 || req.StandardDailyMinutes > 24*60 {
+		return echo.NewHTTPError(http.StatusBadRequest, "standard_daily_minutes must be between 1 and 1440")
+	}
+	if req.DailyOvertimeMinutes <= 0 || req.WeeklyOvertimeMinutes <= 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Overtime thresholds must be positive")
+	}
+	for _, b := range req.BreakRules {
+		if b.AfterMinutes < 0 || b.BreakMinutes <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Break rules need a non-negative after_minutes and a positive break_minutes")
+		}
+	}
+	if req.RoundingMinutes < 0 || req.RoundingMinutes > 60 {
+		return echo.NewHTTPError(http.StatusBadRequest, "rounding_minutes must be between 0 and 60")
+	}
+	for _, mode := range []*models.RoundingMode{&req.ClockInRounding, &req.ClockOutRounding} {
+		switch *mode {
+		case "":
+			*mode = models.RoundingNone
+		case models.RoundingNone, models.RoundingUp, models.RoundingDown, models.RoundingNearest:
+		default:
+			return echo.NewHTTPError(http.StatusBadRequest, "Rounding must be none, up, down or nearest")
+		}
+	}
+	if req.CalendarID != nil {
+		h.db.Model(&models.CompanyCalendar{}).Where("id = ?", *req.CalendarID).Count(&count)
+		if count == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Calendar not found")
+		}
+	}
+
+	rule.Name = name
+	rule.StandardDailyMinutes = req.StandardDailyMinutes
+	rule.BreakRules = req.BreakRules
+	rule.DailyOvertimeMinutes = req.DailyOvertimeMinutes
+	rule.WeeklyOvertimeMinutes = req.WeeklyOvertimeMinutes
+	rule.RoundingMinutes = req.RoundingMinutes
+	rule.ClockInRounding = req.ClockInRounding
+	rule.ClockOutRounding = req.ClockOutRounding
+	rule.CalendarID = req.CalendarID
+	rule.IsDefault = req.IsDefault
+	return nil
+}
+
+// saveWorkRule stores rule, making it the only default when flagged.
+func (h *WorkRuleHandler) saveWorkRule(rule *models.WorkRule) error {
+	return h.db.Transaction(func(tx *gorm.DB) error {
+		if rule.IsDefault {
+			if err := tx.Model(&models.WorkRule{}).Where("is_default = ? AND id != ?", true, rule.ID).
+				Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Omit("Calendar").Save(rule).Error
+	})
+}
+
+// DeleteWorkRule removes a rule nobody has ever been assigned. Rules with
+// history must stay so that past months keep their figures.
+func (h *WorkRuleHandler) DeleteWorkRule(c echo.Context) error {
+	ruleID, err := strconv.ParseUint(c.Param("ruleId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid work rule ID")
+	}
+
+	var count int64
+	h.db.Model(&models.WorkRuleAssignment{}).Where("work_rule_id = ?", ruleID).Count(&count)
+	if count > 0 {
+		return echo.NewHTTPError(http.StatusConflict, "Work rule is assigned to users")
+	}
+
+	result := h.db.Delete(&models.WorkRule{}, ruleID)
+	if result.Error != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete work rule")
+	}
+	if result.RowsAffected == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "Work rule not found")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetUserWorkRules lists a user's assignments, newest first, with the rule
+// in effect today.
+func (h *WorkRuleHandler) GetUserWorkRules(c echo.Context) error {
+	userID, err := h.scopedUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var assignments []models.WorkRuleAssignment
+	if err := h.db.Preload("WorkRule").Where("user_id = ?", userID).
+		Order("effective_from DESC").Find(&assignments).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve work rule assignments")
+	}
+	current, err := newWorkRules(h.db).at(userID, time.Now())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve work rule")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":    assignments,
+		"current": current,
+	})
+}
+
+// AssignWorkRule puts a user on a rule from effective_from. An assignment
+// on the same date is replaced.
+func (h *WorkRuleHandler) AssignWorkRule(c echo.Context) error {
+	actorID := c.Get("user_id").(uint)
+
+	userID, err := h.scopedUserID(c)
+	if err != nil {
+		return err
+	}
+	var req WorkRuleAssignmentRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	from, err := parseLocalDate(req.EffectiveFrom)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid effective_from format. Expected YYYY-MM-DD")
+	}
+	if err := requireOpenPeriod(h.db, from, from); err != nil {
+		return err
+	}
+
+	var rule models.WorkRule
+	if err := h.db.First(&rule, req.WorkRuleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Work rule not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve work rule")
+	}
+
+	assignment := models.WorkRuleAssignment{
+		UserID:        userID,
+		WorkRuleID:    rule.ID,
+		EffectiveFrom: from,
+		CreatedBy:     actorID,
+	}
+	if err := h.db.Omit("WorkRule").Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "effective_from"}},
+		DoUpdates: clause.AssignmentColumns([]string{"work_rule_id", "created_by", "updated_at"}),
+	}).Create(&assignment).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to assign work rule")
+	}
+
+	h.db.Preload("WorkRule").Where("user_id = ? AND effective_from = ?", userID, from).First(&assignment)
+	return c.JSON(http.StatusOK, assignment)
+}
+
+func (h *WorkRuleHandler) DeleteWorkRuleAssignment(c echo.Context) error {
+	userID, err := h.scopedUserID(c)
+	if err != nil {
+		return err
+	}
+	assignmentID, err := strconv.ParseUint(c.Param("assignmentId"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid assignment ID")
+	}
+
+	var assignment models.WorkRuleAssignment
+	if err := h.db.Where("id = ? AND user_id = ?", assignmentID, userID).First(&assignment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Work rule assignment not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve work rule assignment")
+	}
+	if err := requireOpenPeriod(h.db, assignment.EffectiveFrom, assignment.EffectiveFrom); err != nil {
+		return err
+	}
+
+	if err := h.db.Delete(&assignment).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete work rule assignment")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// scopedUserID parses :userId and checks it is in the caller's scope.
+func (h *WorkRuleHandler) scopedUserID(c echo.Context) (uint, error) {
+	id, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+	scope, err := scopeFor(c, h.db)
+	if err != nil {
+		return 0, echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve access scope")
+	}
+	if !scope.contains(uint(id)) {
+		return 0, echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+	}
+	return uint(id), nil
+}
@@ -0,0 +1,137 @@
+// Package ical writes RFC 5545 iCalendar documents.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	utcLayout  = "20060102T150405Z"
+	dateLayout = "20060102"
+	// maxLineOctets is the longest content line allowed before folding.
+	maxLineOctets = 75
+)
+
+// Event is a VEVENT. All-day events use only the date part of Start and
+// End, and End is exclusive.
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Start       time.Time
+	End         time.Time
+	AllDay      bool
+	Stamp       time.Time
+	Status      string // CONFIRMED or TENTATIVE; empty omits it
+}
+
+type Calendar struct {
+	ProdID string
+	Name   string
+	Events []Event
+}
+
+// WriteTo serializes the calendar with CRLF line endings and folded lines.
+func (c *Calendar) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	line := func(name, value string) {
+		cw.writeLine(name + ":" + value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", escapeText(c.ProdID))
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		line("X-WR-CALNAME", escapeText(c.Name))
+	}
+	for _, e := range c.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", escapeText(e.UID))
+		line("DTSTAMP", e.Stamp.UTC().Format(utcLayout))
+		if e.AllDay {
+			cw.writeLine("DTSTART;VALUE=DATE:" + e.Start.Format(dateLayout))
+			cw.writeLine("DTEND;VALUE=DATE:" + e.End.Format(dateLayout))
+		} else {
+			line("DTSTART", e.Start.UTC().Format(utcLayout))
+			line("DTEND", e.End.UTC().Format(utcLayout))
+		}
+		line("SUMMARY", escapeText(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION", escapeText(e.Description))
+		}
+		if e.Status != "" {
+			line("STATUS", e.Status)
+		}
+		line("TRANSP", "OPAQUE")
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+// escapeText escapes a TEXT value (RFC 5545 section 3.3.11).
+func escapeText(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ReplaceAll(s, "\r\n", "\n") {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case ';':
+			b.WriteString(`\;`)
+		case ',':
+			b.WriteString(`\,`)
+		case '\n', '\r':
+			b.WriteString(`\n`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// fold splits a content line into chunks of at most 75 octets without
+// breaking a UTF-8 sequence; continuation lines start with a space.
+func fold(s string) []string {
+	var lines []string
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		lines = append(lines, s[:cut])
+		s = s[cut:]
+		limit = maxLineOctets - 1 // room for the leading space
+	}
+	return append(lines, s)
+}
+
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) writeLine(s string) {
+	for i, part := range fold(s) {
+		if cw.err != nil {
+			return
+		}
+		if i > 0 {
+			part = " " + part
+		}
+		n, err := cw.w.WriteString(part + "\r\n")
+		cw.n += int64(n)
+		cw.err = err
+	}
+}
@@ -3,12 +3,15 @@ package main
 import (
     "log"
     "os"
+    "time"
 
     "github.com/joho/godotenv"
     "github.com/labstack/echo/v4"
     echomw "github.com/labstack/echo/v4/middleware"
+    "github.com/yudai-uk/backend/handlers"
     "github.com/yudai-uk/backend/models"
     "github.com/yudai-uk/backend/routes"
+    "github.com/yudai-uk/backend/storage"
     "gorm.io/driver/postgres"
     "gorm.io/gorm"
 )
@@ -37,10 +40,59 @@ func main() {
 		&models.Attendance{},
 		&models.Leave{},
 		&models.Schedule{},
+		&models.LeaveBalanceTransaction{},
+		&models.LeaveDesignation{},
+		&models.ApprovalRoute{},
+		&models.ApprovalRouteStep{},
+		&models.ApprovalStep{},
+		&models.Department{},
+		&models.ApprovalDelegation{},
+		&models.Holiday{},
+		&models.LeaveTypeDefinition{},
+		&models.Attachment{},
+		&models.CalendarFeedToken{},
+		&models.HolidayWork{},
+		&models.ShiftTemplate{},
+		&models.RotationPattern{},
+		&models.RotationSlot{},
+		&models.RotationAssignment{},
+		&models.ShiftSwapRequest{},
+		&models.StaffingRequirement{},
+		&models.Availability{},
+		&models.AvailabilityPeriod{},
+		&models.AvailabilitySubmission{},
+		&models.ScheduleDraft{},
+		&models.ScheduleDraftShift{},
+		&models.ScheduleDraftIssue{},
+		&models.SchedulePublication{},
+		&models.PublishedSchedule{},
+		&models.ScheduleChange{},
+		&models.Notification{},
+		&models.CompanyCalendar{},
+		&models.CompanyCalendarDay{},
+		&models.Location{},
+		&models.WorkRule{},
+		&models.WorkRuleAssignment{},
+		&models.MonthlyConfirmation{},
+		&models.ClosingPeriod{},
+		&models.ClosingEvent{},
 	); err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
 
+	if err := models.SeedLeaveTypes(db); err != nil {
+		log.Fatalf("Failed to seed leave types: %v", err)
+	}
+
+	store, err := storage.NewFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure file storage: %v", err)
+	}
+	scanner, err := storage.NewScannerFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure malware scanner: %v", err)
+	}
+
 	e := echo.New()
 
     e.Use(echomw.Logger())
@@ -51,7 +103,9 @@ func main() {
         AllowHeaders: []string{"Content-Type", "Authorization"},
     }))
 
-	routes.SetupRoutes(e, db)
+	routes.SetupRoutes(e, db, store, scanner)
+	handlers.StartApprovalEscalation(db, 15*time.Minute)
+	handlers.StartCompensatoryExpiry(db, time.Hour)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -87,3 +87,14 @@ func AdminMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
         return next(c)
     }
 }
+
+// AdminOnlyMiddleware restricts a route to admins; managers are rejected.
+func AdminOnlyMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+    return func(c echo.Context) error {
+        role, _ := c.Get("user_role").(string)
+        if role != "admin" {
+            return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+        }
+        return next(c)
+    }
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yudai-uk/backend/models"
+	"gorm.io/gorm"
+)
+
+// OpenPeriodMiddleware rejects attendance writes once today's month has
+// been closed for payroll. Every attendance action only touches today's
+// record, so today's month is the one that matters.
+func OpenPeriodMiddleware(db *gorm.DB) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			now := time.Now()
+			closed, err := models.ClosedMonths(db, now, now)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, "Failed to check the closing period")
+			}
+			if len(closed) > 0 {
+				return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("The period %s is closed", closed[0]))
+			}
+			return next(c)
+		}
+	}
+}
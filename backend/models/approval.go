@@ -0,0 +1,101 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const ApprovalRequestLeave = "leave"
+
+type ApproverKind string
+
+const (
+	ApproverLineManager    ApproverKind = "line_manager"
+	ApproverDepartmentHead ApproverKind = "department_head"
+	ApproverRole           ApproverKind = "role"
+	ApproverUser           ApproverKind = "user"
+)
+
+type ApprovalDecision string
+
+const (
+	ApprovalPending  ApprovalDecision = "pending"
+	ApprovalApproved ApprovalDecision = "approved"
+	ApprovalRejected ApprovalDecision = "rejected"
+)
+
+// ApprovalRoute is an ordered chain of approvers for one request type. The
+// first active route (by Priority) whose conditions match a request is used.
+type ApprovalRoute struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	Name        string         `json:"name" gorm:"not null"`
+	RequestType string         `json:"request_type" gorm:"not null;index"`
+	Priority    int            `json:"priority" gorm:"default:100"` // lower wins
+	MinDays     *float64       `json:"min_days"`                    // applies when days >= MinDays
+	MaxDays     *float64       `json:"max_days"`                    // applies when days <= MaxDays
+	LeaveTypes  string         `json:"leave_types"`                 // comma-separated; empty matches any
+	Active      bool           `json:"active" gorm:"not null"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+
+	Steps []ApprovalRouteStep `json:"steps" gorm:"foreignKey:RouteID"`
+}
+
+// ApprovalRouteStep defines who approves at one position in a route.
+type ApprovalRouteStep struct {
+	ID             uint         `json:"id" gorm:"primaryKey"`
+	RouteID        uint         `json:"route_id" gorm:"not null;index"`
+	StepOrder      int          `json:"step_order" gorm:"not null"`
+	Name           string       `json:"name"`
+	ApproverKind   ApproverKind `json:"approver_kind" gorm:"not null"`
+	ApproverRole   string       `json:"approver_role"`    // role kind only
+	ApproverUserID *uint        `json:"approver_user_id"` // user kind only
+}
+
+// ApprovalStep is one step of the chain instantiated for a specific request,
+// holding that step's decision.
+type ApprovalStep struct {
+	ID             uint             `json:"id" gorm:"primaryKey"`
+	RequestType    string           `json:"request_type" gorm:"not null;index:idx_approval_step_request"`
+	RequestID      uint             `json:"request_id" gorm:"not null;index:idx_approval_step_request"`
+	StepOrder      int              `json:"step_order" gorm:"not null"`
+	Name           string           `json:"name"`
+	ApproverKind   ApproverKind     `json:"approver_kind" gorm:"not null"`
+	ApproverRole   string           `json:"approver_role"`
+	ApproverUserID *uint            `json:"approver_user_id"`
+	Decision       ApprovalDecision `json:"decision" gorm:"default:pending"`
+	ActivatedAt    *time.Time       `json:"activated_at"` // when the step became current
+	EscalatedAt    *time.Time       `json:"escalated_at"`
+	EscalatedFrom  *uint            `json:"escalated_from"`
+	DecidedBy      *uint            `json:"decided_by"`
+	OnBehalfOf     *uint            `json:"on_behalf_of"` // set when a delegate decided
+	Comment        string           `json:"comment"`
+	DecidedAt      *time.Time       `json:"decided_at"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+
+	Decider   *User `json:"decider,omitempty" gorm:"foreignKey:DecidedBy"`
+	Principal *User `json:"principal,omitempty" gorm:"foreignKey:OnBehalfOf"`
+}
+
+// Matches reports whether the route's conditions accept a leave request.
+func (r *ApprovalRoute) Matches(leave *Leave) bool {
+	if r.MinDays != nil && leave.Days < *r.MinDays {
+		return false
+	}
+	if r.MaxDays != nil && leave.Days > *r.MaxDays {
+		return false
+	}
+	if strings.TrimSpace(r.LeaveTypes) == "" {
+		return true
+	}
+	for _, t := range strings.Split(r.LeaveTypes, ",") {
+		if LeaveType(strings.TrimSpace(t)) == leave.Type {
+			return true
+		}
+	}
+	return false
+}
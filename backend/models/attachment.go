@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AttachmentOwnerType names the kind of record a document is attached to.
+type AttachmentOwnerType string
+
+const (
+	AttachmentOwnerLeave AttachmentOwnerType = "leave"
+)
+
+type AttachmentScanStatus string
+
+const (
+	AttachmentScanClean   AttachmentScanStatus = "clean"
+	AttachmentScanSkipped AttachmentScanStatus = "skipped"
+)
+
+// Attachment is a supporting document (medical certificate, etc.). The file
+// itself lives in object storage under StorageKey.
+type Attachment struct {
+	ID          uint                 `json:"id" gorm:"primaryKey"`
+	OwnerType   AttachmentOwnerType  `json:"owner_type" gorm:"not null;size:32;index:idx_attachment_owner"`
+	OwnerID     uint                 `json:"owner_id" gorm:"not null;index:idx_attachment_owner"`
+	FileName    string               `json:"file_name" gorm:"not null"`
+	ContentType string               `json:"content_type" gorm:"not null"`
+	Size        int64                `json:"size" gorm:"not null"`
+	Checksum    string               `json:"checksum" gorm:"not null;size:64"` // SHA-256, hex
+	StorageKey  string               `json:"-" gorm:"not null;uniqueIndex"`
+	ScanStatus  AttachmentScanStatus `json:"scan_status" gorm:"not null;size:16"`
+	UploadedBy  uint                 `json:"uploaded_by" gorm:"not null"`
+	CreatedAt   time.Time            `json:"created_at"`
+	DeletedAt   gorm.DeletedAt       `json:"-" gorm:"index"`
+
+	Uploader User `json:"uploader,omitempty" gorm:"foreignKey:UploadedBy"`
+}
@@ -26,12 +26,21 @@ type Attendance struct {
 	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
 }
 
-func (a *Attendance) WorkingHours() float64 {
+// WorkingHours is the time worked under rule: clock times rounded as the
+// rule says, less the break taken or the rule's minimum break, whichever is
+// longer. A nil rule takes the record as it is.
+func (a *Attendance) WorkingHours(rule *WorkRule) float64 {
 	if a.ClockIn == nil || a.ClockOut == nil {
 		return 0
 	}
-	duration := a.ClockOut.Sub(*a.ClockIn)
-	hours := duration.Hours() - float64(a.BreakTime)/60.0
+	clockIn, clockOut := *a.ClockIn, *a.ClockOut
+	breakTime := a.BreakTime
+	if rule != nil {
+		clockIn, clockOut = rule.RoundClockIn(clockIn), rule.RoundClockOut(clockOut)
+		breakTime = rule.BreakFor(clockOut.Sub(clockIn), breakTime)
+	}
+	duration := clockOut.Sub(clockIn)
+	hours := duration.Hours() - float64(breakTime)/60.0
 	if hours < 0 {
 		return 0
 	}
@@ -0,0 +1,145 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StaffingRequirement is how many people a department needs on a shift
+// template. Weekday rules repeat every week (nil Weekday means every day); a
+// dated rule replaces the weekly rules for that template on its date.
+type StaffingRequirement struct {
+	ID              uint           `json:"id" gorm:"primaryKey"`
+	DepartmentID    uint           `json:"department_id" gorm:"not null;index"`
+	ShiftTemplateID uint           `json:"shift_template_id" gorm:"not null"`
+	Weekday         *int           `json:"weekday"` // 0 = Sunday
+	Date            *time.Time     `json:"date"`
+	Required        int            `json:"required" gorm:"not null"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
+
+	ShiftTemplate ShiftTemplate `json:"shift_template" gorm:"foreignKey:ShiftTemplateID"`
+}
+
+// Applies reports whether the weekly rule covers day. Dated rules are
+// matched by the caller.
+func (r *StaffingRequirement) Applies(day time.Time) bool {
+	return r.Date == nil && (r.Weekday == nil || *r.Weekday == int(day.Weekday()))
+}
+
+type AvailabilityKind string
+
+const (
+	AvailabilityAvailable   AvailabilityKind = "available"
+	AvailabilityUnavailable AvailabilityKind = "unavailable"
+	AvailabilityPreferred   AvailabilityKind = "preferred"
+)
+
+// Availability is an employee's wish for one day (希望シフト), used by the
+// scheduler. StartTime and EndTime narrow it to a window, HH:MM; empty
+// means the whole day. An available or preferred window limits shifts to
+// the window; an unavailable one rules out shifts that overlap it.
+type Availability struct {
+	ID        uint             `json:"id" gorm:"primaryKey"`
+	UserID    uint             `json:"user_id" gorm:"not null;uniqueIndex:idx_availability_user_date"`
+	Date      time.Time        `json:"date" gorm:"not null;uniqueIndex:idx_availability_user_date"`
+	Kind      AvailabilityKind `json:"kind" gorm:"size:16;not null"`
+	StartTime string           `json:"start_time" gorm:"size:5"`
+	EndTime   string           `json:"end_time" gorm:"size:5"`
+	Note      string           `json:"note"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// AvailabilityPeriod asks employees for their availability over a date
+// range by a deadline. Entries in the range are locked once it passes.
+// DepartmentID limits the period to a department and those below it; nil
+// means everyone.
+type AvailabilityPeriod struct {
+	ID           uint           `json:"id" gorm:"primaryKey"`
+	DepartmentID *uint          `json:"department_id" gorm:"index"`
+	StartDate    time.Time      `json:"start_date" gorm:"not null"`
+	EndDate      time.Time      `json:"end_date" gorm:"not null"`
+	Deadline     time.Time      `json:"deadline" gorm:"not null"`
+	Note         string         `json:"note"`
+	CreatedBy    uint           `json:"created_by" gorm:"not null"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+
+	Department *Department `json:"department,omitempty" gorm:"foreignKey:DepartmentID"`
+}
+
+// Covers reports whether day falls inside the period.
+func (p *AvailabilityPeriod) Covers(day time.Time) bool {
+	return !day.Before(p.StartDate) && !day.After(p.EndDate)
+}
+
+// AvailabilitySubmission records that a user handed in their availability
+// for a period.
+type AvailabilitySubmission struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	PeriodID    uint      `json:"period_id" gorm:"not null;uniqueIndex:idx_availability_submission"`
+	UserID      uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_availability_submission"`
+	SubmittedAt time.Time `json:"submitted_at" gorm:"not null"`
+}
+
+type ScheduleDraftStatus string
+
+const (
+	ScheduleDraftOpen      ScheduleDraftStatus = "draft"
+	ScheduleDraftAccepted  ScheduleDraftStatus = "accepted"
+	ScheduleDraftDiscarded ScheduleDraftStatus = "discarded"
+)
+
+// ScheduleDraft is one auto-scheduler run for a department. Its shifts only
+// become schedules when a manager accepts it.
+type ScheduleDraft struct {
+	ID           uint                `json:"id" gorm:"primaryKey"`
+	DepartmentID uint                `json:"department_id" gorm:"not null;index"`
+	StartDate    time.Time           `json:"start_date" gorm:"not null"`
+	EndDate      time.Time           `json:"end_date" gorm:"not null"`
+	Status       ScheduleDraftStatus `json:"status" gorm:"size:16;not null;index"`
+	Required     int                 `json:"required"` // positions asked for
+	Filled       int                 `json:"filled"`   // positions covered, including existing schedules
+	CreatedBy    uint                `json:"created_by" gorm:"not null"`
+	AcceptedBy   *uint               `json:"accepted_by"`
+	AcceptedAt   *time.Time          `json:"accepted_at"`
+	CreatedAt    time.Time           `json:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at"`
+
+	Department Department           `json:"department" gorm:"foreignKey:DepartmentID"`
+	Shifts     []ScheduleDraftShift `json:"shifts,omitempty" gorm:"foreignKey:DraftID"`
+	Issues     []ScheduleDraftIssue `json:"issues,omitempty" gorm:"foreignKey:DraftID"`
+}
+
+// ScheduleDraftShift is a proposed schedule.
+type ScheduleDraftShift struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	DraftID         uint      `json:"draft_id" gorm:"not null;index"`
+	UserID          uint      `json:"user_id" gorm:"not null"`
+	Date            time.Time `json:"date" gorm:"not null"`
+	StartTime       time.Time `json:"start_time" gorm:"not null"`
+	EndTime         time.Time `json:"end_time" gorm:"not null"`
+	BreakTime       int       `json:"break_time"`
+	IsFlexTime      bool      `json:"is_flex_time"`
+	Note            string    `json:"note"`
+	ShiftTemplateID uint      `json:"shift_template_id"`
+
+	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+// ScheduleDraftIssue explains a slot the scheduler could not fill: Reasons
+// counts the members ruled out by each constraint.
+type ScheduleDraftIssue struct {
+	ID              uint           `json:"id" gorm:"primaryKey"`
+	DraftID         uint           `json:"draft_id" gorm:"not null;index"`
+	Date            time.Time      `json:"date" gorm:"not null"`
+	ShiftTemplateID uint           `json:"shift_template_id"`
+	Required        int            `json:"required"`
+	Assigned        int            `json:"assigned"`
+	Reasons         map[string]int `json:"reasons" gorm:"serializer:json"`
+	Message         string         `json:"message"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+type CalendarFeedScope string
+
+const (
+	CalendarFeedPersonal CalendarFeedScope = "personal"
+	CalendarFeedTeam     CalendarFeedScope = "team"
+)
+
+// CalendarFeedToken grants read access to an ICS subscription URL. Only the
+// SHA-256 hash of the secret is stored; the secret is shown once at creation.
+type CalendarFeedToken struct {
+	ID           uint              `json:"id" gorm:"primaryKey"`
+	UserID       uint              `json:"user_id" gorm:"not null;index"`
+	Scope        CalendarFeedScope `json:"scope" gorm:"not null;size:16"`
+	DepartmentID *uint             `json:"department_id"` // team feeds only
+	Label        string            `json:"label"`
+	TokenHash    string            `json:"-" gorm:"not null;uniqueIndex;size:64"`
+	TokenPrefix  string            `json:"token_prefix" gorm:"not null;size:8"`
+	LastUsedAt   *time.Time        `json:"last_used_at,omitempty"`
+	RevokedAt    *time.Time        `json:"revoked_at,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+
+	User       User        `json:"-" gorm:"foreignKey:UserID"`
+	Department *Department `json:"department,omitempty" gorm:"foreignKey:DepartmentID"`
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CompanyCalendar decides which days are business days for the people it is
+// assigned to, through their location or department. Company holidays
+// (Holiday) close every calendar unless OpenOnHolidays is set.
+type CompanyCalendar struct {
+	ID               uint           `json:"id" gorm:"primaryKey"`
+	Name             string         `json:"name" gorm:"uniqueIndex;not null"`
+	RestWeekdays     string         `json:"rest_weekdays"`     // comma-separated, 0 = Sunday, e.g. "0,6"
+	StatutoryWeekday *int           `json:"statutory_weekday"` // 法定休日; must be a rest weekday
+	OpenOnHolidays   bool           `json:"open_on_holidays" gorm:"default:false"`
+	IsDefault        bool           `json:"is_default" gorm:"default:false"` // used when nothing else is assigned
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `json:"-" gorm:"index"`
+
+	Days []CompanyCalendarDay `json:"days,omitempty" gorm:"foreignKey:CalendarID"`
+}
+
+// IsRestWeekday reports whether weekday is a weekly rest day.
+func (c *CompanyCalendar) IsRestWeekday(weekday time.Weekday) bool {
+	for _, part := range strings.Split(c.RestWeekdays, ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(part)); err == nil && n == int(weekday) {
+			return true
+		}
+	}
+	return false
+}
+
+type CalendarDayKind string
+
+const (
+	// CalendarClosure closes a normally open day, e.g. year-end shutdown.
+	CalendarClosure CalendarDayKind = "closure"
+	// CalendarWorking opens a day that would otherwise be a rest day.
+	CalendarWorking CalendarDayKind = "working"
+	// CalendarStatutory designates a date as the week's 法定休日.
+	CalendarStatutory CalendarDayKind = "statutory_holiday"
+)
+
+// CompanyCalendarDay overrides the weekly pattern on one date.
+type CompanyCalendarDay struct {
+	ID         uint            `json:"id" gorm:"primaryKey"`
+	CalendarID uint            `json:"calendar_id" gorm:"not null;uniqueIndex:idx_calendar_day"`
+	Date       time.Time       `json:"date" gorm:"not null;uniqueIndex:idx_calendar_day"`
+	Kind       CalendarDayKind `json:"kind" gorm:"size:32;not null"`
+	Name       string          `json:"name"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+// Location is a site such as an office or store. Its calendar takes
+// precedence over the department's.
+type Location struct {
+	ID         uint           `json:"id" gorm:"primaryKey"`
+	Name       string         `json:"name" gorm:"uniqueIndex;not null"`
+	CalendarID *uint          `json:"calendar_id" gorm:"index"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
+
+	Calendar *CompanyCalendar `json:"calendar,omitempty" gorm:"foreignKey:CalendarID"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// ApprovalDelegation lets DelegateID act on ManagerID's approval queue
+// between StartDate and EndDate inclusive.
+type ApprovalDelegation struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	ManagerID  uint       `json:"manager_id" gorm:"not null;index"`
+	DelegateID uint       `json:"delegate_id" gorm:"not null;index"`
+	StartDate  time.Time  `json:"start_date" gorm:"not null"`
+	EndDate    time.Time  `json:"end_date" gorm:"not null"`
+	Reason     string     `json:"reason"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+
+	Manager  User `json:"manager,omitempty" gorm:"foreignKey:ManagerID"`
+	Delegate User `json:"delegate,omitempty" gorm:"foreignKey:DelegateID"`
+}
+
+// ActiveOn reports whether the delegation covers day.
+func (d *ApprovalDelegation) ActiveOn(day time.Time) bool {
+	if d.RevokedAt != nil {
+		return false
+	}
+	date := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, d.StartDate.Location())
+	return !date.Before(d.StartDate) && !date.After(d.EndDate)
+}
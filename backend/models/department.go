@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CoveragePolicy decides what happens when leave would take a team below
+// its minimum staffing.
+type CoveragePolicy string
+
+const (
+	CoverageWarn  CoveragePolicy = "warn"
+	CoverageBlock CoveragePolicy = "block"
+)
+
+// Department is a node in the organization tree. Teams are departments with
+// a parent; ManagerID is the head of the node and everything below it.
+type Department struct {
+	ID             uint           `json:"id" gorm:"primaryKey"`
+	Name           string         `json:"name" gorm:"not null"`
+	ParentID       *uint          `json:"parent_id" gorm:"index"`
+	ManagerID      *uint          `json:"manager_id" gorm:"index"`
+	MinStaffing    int            `json:"min_staffing" gorm:"default:0"` // members needed per working day; 0 disables checks
+	CoveragePolicy CoveragePolicy `json:"coverage_policy" gorm:"size:16;default:warn"`
+	CalendarID     *uint          `json:"calendar_id" gorm:"index"` // inherited by sub-departments
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
+
+	Parent  *Department `json:"parent,omitempty" gorm:"foreignKey:ParentID"`
+	Manager *User       `json:"manager,omitempty" gorm:"foreignKey:ManagerID"`
+}
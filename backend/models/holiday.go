@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Holiday is a company-wide non-working date such as a national holiday.
+type Holiday struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	Date      time.Time      `json:"date" gorm:"not null;index"`
+	Name      string         `json:"name" gorm:"not null"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// HolidayWorkKind distinguishes work on the statutory weekly rest day
+// (法定休日) from work on other company days off (所定休日); they carry
+// different premiums.
+type HolidayWorkKind string
+
+const (
+	HolidayWorkStatutory    HolidayWorkKind = "statutory"
+	HolidayWorkNonStatutory HolidayWorkKind = "non_statutory"
+)
+
+// HolidayWorkArrangement is how the day off is given back.
+type HolidayWorkArrangement string
+
+const (
+	// HolidayWorkSubstitute swaps the day off with a working day designated
+	// before the work (振替). The work day counts as an ordinary working day.
+	HolidayWorkSubstitute HolidayWorkArrangement = "substitute"
+	// HolidayWorkCompensatory grants a day off afterwards (代休) from a
+	// balance that expires. The work itself is paid as holiday work.
+	HolidayWorkCompensatory HolidayWorkArrangement = "compensatory"
+	// HolidayWorkPaidOnly gives no day off; only the premium is paid.
+	HolidayWorkPaidOnly HolidayWorkArrangement = "none"
+)
+
+// CompensatoryStatus tracks a compensatory day through the ledger.
+type CompensatoryStatus string
+
+const (
+	CompensatoryOpen    CompensatoryStatus = "open"
+	CompensatoryTaken   CompensatoryStatus = "taken"
+	CompensatoryExpired CompensatoryStatus = "expired"
+)
+
+// HolidayWork records one day worked on a scheduled day off. LeaveID links
+// the substitute leave, or the compensatory leave once it has been taken.
+type HolidayWork struct {
+	ID          uint                   `json:"id" gorm:"primaryKey"`
+	UserID      uint                   `json:"user_id" gorm:"not null;index"`
+	WorkDate    time.Time              `json:"work_date" gorm:"not null;index"`
+	Kind        HolidayWorkKind        `json:"kind" gorm:"not null;size:16"`
+	Arrangement HolidayWorkArrangement `json:"arrangement" gorm:"not null;size:16"`
+	LeaveID     *uint                  `json:"leave_id" gorm:"index"`
+	GrantID     *uint                  `json:"grant_id"`                        // compensatory ledger grant
+	Status      CompensatoryStatus     `json:"status,omitempty" gorm:"size:16"` // compensatory only
+	ExpiresAt   *time.Time             `json:"expires_at,omitempty"`            // compensatory only
+	Note        string                 `json:"note"`
+	CreatedBy   uint                   `json:"created_by" gorm:"not null"`
+	CreatedAt   time.Time              `json:"created_at"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+
+	User  User   `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Leave *Leave `json:"leave,omitempty" gorm:"foreignKey:LeaveID"`
+}
@@ -9,11 +9,21 @@ import (
 type LeaveStatus string
 
 const (
-	LeavePending  LeaveStatus = "pending"
-	LeaveApproved LeaveStatus = "approved"
-	LeaveRejected LeaveStatus = "rejected"
+	LeavePending   LeaveStatus = "pending"
+	LeaveApproved  LeaveStatus = "approved"
+	LeaveRejected  LeaveStatus = "rejected"
+	LeaveCancelled LeaveStatus = "cancelled"
+	// LeaveCancelRequested is an approved leave whose cancellation awaits a
+	// manager; it stays in effect until the cancellation is approved.
+	LeaveCancelRequested LeaveStatus = "cancel_requested"
 )
 
+// EffectiveLeaveStatuses are the statuses of leave that is currently granted.
+var EffectiveLeaveStatuses = []LeaveStatus{LeaveApproved, LeaveCancelRequested}
+
+// InactiveLeaveStatuses are the statuses of leave that no longer reserves time.
+var InactiveLeaveStatuses = []LeaveStatus{LeaveRejected, LeaveCancelled}
+
 type LeaveType string
 
 const (
@@ -22,23 +32,122 @@ const (
 	LeaveTypePersonal LeaveType = "personal"
 	LeaveTypeMaternal LeaveType = "maternal"
 	LeaveTypePaternal LeaveType = "paternal"
+	// LeaveTypeSubstitute is a 振替休日, designated together with the
+	// holiday it replaces; LeaveTypeCompensatory is a 代休 taken against
+	// holiday work already done.
+	LeaveTypeSubstitute   LeaveType = "substitute"
+	LeaveTypeCompensatory LeaveType = "compensatory"
+)
+
+type LeaveUnit string
+
+const (
+	LeaveUnitFull   LeaveUnit = "full"
+	LeaveUnitAMHalf LeaveUnit = "am_half"
+	LeaveUnitPMHalf LeaveUnit = "pm_half"
+	LeaveUnitHours  LeaveUnit = "hours"
 )
 
+// HourlyLeaveCapDays is the statutory yearly limit on paid leave taken in hours.
+const HourlyLeaveCapDays = 5.0
+
 type Leave struct {
-	ID          uint           `json:"id" gorm:"primaryKey"`
-	UserID      uint           `json:"user_id" gorm:"not null;index"`
-	Type        LeaveType      `json:"type" gorm:"not null"`
-	StartDate   time.Time      `json:"start_date" gorm:"not null"`
-	EndDate     time.Time      `json:"end_date" gorm:"not null"`
-	Days        int            `json:"days" gorm:"not null"`
-	Reason      string         `json:"reason"`
-	Status      LeaveStatus    `json:"status" gorm:"default:pending"`
-	ApprovedBy  *uint          `json:"approved_by"`
-	ApprovedAt  *time.Time     `json:"approved_at"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
-
-	User     User  `json:"user,omitempty" gorm:"foreignKey:UserID"`
-	Approver *User `json:"approver,omitempty" gorm:"foreignKey:ApprovedBy"`
-}
\ No newline at end of file
+	ID                uint           `json:"id" gorm:"primaryKey"`
+	UserID            uint           `json:"user_id" gorm:"not null;index"`
+	Type              LeaveType      `json:"type" gorm:"not null"`
+	StartDate         time.Time      `json:"start_date" gorm:"not null"`
+	EndDate           time.Time      `json:"end_date" gorm:"not null"`
+	Unit              LeaveUnit      `json:"unit" gorm:"default:full"`
+	StartTime         *time.Time     `json:"start_time"` // hours unit only
+	EndTime           *time.Time     `json:"end_time"`   // hours unit only
+	Hours             float64        `json:"hours"`      // hours unit only
+	Days              float64        `json:"days" gorm:"not null"`
+	Reason            string         `json:"reason"`
+	Status            LeaveStatus    `json:"status" gorm:"default:pending"`
+	ApprovedBy        *uint          `json:"approved_by"`
+	ApprovedAt        *time.Time     `json:"approved_at"`
+	CancelReason      string         `json:"cancel_reason,omitempty"`
+	CancelRequestedAt *time.Time     `json:"cancel_requested_at,omitempty"`
+	CancelledBy       *uint          `json:"cancelled_by,omitempty"`
+	CancelledAt       *time.Time     `json:"cancelled_at,omitempty"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `json:"-" gorm:"index"`
+
+	User          User           `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Approver      *User          `json:"approver,omitempty" gorm:"foreignKey:ApprovedBy"`
+	ApprovalSteps []ApprovalStep `json:"approval_steps,omitempty" gorm:"polymorphic:Request;polymorphicValue:leave"`
+	Attachments   []Attachment   `json:"attachments,omitempty" gorm:"polymorphic:Owner;polymorphicValue:leave"`
+
+	// CoverageWarnings lists days this leave takes the team below minimum
+	// staffing under a warn policy. Not stored.
+	CoverageWarnings []CoverageShortfall `json:"coverage_warnings,omitempty" gorm:"-"`
+}
+
+// CoverageShortfall is a day on which a team has fewer members available
+// than its minimum staffing.
+type CoverageShortfall struct {
+	Date      string  `json:"date"`
+	Required  int     `json:"required"`
+	Available float64 `json:"available"`
+}
+
+// IsPartialDay reports whether the leave covers less than a whole day.
+func (l *Leave) IsPartialDay() bool {
+	return l.Unit == LeaveUnitAMHalf || l.Unit == LeaveUnitPMHalf || l.Unit == LeaveUnitHours
+}
+
+// window returns the clock-time range the leave covers on a single day,
+// expressed as offsets from midnight. Whole-day leave covers the full day.
+func (l *Leave) window() (time.Duration, time.Duration) {
+	switch l.Unit {
+	case LeaveUnitAMHalf:
+		return 0, 12 * time.Hour
+	case LeaveUnitPMHalf:
+		return 12 * time.Hour, 24 * time.Hour
+	case LeaveUnitHours:
+		if l.StartTime != nil && l.EndTime != nil {
+			return clockOffset(*l.StartTime), clockOffset(*l.EndTime)
+		}
+	}
+	return 0, 24 * time.Hour
+}
+
+func clockOffset(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+}
+
+// Conflicts reports whether two leaves cover any of the same time.
+// Morning and afternoon halves of the same day do not conflict.
+func (l *Leave) Conflicts(o *Leave) bool {
+	if l.StartDate.After(o.EndDate) || o.StartDate.After(l.EndDate) {
+		return false
+	}
+	if !l.IsPartialDay() || !o.IsPartialDay() {
+		return true
+	}
+	lStart, lEnd := l.window()
+	oStart, oEnd := o.window()
+	return lStart < oEnd && oStart < lEnd
+}
+
+// CoveredHours returns how many hours of a working day of dayHours length
+// the leave accounts for on day.
+func (l *Leave) CoveredHours(day time.Time, dayHours float64) float64 {
+	d := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	start := time.Date(l.StartDate.Year(), l.StartDate.Month(), l.StartDate.Day(), 0, 0, 0, 0, day.Location())
+	end := time.Date(l.EndDate.Year(), l.EndDate.Month(), l.EndDate.Day(), 0, 0, 0, 0, day.Location())
+	if d.Before(start) || d.After(end) {
+		return 0
+	}
+	switch l.Unit {
+	case LeaveUnitAMHalf, LeaveUnitPMHalf:
+		return dayHours / 2
+	case LeaveUnitHours:
+		if l.Hours > dayHours {
+			return dayHours
+		}
+		return l.Hours
+	}
+	return dayHours
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+type LeaveTransactionKind string
+
+const (
+	LeaveTxGrant   LeaveTransactionKind = "grant"
+	LeaveTxUse     LeaveTransactionKind = "use"
+	LeaveTxRestore LeaveTransactionKind = "restore"
+	LeaveTxAdjust  LeaveTransactionKind = "adjust"
+	LeaveTxExpire  LeaveTransactionKind = "expire"
+)
+
+// LeaveBalanceTransaction is one signed entry in a user's per-type leave ledger.
+// The balance is the sum of Days; rows are append-only and never updated.
+type LeaveBalanceTransaction struct {
+	ID            uint                 `json:"id" gorm:"primaryKey"`
+	UserID        uint                 `json:"user_id" gorm:"not null;index:idx_leave_tx_user_type"`
+	LeaveType     LeaveType            `json:"leave_type" gorm:"not null;index:idx_leave_tx_user_type"`
+	Kind          LeaveTransactionKind `json:"kind" gorm:"not null"`
+	Days          float64              `json:"days" gorm:"not null"` // positive credits, negative debits
+	Hours         float64              `json:"hours"`                // hourly leave only, same sign as Days
+	LeaveID       *uint                `json:"leave_id" gorm:"index"`
+	EffectiveDate time.Time            `json:"effective_date" gorm:"not null"`
+	ExpiresAt     *time.Time           `json:"expires_at"` // grants only
+	Note          string               `json:"note"`
+	CreatedBy     *uint                `json:"created_by"`
+	CreatedAt     time.Time            `json:"created_at"`
+
+	User  User   `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Leave *Leave `json:"leave,omitempty" gorm:"foreignKey:LeaveID"`
+}
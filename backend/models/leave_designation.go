@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// LeaveDesignation is the audit record for a leave date designated by an
+// admin (時季指定) to meet the annual five-day paid leave obligation.
+type LeaveDesignation struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	LeaveID      uint      `json:"leave_id" gorm:"not null;uniqueIndex"`
+	UserID       uint      `json:"user_id" gorm:"not null;index"`
+	GrantID      *uint     `json:"grant_id"` // qualifying LeaveBalanceTransaction
+	DesignatedBy uint      `json:"designated_by" gorm:"not null"`
+	Reason       string    `json:"reason"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	Leave    Leave `json:"leave,omitempty" gorm:"foreignKey:LeaveID"`
+	User     User  `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Designer User  `json:"designer,omitempty" gorm:"foreignKey:DesignatedBy"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LeaveTypeDefinition holds the rules for one leave type code.
+type LeaveTypeDefinition struct {
+	ID                 uint           `json:"id" gorm:"primaryKey"`
+	Code               LeaveType      `json:"code" gorm:"not null;uniqueIndex;size:64"`
+	NameJa             string         `json:"name_ja" gorm:"not null"`
+	NameEn             string         `json:"name_en" gorm:"not null"`
+	IsPaid             bool           `json:"is_paid" gorm:"not null"`
+	UsesBalance        bool           `json:"uses_balance" gorm:"not null"`
+	MaxConsecutiveDays *int           `json:"max_consecutive_days"` // nil means no limit
+	MinNoticeDays      int            `json:"min_notice_days" gorm:"not null"`
+	RequiresAttachment bool           `json:"requires_attachment" gorm:"not null"`
+	AllowHalfDay       bool           `json:"allow_half_day" gorm:"not null"`
+	AllowHourly        bool           `json:"allow_hourly" gorm:"not null"`
+	Active             bool           `json:"active" gorm:"not null"`
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	DeletedAt          gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// AllowsUnit reports whether leave of this type may be taken in unit.
+func (d *LeaveTypeDefinition) AllowsUnit(unit LeaveUnit) bool {
+	switch unit {
+	case LeaveUnitAMHalf, LeaveUnitPMHalf:
+		return d.AllowHalfDay
+	case LeaveUnitHours:
+		return d.AllowHourly
+	}
+	return true
+}
+
+// DefaultLeaveTypes are the built-in types seeded on first start.
+func DefaultLeaveTypes() []LeaveTypeDefinition {
+	return []LeaveTypeDefinition{
+		{Code: LeaveTypeVacation, NameJa: "年次有給休暇", NameEn: "Annual paid leave", IsPaid: true, UsesBalance: true, AllowHalfDay: true, AllowHourly: true, Active: true},
+		{Code: LeaveTypeSick, NameJa: "病気休暇", NameEn: "Sick leave", AllowHalfDay: true, Active: true},
+		{Code: LeaveTypePersonal, NameJa: "私用休暇", NameEn: "Personal leave", MinNoticeDays: 3, Active: true},
+		{Code: LeaveTypeMaternal, NameJa: "産前産後休業", NameEn: "Maternity leave", RequiresAttachment: true, Active: true},
+		{Code: LeaveTypePaternal, NameJa: "育児休業", NameEn: "Childcare leave", RequiresAttachment: true, Active: true},
+		{Code: LeaveTypeSubstitute, NameJa: "振替休日", NameEn: "Substitute holiday", IsPaid: true, Active: true},
+		{Code: LeaveTypeCompensatory, NameJa: "代休", NameEn: "Compensatory day off", UsesBalance: true, Active: true},
+	}
+}
+
+// SeedLeaveTypes inserts any default leave type that does not exist yet.
+// Existing definitions are left as administrators configured them.
+func SeedLeaveTypes(db *gorm.DB) error {
+	for _, def := range DefaultLeaveTypes() {
+		var count int64
+		if err := db.Unscoped().Model(&LeaveTypeDefinition{}).Where("code = ?", def.Code).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		if err := db.Create(&def).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type MonthlyConfirmationStatus string
+
+const (
+	MonthlyConfirmationOpen      MonthlyConfirmationStatus = "open" // no row yet
+	MonthlyConfirmationConfirmed MonthlyConfirmationStatus = "confirmed"
+	MonthlyConfirmationApproved  MonthlyConfirmationStatus = "approved"
+	MonthlyConfirmationReturned  MonthlyConfirmationStatus = "returned" // sent back to the employee
+)
+
+// MonthlyConfirmation is one employee's sign-off on a month (月締め): they
+// confirm their records, then their manager approves them.
+type MonthlyConfirmation struct {
+	ID          uint                      `json:"id" gorm:"primaryKey"`
+	UserID      uint                      `json:"user_id" gorm:"not null;uniqueIndex:idx_monthly_confirmation"`
+	Month       string                    `json:"month" gorm:"size:7;not null;uniqueIndex:idx_monthly_confirmation"` // YYYY-MM
+	Status      MonthlyConfirmationStatus `json:"status" gorm:"size:16;not null"`
+	ConfirmedAt *time.Time                `json:"confirmed_at"`
+	ApprovedBy  *uint                     `json:"approved_by"`
+	ApprovedAt  *time.Time                `json:"approved_at"`
+	Comment     string                    `json:"comment"`
+	CreatedAt   time.Time                 `json:"created_at"`
+	UpdatedAt   time.Time                 `json:"updated_at"`
+}
+
+type ClosingStatus string
+
+const (
+	ClosingOpen   ClosingStatus = "open"
+	ClosingClosed ClosingStatus = "closed"
+)
+
+// ClosingPeriod is the payroll close of one month. While it is closed,
+// attendance, leave and schedules in the month cannot be changed.
+type ClosingPeriod struct {
+	ID           uint          `json:"id" gorm:"primaryKey"`
+	Month        string        `json:"month" gorm:"size:7;not null;uniqueIndex"` // YYYY-MM
+	Status       ClosingStatus `json:"status" gorm:"size:16;not null"`
+	ClosedBy     *uint         `json:"closed_by"`
+	ClosedAt     *time.Time    `json:"closed_at"`
+	ReopenedBy   *uint         `json:"reopened_by"`
+	ReopenedAt   *time.Time    `json:"reopened_at"`
+	ReopenReason string        `json:"reopen_reason"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+}
+
+// ClosingEvent records each close and reopen of a month.
+type ClosingEvent struct {
+	ID        uint          `json:"id" gorm:"primaryKey"`
+	Month     string        `json:"month" gorm:"size:7;not null;index"`
+	Status    ClosingStatus `json:"status" gorm:"size:16;not null"` // the status it moved to
+	ActorID   uint          `json:"actor_id" gorm:"not null"`
+	Reason    string        `json:"reason"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// ClosedMonths lists the closed months, YYYY-MM, among those from start to
+// end.
+func ClosedMonths(db *gorm.DB, start, end time.Time) ([]string, error) {
+	var months []string
+	first := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC)
+	last := time.Date(end.Year(), end.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for m := first; !m.After(last); m = m.AddDate(0, 1, 0) {
+		months = append(months, m.Format("2006-01"))
+	}
+
+	var closed []string
+	err := db.Model(&ClosingPeriod{}).Where("month IN ? AND status = ?", months, ClosingClosed).
+		Order("month ASC").Pluck("month", &closed).Error
+	return closed, err
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+type NotificationKind string
+
+const (
+	NotificationSchedulePublished NotificationKind = "schedule_published"
+	NotificationScheduleChanged   NotificationKind = "schedule_changed"
+)
+
+// Notification is an in-app message for one user.
+type Notification struct {
+	ID        uint             `json:"id" gorm:"primaryKey"`
+	UserID    uint             `json:"user_id" gorm:"not null;index"`
+	Kind      NotificationKind `json:"kind" gorm:"size:32;not null"`
+	Title     string           `json:"title" gorm:"not null"`
+	Body      string           `json:"body"`
+	ReadAt    *time.Time       `json:"read_at"`
+	CreatedAt time.Time        `json:"created_at"`
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ShiftTemplate is a named shift such as "Early 07:00-16:00". Times are
+// HH:MM; an end at or before the start runs past midnight.
+type ShiftTemplate struct {
+	ID         uint           `json:"id" gorm:"primaryKey"`
+	Name       string         `json:"name" gorm:"not null;uniqueIndex;size:100"`
+	StartTime  string         `json:"start_time" gorm:"not null;size:5"`
+	EndTime    string         `json:"end_time" gorm:"not null;size:5"`
+	BreakTime  int            `json:"break_time" gorm:"not null"` // minutes
+	IsFlexTime bool           `json:"is_flex_time" gorm:"not null"`
+	Note       string         `json:"note"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// RotationPattern repeats every CycleWeeks weeks. Day 0 of the cycle is a
+// Monday; days without a slot are days off.
+type RotationPattern struct {
+	ID         uint           `json:"id" gorm:"primaryKey"`
+	Name       string         `json:"name" gorm:"not null;size:100"`
+	CycleWeeks int            `json:"cycle_weeks" gorm:"not null"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
+
+	Slots []RotationSlot `json:"slots,omitempty" gorm:"foreignKey:PatternID;constraint:OnDelete:CASCADE"`
+}
+
+func (p *RotationPattern) CycleDays() int {
+	return p.CycleWeeks * 7
+}
+
+type RotationSlot struct {
+	ID              uint `json:"id" gorm:"primaryKey"`
+	PatternID       uint `json:"pattern_id" gorm:"not null;index"`
+	DayIndex        int  `json:"day_index" gorm:"not null"` // 0 = Monday of the first week
+	ShiftTemplateID uint `json:"shift_template_id" gorm:"not null"`
+
+	ShiftTemplate ShiftTemplate `json:"shift_template,omitempty" gorm:"foreignKey:ShiftTemplateID"`
+}
+
+// RotationAssignment puts a user on a pattern from StartDate. The cycle is
+// counted from the Monday of StartDate's week, shifted by WeekOffset so that
+// teams on the same pattern can be staggered.
+type RotationAssignment struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"not null;index"`
+	PatternID  uint       `json:"pattern_id" gorm:"not null;index"`
+	StartDate  time.Time  `json:"start_date" gorm:"not null"`
+	EndDate    *time.Time `json:"end_date"` // nil means open-ended
+	WeekOffset int        `json:"week_offset" gorm:"not null"`
+	CreatedBy  uint       `json:"created_by" gorm:"not null"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+
+	User    User            `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Pattern RotationPattern `json:"pattern,omitempty" gorm:"foreignKey:PatternID"`
+}
+
+// Covers reports whether the assignment applies on day.
+func (a *RotationAssignment) Covers(day time.Time) bool {
+	if day.Before(a.StartDate) {
+		return false
+	}
+	return a.EndDate == nil || !day.After(*a.EndDate)
+}
@@ -6,27 +6,46 @@ import (
 	"gorm.io/gorm"
 )
 
+// ScheduleSource records how a schedule was made. Regenerating a rota only
+// replaces generated rows, so manual and auto-scheduled entries act as
+// overrides.
+type ScheduleSource string
+
+const (
+	ScheduleManual    ScheduleSource = "manual"
+	ScheduleGenerated ScheduleSource = "generated" // from a rotation pattern
+	ScheduleAuto      ScheduleSource = "auto"      // from an accepted scheduler draft
+)
+
 type Schedule struct {
-	ID           uint           `json:"id" gorm:"primaryKey"`
-	UserID       uint           `json:"user_id" gorm:"not null;index"`
-	Date         time.Time      `json:"date" gorm:"not null;index"`
-	StartTime    time.Time      `json:"start_time" gorm:"not null"`
-	EndTime      time.Time      `json:"end_time" gorm:"not null"`
-	BreakTime    int            `json:"break_time" gorm:"default:60"` // minutes
-	IsFlexTime   bool           `json:"is_flex_time" gorm:"default:false"`
-	Note         string         `json:"note"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+	ID              uint           `json:"id" gorm:"primaryKey"`
+	UserID          uint           `json:"user_id" gorm:"not null;index"`
+	Date            time.Time      `json:"date" gorm:"not null;index"`
+	StartTime       time.Time      `json:"start_time" gorm:"not null"`
+	EndTime         time.Time      `json:"end_time" gorm:"not null"`
+	BreakTime       int            `json:"break_time" gorm:"default:60"` // minutes
+	IsFlexTime      bool           `json:"is_flex_time" gorm:"default:false"`
+	Note            string         `json:"note"`
+	Source          ScheduleSource `json:"source" gorm:"size:16;default:manual"`
+	ShiftTemplateID *uint          `json:"shift_template_id"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
 
 	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
 }
 
-func (s *Schedule) PlannedHours() float64 {
+// PlannedHours is the shift less its break, or less the rule's minimum
+// break when that is longer. A nil rule takes the break as planned.
+func (s *Schedule) PlannedHours(rule *WorkRule) float64 {
 	duration := s.EndTime.Sub(s.StartTime)
-	hours := duration.Hours() - float64(s.BreakTime)/60.0
+	breakTime := s.BreakTime
+	if rule != nil {
+		breakTime = rule.BreakFor(duration, breakTime)
+	}
+	hours := duration.Hours() - float64(breakTime)/60.0
 	if hours < 0 {
 		return 0
 	}
 	return hours
-}
\ No newline at end of file
+}
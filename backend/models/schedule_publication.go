@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// SchedulePublication tracks the published version of one department's
+// schedules for one month. Managers edit the live schedules freely;
+// employees only see the snapshot taken at the latest publish.
+type SchedulePublication struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	DepartmentID uint       `json:"department_id" gorm:"not null;uniqueIndex:idx_publication_department_month"`
+	Month        string     `json:"month" gorm:"size:7;not null;uniqueIndex:idx_publication_department_month"` // YYYY-MM
+	Version      int        `json:"version" gorm:"default:0"`                                                  // 0 until first published
+	PublishedAt  *time.Time `json:"published_at"`
+	PublishedBy  *uint      `json:"published_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+
+	Department Department `json:"department,omitempty" gorm:"foreignKey:DepartmentID"`
+}
+
+// PublishedSchedule is a schedule as it stood in one published version.
+type PublishedSchedule struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	PublicationID uint      `json:"publication_id" gorm:"not null;index:idx_published_schedule_version"`
+	Version       int       `json:"version" gorm:"not null;index:idx_published_schedule_version"`
+	ScheduleID    uint      `json:"schedule_id" gorm:"not null"`
+	UserID        uint      `json:"user_id" gorm:"not null;index"`
+	Date          time.Time `json:"date" gorm:"not null;index"`
+	StartTime     time.Time `json:"start_time" gorm:"not null"`
+	EndTime       time.Time `json:"end_time" gorm:"not null"`
+	BreakTime     int       `json:"break_time"`
+	IsFlexTime    bool      `json:"is_flex_time"`
+	Note          string    `json:"note"`
+	PublishedAt   time.Time `json:"published_at"`
+}
+
+type ScheduleChangeKind string
+
+const (
+	ScheduleChangeAdded   ScheduleChangeKind = "added"
+	ScheduleChangeRemoved ScheduleChangeKind = "removed"
+	ScheduleChangeUpdated ScheduleChangeKind = "updated"
+)
+
+// ScheduleChange is one difference between a published version and the one
+// before it, from the point of view of the affected employee.
+type ScheduleChange struct {
+	ID            uint               `json:"id" gorm:"primaryKey"`
+	PublicationID uint               `json:"publication_id" gorm:"not null;index"`
+	Version       int                `json:"version" gorm:"not null"`
+	UserID        uint               `json:"user_id" gorm:"not null;index"`
+	ScheduleID    uint               `json:"schedule_id"`
+	Date          time.Time          `json:"date" gorm:"not null"`
+	Kind          ScheduleChangeKind `json:"kind" gorm:"size:16;not null"`
+	Before        string             `json:"before"` // HH:MM-HH:MM, empty when added
+	After         string             `json:"after"`  // HH:MM-HH:MM, empty when removed
+	CreatedAt     time.Time          `json:"created_at"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// ShiftSwapKind distinguishes trading two shifts from giving one away.
+type ShiftSwapKind string
+
+const (
+	// ShiftSwapExchange trades the offered schedule for one of the
+	// accepter's schedules.
+	ShiftSwapExchange ShiftSwapKind = "swap"
+	// ShiftSwapCover hands the offered schedule to the accepter.
+	ShiftSwapCover ShiftSwapKind = "cover"
+)
+
+type ShiftSwapStatus string
+
+const (
+	ShiftSwapOpen      ShiftSwapStatus = "open"      // waiting for a colleague
+	ShiftSwapAccepted  ShiftSwapStatus = "accepted"  // waiting for a manager
+	ShiftSwapCompleted ShiftSwapStatus = "completed" // schedules reassigned
+	ShiftSwapDeclined  ShiftSwapStatus = "declined"  // the named colleague said no
+	ShiftSwapRejected  ShiftSwapStatus = "rejected"  // a manager said no
+	ShiftSwapCancelled ShiftSwapStatus = "cancelled"
+)
+
+// ActiveShiftSwapStatuses are the statuses of requests that still hold
+// their schedules.
+var ActiveShiftSwapStatuses = []ShiftSwapStatus{ShiftSwapOpen, ShiftSwapAccepted}
+
+// ShiftSwapRequest offers a schedule to a named colleague or, without a
+// target, to anyone on the cover board.
+type ShiftSwapRequest struct {
+	ID                uint            `json:"id" gorm:"primaryKey"`
+	Kind              ShiftSwapKind   `json:"kind" gorm:"size:16;not null"`
+	Status            ShiftSwapStatus `json:"status" gorm:"size:16;not null;index"`
+	RequesterID       uint            `json:"requester_id" gorm:"not null;index"`
+	ScheduleID        uint            `json:"schedule_id" gorm:"not null;index"`
+	TargetUserID      *uint           `json:"target_user_id" gorm:"index"`
+	AccepterID        *uint           `json:"accepter_id" gorm:"index"`
+	CounterScheduleID *uint           `json:"counter_schedule_id" gorm:"index"` // swap only
+	RequiresApproval  bool            `json:"requires_approval"`
+	Reason            string          `json:"reason"`
+	AcceptedAt        *time.Time      `json:"accepted_at"`
+	DecidedBy         *uint           `json:"decided_by"`
+	DecidedAt         *time.Time      `json:"decided_at"`
+	DecisionNote      string          `json:"decision_note"`
+	CreatedAt         time.Time       `json:"created_at"`
+	UpdatedAt         time.Time       `json:"updated_at"`
+
+	Requester       User      `json:"requester,omitempty" gorm:"foreignKey:RequesterID"`
+	TargetUser      *User     `json:"target_user,omitempty" gorm:"foreignKey:TargetUserID"`
+	Accepter        *User     `json:"accepter,omitempty" gorm:"foreignKey:AccepterID"`
+	Schedule        Schedule  `json:"schedule" gorm:"foreignKey:ScheduleID"`
+	CounterSchedule *Schedule `json:"counter_schedule,omitempty" gorm:"foreignKey:CounterScheduleID"`
+}
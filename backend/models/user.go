@@ -11,7 +11,11 @@ type User struct {
     SupabaseUID string       `json:"supabase_uid" gorm:"uniqueIndex;size:64"`
     Email     string         `json:"email" gorm:"uniqueIndex;not null"`
     Name      string         `json:"name" gorm:"not null"`
+    EmployeeCode *string     `json:"employee_code" gorm:"uniqueIndex;size:32"` // payroll / planner ID
     Role      string         `json:"role" gorm:"default:employee"`
+    DepartmentID *uint       `json:"department_id" gorm:"index"`
+    ManagerID    *uint       `json:"manager_id" gorm:"index"` // reporting line
+    LocationID   *uint       `json:"location_id" gorm:"index"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
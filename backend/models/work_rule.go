@@ -0,0 +1,110 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type RoundingMode string
+
+const (
+	RoundingNone    RoundingMode = "none"
+	RoundingUp      RoundingMode = "up"
+	RoundingDown    RoundingMode = "down"
+	RoundingNearest RoundingMode = "nearest"
+)
+
+// BreakRule requires at least BreakMinutes of break once the time between
+// clock-in and clock-out exceeds AfterMinutes.
+type BreakRule struct {
+	AfterMinutes int `json:"after_minutes"`
+	BreakMinutes int `json:"break_minutes"`
+}
+
+// WorkRule (就業規則) bundles the settings that turn clock times and shifts
+// into hours. Users are assigned rules from a date onwards; see
+// WorkRuleAssignment.
+type WorkRule struct {
+	ID                    uint           `json:"id" gorm:"primaryKey"`
+	Name                  string         `json:"name" gorm:"not null;uniqueIndex;size:100"`
+	StandardDailyMinutes  int            `json:"standard_daily_minutes" gorm:"not null"` // 所定労働時間
+	BreakRules            []BreakRule    `json:"break_rules" gorm:"serializer:json"`
+	DailyOvertimeMinutes  int            `json:"daily_overtime_minutes" gorm:"not null"`  // work past this in a day is overtime
+	WeeklyOvertimeMinutes int            `json:"weekly_overtime_minutes" gorm:"not null"` // work past this in a Monday-based week is overtime
+	RoundingMinutes       int            `json:"rounding_minutes" gorm:"not null"`        // 0 disables rounding
+	ClockInRounding       RoundingMode   `json:"clock_in_rounding" gorm:"size:16;not null"`
+	ClockOutRounding      RoundingMode   `json:"clock_out_rounding" gorm:"size:16;not null"`
+	CalendarID            *uint          `json:"calendar_id"`                     // holiday calendar; beats location and department
+	IsDefault             bool           `json:"is_default" gorm:"default:false"` // applies to users with no assignment
+	CreatedAt             time.Time      `json:"created_at"`
+	UpdatedAt             time.Time      `json:"updated_at"`
+	DeletedAt             gorm.DeletedAt `json:"-" gorm:"index"`
+
+	Calendar *CompanyCalendar `json:"calendar,omitempty" gorm:"foreignKey:CalendarID"`
+}
+
+func (r *WorkRule) StandardDailyHours() float64 {
+	return float64(r.StandardDailyMinutes) / 60
+}
+
+// RequiredBreak is the shortest break the rule allows for a span between
+// clock-in and clock-out.
+func (r *WorkRule) RequiredBreak(span time.Duration) int {
+	required := 0
+	for _, b := range r.BreakRules {
+		if span.Minutes() > float64(b.AfterMinutes) && b.BreakMinutes > required {
+			required = b.BreakMinutes
+		}
+	}
+	return required
+}
+
+// BreakFor is the break to deduct from a span: the break taken, or the
+// rule's minimum if that is longer.
+func (r *WorkRule) BreakFor(span time.Duration, taken int) int {
+	if required := r.RequiredBreak(span); required > taken {
+		return required
+	}
+	return taken
+}
+
+func (r *WorkRule) RoundClockIn(t time.Time) time.Time {
+	return r.round(t, r.ClockInRounding)
+}
+
+func (r *WorkRule) RoundClockOut(t time.Time) time.Time {
+	return r.round(t, r.ClockOutRounding)
+}
+
+func (r *WorkRule) round(t time.Time, mode RoundingMode) time.Time {
+	if r.RoundingMinutes <= 0 {
+		return t
+	}
+	unit := time.Duration(r.RoundingMinutes) * time.Minute
+	switch mode {
+	case RoundingDown:
+		return t.Truncate(unit)
+	case RoundingUp:
+		if down := t.Truncate(unit); down.Before(t) {
+			return down.Add(unit)
+		}
+	case RoundingNearest:
+		return t.Round(unit)
+	}
+	return t
+}
+
+// WorkRuleAssignment puts a user on a rule from EffectiveFrom until their
+// next assignment, so a change of rules never rewrites earlier days.
+type WorkRuleAssignment struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	UserID        uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_work_rule_assignment"`
+	WorkRuleID    uint      `json:"work_rule_id" gorm:"not null;index"`
+	EffectiveFrom time.Time `json:"effective_from" gorm:"not null;uniqueIndex:idx_work_rule_assignment"`
+	CreatedBy     uint      `json:"created_by" gorm:"not null"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+
+	WorkRule WorkRule `json:"work_rule,omitempty" gorm:"foreignKey:WorkRuleID"`
+}
@@ -6,10 +6,11 @@ import (
     "github.com/labstack/echo/v4"
     "github.com/yudai-uk/backend/handlers"
     appmw "github.com/yudai-uk/backend/middleware"
+    "github.com/yudai-uk/backend/storage"
     "gorm.io/gorm"
 )
 
-func SetupRoutes(e *echo.Echo, db *gorm.DB) {
+func SetupRoutes(e *echo.Echo, db *gorm.DB, store storage.Storage, scanner storage.Scanner) {
 	// Health check endpoint
 	e.GET("/health", func(c echo.Context) error {
 		return c.JSON(200, map[string]string{
@@ -22,6 +23,27 @@ func SetupRoutes(e *echo.Echo, db *gorm.DB) {
 	leaveHandler := handlers.NewLeaveHandler(db)
 	scheduleHandler := handlers.NewScheduleHandler(db)
 	adminHandler := handlers.NewAdminHandler(db)
+	approvalHandler := handlers.NewApprovalHandler(db)
+	organizationHandler := handlers.NewOrganizationHandler(db)
+	delegationHandler := handlers.NewDelegationHandler(db)
+	calendarHandler := handlers.NewCalendarHandler(db)
+	leaveTypeHandler := handlers.NewLeaveTypeHandler(db)
+	attachmentHandler := handlers.NewAttachmentHandler(db, store, scanner)
+	calendarFeedHandler := handlers.NewCalendarFeedHandler(db)
+	holidayWorkHandler := handlers.NewHolidayWorkHandler(db)
+	rotaHandler := handlers.NewRotaHandler(db)
+	shiftSwapHandler := handlers.NewShiftSwapHandler(db)
+	autoScheduleHandler := handlers.NewAutoScheduleHandler(db)
+	availabilityHandler := handlers.NewAvailabilityHandler(db)
+	publicationHandler := handlers.NewSchedulePublicationHandler(db)
+	notificationHandler := handlers.NewNotificationHandler(db)
+	companyCalendarHandler := handlers.NewCompanyCalendarHandler(db)
+	workRuleHandler := handlers.NewWorkRuleHandler(db)
+	monthlyCloseHandler := handlers.NewMonthlyCloseHandler(db)
+
+	// Calendar subscriptions authenticate with the secret token in the URL,
+	// since calendar clients cannot send a Supabase JWT.
+	e.GET("/api/v1/feeds/:token", calendarFeedHandler.ServeFeed)
 
     api := e.Group("/api/v1")
     jwtSecret := os.Getenv("SUPABASE_JWT_SECRET")
@@ -45,16 +67,139 @@ func SetupRoutes(e *echo.Echo, db *gorm.DB) {
 		default:
 			return attendanceHandler.ClockIn(c)
 		}
-	})
+	}, appmw.OpenPeriodMiddleware(db))
 	api.GET("/attendance/me", attendanceHandler.GetMyAttendance)
 
 	api.POST("/leaves", leaveHandler.CreateLeave)
 	api.GET("/leaves", leaveHandler.GetLeaves)
+	api.GET("/leaves/balance", leaveHandler.GetBalance)
+	api.GET("/leaves/calendar", leaveHandler.GetLeaveCalendar)
+	api.GET("/leave-types", leaveTypeHandler.GetLeaveTypes)
+	api.GET("/leaves/approvals/pending", leaveHandler.GetApprovalQueue)
+	api.GET("/leaves/:leaveId/approvals", leaveHandler.GetLeaveApprovals)
 	api.PUT("/leaves/:leaveId/status", leaveHandler.UpdateLeaveStatus)
+	api.POST("/leaves/:leaveId/cancel", leaveHandler.CancelLeave)
+	api.PUT("/leaves/:leaveId/cancellation", leaveHandler.UpdateCancellation)
+	api.GET("/leaves/:leaveId/attachments", attachmentHandler.GetLeaveAttachments)
+	api.POST("/leaves/:leaveId/attachments", attachmentHandler.UploadLeaveAttachment)
+	api.GET("/attachments/:attachmentId", attachmentHandler.DownloadAttachment)
+	api.DELETE("/attachments/:attachmentId", attachmentHandler.DeleteAttachment)
 
 	api.GET("/schedules", scheduleHandler.GetSchedules)
+	api.GET("/shift-swaps", shiftSwapHandler.GetShiftSwaps)
+	api.POST("/shift-swaps", shiftSwapHandler.CreateShiftSwap)
+	api.GET("/shift-swaps/board", shiftSwapHandler.GetShiftSwapBoard)
+	api.GET("/shift-swaps/approvals/pending", shiftSwapHandler.GetPendingShiftSwaps)
+	api.POST("/shift-swaps/:swapId/accept", shiftSwapHandler.AcceptShiftSwap)
+	api.POST("/shift-swaps/:swapId/decline", shiftSwapHandler.DeclineShiftSwap)
+	api.POST("/shift-swaps/:swapId/cancel", shiftSwapHandler.CancelShiftSwap)
+	api.PUT("/shift-swaps/:swapId/status", shiftSwapHandler.UpdateShiftSwapStatus)
+	api.GET("/availability", availabilityHandler.GetAvailability)
+	api.PUT("/availability", availabilityHandler.SetAvailability)
+	api.DELETE("/availability/:availabilityId", availabilityHandler.DeleteAvailability)
+	api.GET("/availability-periods", availabilityHandler.GetMyAvailabilityPeriods)
+	api.POST("/availability-periods/:periodId/submit", availabilityHandler.SubmitAvailability)
+	api.GET("/notifications", notificationHandler.GetNotifications)
+	api.POST("/notifications/read-all", notificationHandler.MarkAllNotificationsRead)
+	api.POST("/notifications/:notificationId/read", notificationHandler.MarkNotificationRead)
+	api.GET("/holidays", calendarHandler.GetHolidays)
+	api.GET("/company-calendars", companyCalendarHandler.GetCalendars)
+	api.GET("/company-calendars/:calendarId", companyCalendarHandler.GetCalendar)
+	api.GET("/business-days", companyCalendarHandler.GetBusinessDays)
+	api.GET("/work-rule", workRuleHandler.GetMyWorkRule)
+	api.GET("/holiday-works", holidayWorkHandler.GetHolidayWorks)
+	api.GET("/monthly-closes/me", monthlyCloseHandler.GetMyMonthlyClose)
+	api.POST("/monthly-closes/:month/confirm", monthlyCloseHandler.ConfirmMonth)
+	api.GET("/calendar-feeds", calendarFeedHandler.GetFeeds)
+	api.POST("/calendar-feeds", calendarFeedHandler.CreateFeed)
+	api.DELETE("/calendar-feeds/:feedId", calendarFeedHandler.RevokeFeed)
 
     admin := api.Group("/admin")
     admin.Use(appmw.AdminMiddleware)
 	admin.GET("/reports/monthly", adminHandler.GetMonthlyReports)
+	admin.GET("/reports/variance", adminHandler.GetVarianceReport)
+	admin.GET("/leave-balances/transactions", leaveHandler.GetBalanceTransactions)
+	admin.POST("/leave-balances/transactions", leaveHandler.CreateBalanceTransaction)
+	admin.GET("/reports/annual-leave-obligation", adminHandler.GetAnnualLeaveObligations)
+	admin.POST("/leaves/designate", leaveHandler.DesignateLeave)
+	admin.GET("/leaves/designations", leaveHandler.GetLeaveDesignations)
+	admin.GET("/approval-routes", approvalHandler.GetRoutes)
+	admin.POST("/approval-routes", approvalHandler.CreateRoute, appmw.AdminOnlyMiddleware)
+	admin.PUT("/approval-routes/:routeId", approvalHandler.UpdateRoute, appmw.AdminOnlyMiddleware)
+	admin.DELETE("/approval-routes/:routeId", approvalHandler.DeleteRoute, appmw.AdminOnlyMiddleware)
+	admin.GET("/departments", organizationHandler.GetDepartments)
+	admin.POST("/departments", organizationHandler.CreateDepartment, appmw.AdminOnlyMiddleware)
+	admin.PUT("/departments/:departmentId", organizationHandler.UpdateDepartment, appmw.AdminOnlyMiddleware)
+	admin.DELETE("/departments/:departmentId", organizationHandler.DeleteDepartment, appmw.AdminOnlyMiddleware)
+	admin.PUT("/users/:userId/organization", organizationHandler.UpdateUserOrganization, appmw.AdminOnlyMiddleware)
+	admin.GET("/delegations", delegationHandler.GetDelegations)
+	admin.POST("/delegations", delegationHandler.CreateDelegation)
+	admin.DELETE("/delegations/:delegationId", delegationHandler.RevokeDelegation)
+	admin.POST("/approvals/escalate", delegationHandler.EscalateApprovals, appmw.AdminOnlyMiddleware)
+	admin.POST("/holidays", calendarHandler.CreateHoliday, appmw.AdminOnlyMiddleware)
+	admin.POST("/leave-types", leaveTypeHandler.CreateLeaveType, appmw.AdminOnlyMiddleware)
+	admin.PUT("/leave-types/:leaveTypeId", leaveTypeHandler.UpdateLeaveType, appmw.AdminOnlyMiddleware)
+	admin.DELETE("/leave-types/:leaveTypeId", leaveTypeHandler.DeleteLeaveType, appmw.AdminOnlyMiddleware)
+	admin.DELETE("/holidays/:holidayId", calendarHandler.DeleteHoliday, appmw.AdminOnlyMiddleware)
+	admin.POST("/company-calendars", companyCalendarHandler.CreateCalendar, appmw.AdminOnlyMiddleware)
+	admin.PUT("/company-calendars/:calendarId", companyCalendarHandler.UpdateCalendar, appmw.AdminOnlyMiddleware)
+	admin.DELETE("/company-calendars/:calendarId", companyCalendarHandler.DeleteCalendar, appmw.AdminOnlyMiddleware)
+	admin.PUT("/company-calendars/:calendarId/days", companyCalendarHandler.SetCalendarDay, appmw.AdminOnlyMiddleware)
+	admin.DELETE("/company-calendars/:calendarId/days/:date", companyCalendarHandler.DeleteCalendarDay, appmw.AdminOnlyMiddleware)
+	admin.GET("/locations", companyCalendarHandler.GetLocations)
+	admin.POST("/locations", companyCalendarHandler.CreateLocation, appmw.AdminOnlyMiddleware)
+	admin.PUT("/locations/:locationId", companyCalendarHandler.UpdateLocation, appmw.AdminOnlyMiddleware)
+	admin.DELETE("/locations/:locationId", companyCalendarHandler.DeleteLocation, appmw.AdminOnlyMiddleware)
+	admin.PUT("/users/:userId/location", companyCalendarHandler.UpdateUserLocation, appmw.AdminOnlyMiddleware)
+	admin.GET("/work-rules", workRuleHandler.GetWorkRules)
+	admin.POST("/work-rules", workRuleHandler.CreateWorkRule, appmw.AdminOnlyMiddleware)
+	admin.PUT("/work-rules/:ruleId", workRuleHandler.UpdateWorkRule, appmw.AdminOnlyMiddleware)
+	admin.DELETE("/work-rules/:ruleId", workRuleHandler.DeleteWorkRule, appmw.AdminOnlyMiddleware)
+	admin.GET("/users/:userId/work-rules", workRuleHandler.GetUserWorkRules)
+	admin.POST("/users/:userId/work-rules", workRuleHandler.AssignWorkRule, appmw.AdminOnlyMiddleware)
+	admin.DELETE("/users/:userId/work-rules/:assignmentId", workRuleHandler.DeleteWorkRuleAssignment, appmw.AdminOnlyMiddleware)
+	admin.POST("/schedules", scheduleHandler.CreateSchedules)
+	admin.POST("/schedules/import", scheduleHandler.ImportSchedules)
+	admin.GET("/schedules/export", scheduleHandler.ExportSchedules)
+	admin.PUT("/schedules/:scheduleId", scheduleHandler.UpdateSchedule)
+	admin.DELETE("/schedules/:scheduleId", scheduleHandler.DeleteSchedule)
+	admin.DELETE("/schedules", scheduleHandler.DeleteSchedules)
+	admin.GET("/shift-templates", rotaHandler.GetShiftTemplates)
+	admin.POST("/shift-templates", rotaHandler.CreateShiftTemplate)
+	admin.PUT("/shift-templates/:templateId", rotaHandler.UpdateShiftTemplate)
+	admin.DELETE("/shift-templates/:templateId", rotaHandler.DeleteShiftTemplate)
+	admin.GET("/rotation-patterns", rotaHandler.GetRotationPatterns)
+	admin.POST("/rotation-patterns", rotaHandler.CreateRotationPattern)
+	admin.PUT("/rotation-patterns/:patternId", rotaHandler.UpdateRotationPattern)
+	admin.DELETE("/rotation-patterns/:patternId", rotaHandler.DeleteRotationPattern)
+	admin.GET("/rotation-assignments", rotaHandler.GetRotationAssignments)
+	admin.POST("/rotation-assignments", rotaHandler.CreateRotationAssignment)
+	admin.DELETE("/rotation-assignments/:assignmentId", rotaHandler.DeleteRotationAssignment)
+	admin.POST("/rota/generate", rotaHandler.GenerateRota)
+	admin.GET("/staffing-requirements", autoScheduleHandler.GetStaffingRequirements)
+	admin.POST("/staffing-requirements", autoScheduleHandler.CreateStaffingRequirement)
+	admin.PUT("/staffing-requirements/:requirementId", autoScheduleHandler.UpdateStaffingRequirement)
+	admin.DELETE("/staffing-requirements/:requirementId", autoScheduleHandler.DeleteStaffingRequirement)
+	admin.GET("/schedule-drafts", autoScheduleHandler.GetScheduleDrafts)
+	admin.POST("/schedule-drafts", autoScheduleHandler.CreateScheduleDraft)
+	admin.GET("/schedule-drafts/:draftId", autoScheduleHandler.GetScheduleDraft)
+	admin.GET("/schedule-drafts/:draftId/availability", autoScheduleHandler.GetScheduleDraftAvailability)
+	admin.POST("/schedule-drafts/:draftId/accept", autoScheduleHandler.AcceptScheduleDraft)
+	admin.DELETE("/schedule-drafts/:draftId", autoScheduleHandler.DiscardScheduleDraft)
+	admin.GET("/availability-periods", availabilityHandler.GetAvailabilityPeriods)
+	admin.POST("/availability-periods", availabilityHandler.CreateAvailabilityPeriod)
+	admin.PUT("/availability-periods/:periodId", availabilityHandler.UpdateAvailabilityPeriod)
+	admin.DELETE("/availability-periods/:periodId", availabilityHandler.DeleteAvailabilityPeriod)
+	admin.GET("/availability-periods/:periodId/submissions", availabilityHandler.GetAvailabilitySubmissions)
+	admin.GET("/schedule-publications", publicationHandler.GetPublications)
+	admin.POST("/schedule-publications", publicationHandler.PublishSchedules)
+	admin.GET("/schedule-publications/pending-changes", publicationHandler.GetPendingChanges)
+	admin.GET("/schedule-publications/:publicationId/changes", publicationHandler.GetPublicationChanges)
+	admin.POST("/holiday-works", holidayWorkHandler.CreateHolidayWork)
+	admin.DELETE("/holiday-works/:holidayWorkId", holidayWorkHandler.DeleteHolidayWork)
+	admin.GET("/monthly-closes", monthlyCloseHandler.GetMonthlyCloses)
+	admin.POST("/monthly-closes/:month/users/:userId/approve", monthlyCloseHandler.ApproveMonth)
+	admin.POST("/monthly-closes/:month/users/:userId/return", monthlyCloseHandler.ReturnMonth)
+	admin.POST("/monthly-closes/:month/close", monthlyCloseHandler.CloseMonth, appmw.AdminOnlyMiddleware)
+	admin.POST("/monthly-closes/:month/reopen", monthlyCloseHandler.ReopenMonth, appmw.AdminOnlyMiddleware)
 }
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// clamdChunkSize is the largest chunk sent per INSTREAM frame. clamd rejects
+// frames above its StreamMaxLength, so files are sent in pieces.
+const clamdChunkSize = 64 << 10
+
+// ClamAV scans content with a clamd daemon over its INSTREAM command.
+type ClamAV struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamAV connects to clamd at address, either host:port or the path of
+// its unix socket.
+func NewClamAV(address string) (*ClamAV, error) {
+	if address == "" {
+		return nil, errors.New("CLAMAV_ADDRESS is required")
+	}
+	network := "tcp"
+	if strings.HasPrefix(address, "/") {
+		network = "unix"
+	}
+	return &ClamAV{network: network, address: address, timeout: 60 * time.Second}, nil
+}
+
+func (s *ClamAV) Name() string { return "clamav" }
+
+func (s *ClamAV) Scan(ctx context.Context, fileName string, data []byte) error {
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return fmt.Errorf("connect to clamd: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(conn, "zINSTREAM\x00"); err != nil {
+		return fmt.Errorf("send to clamd: %w", err)
+	}
+	var size [4]byte
+	for len(data) > 0 {
+		n := min(len(data), clamdChunkSize)
+		binary.BigEndian.PutUint32(size[:], uint32(n))
+		if _, err := conn.Write(size[:]); err != nil {
+			return fmt.Errorf("send to clamd: %w", err)
+		}
+		if _, err := conn.Write(data[:n]); err != nil {
+			return fmt.Errorf("send to clamd: %w", err)
+		}
+		data = data[n:]
+	}
+	binary.BigEndian.PutUint32(size[:], 0)
+	if _, err := conn.Write(size[:]); err != nil {
+		return fmt.Errorf("send to clamd: %w", err)
+	}
+
+	reply, err := io.ReadAll(io.LimitReader(conn, 1024))
+	if err != nil {
+		return fmt.Errorf("read from clamd: %w", err)
+	}
+	result := strings.TrimSpace(string(bytes.TrimRight(reply, "\x00")))
+	switch {
+	case strings.HasSuffix(result, " OK"):
+		return nil
+	case strings.HasSuffix(result, " FOUND"):
+		return fmt.Errorf("%w: %s", ErrInfected, strings.TrimPrefix(result, "stream: "))
+	default:
+		return fmt.Errorf("clamd: %s", result)
+	}
+}
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var ErrInfected = errors.New("file rejected by malware scan")
+
+// Scanner inspects uploaded content before it is stored. Implementations
+// return ErrInfected for content that must be rejected.
+type Scanner interface {
+	Scan(ctx context.Context, fileName string, data []byte) error
+	Name() string
+}
+
+// NewScannerFromEnv builds the scanner selected by MALWARE_SCANNER ("none"
+// by default, or "clamav").
+func NewScannerFromEnv() (Scanner, error) {
+	switch strings.ToLower(os.Getenv("MALWARE_SCANNER")) {
+	case "", "none":
+		return NoopScanner{}, nil
+	case "clamav":
+		return NewClamAV(os.Getenv("CLAMAV_ADDRESS"))
+	default:
+		return nil, fmt.Errorf("unknown MALWARE_SCANNER %q", os.Getenv("MALWARE_SCANNER"))
+	}
+}
+
+// NoopScanner accepts everything. Uploads it passes are recorded as unscanned.
+type NoopScanner struct{}
+
+func (NoopScanner) Scan(ctx context.Context, fileName string, data []byte) error { return nil }
+
+func (NoopScanner) Name() string { return "none" }